@@ -1,8 +1,53 @@
 package conf
 
-import "time"
+import (
+	"net/http"
+	"time"
+
+	"github.com/andyzhou/tinymeili/lib"
+	"github.com/meilisearch/meilisearch-go"
+)
 
 type (
+	QueueConf struct {
+		QueueSize      int                //queue size of each worker, 0 means default
+		Overflow       lib.OverflowPolicy //overflow policy when queue full, default block
+		BlockTimeout   time.Duration      //max block time of block policy, 0 means wait forever
+		SpillSize      int                //max spilled data of spill policy, 0 means no limit
+	}
+	TaskRetentionConf struct {
+		MaxAge   time.Duration            //delete finished tasks older than this
+		Interval time.Duration            //run interval, default 1 hour
+		Statuses []meilisearch.TaskStatus //optional, default succeeded, failed and canceled
+	}
+	BackupScheduleConf struct {
+		Interval time.Duration //run interval, must value
+		Timeout  time.Duration //optional, max time of one backup
+		Snapshot bool          //create snapshot instead of dump
+	}
+	RetryConf struct {
+		MaxAttempts    int           //max attempts include first call, <= 1 means no retry
+		BaseBackoff    time.Duration //backoff before first retry, doubled for next
+		MaxBackoff     time.Duration //max backoff between attempts
+		Jitter         float64       //random jitter ratio of backoff, 0~1
+		RetryNetwork   bool          //retry network errors
+		Retry5xx       bool          //retry http 5xx responses
+		Retry429       bool          //retry http 429 responses
+		RetryTaskCodes []string      //retry failed task with these error codes
+	}
+	//nil or unassigned fields keep live value
+	TypoToleranceConf struct {
+		Enabled             *bool
+		OneTypo             *int64   //min word size for one typo
+		TwoTypos            *int64   //min word size for two typos
+		DisableOnWords      []string
+		DisableOnAttributes []string
+	}
+	//nil or unassigned fields keep live value
+	FacetingConf struct {
+		MaxValuesPerFacet *int64
+		SortFacetValuesBy map[string]meilisearch.SortFacetType //merged into live value
+	}
 	IndexConf struct {
 		IndexName        string //must value
 		PrimaryKey       string //must value
@@ -12,6 +57,36 @@ type (
 		CreateIndex      bool
 		UpdateFields 	 bool
 		Timeout 		 time.Duration
+		BatchMaxDocs     int           //max docs of one write batch, > 1 will enable micro batching
+		BatchMaxBytes    int           //max payload bytes of one write batch
+		BatchLinger      time.Duration //max wait time before flush batch
+		SpoolDir         string        //optional, local write-ahead spool dir
+		SpoolSync        bool          //sync spool file after each write
+		SpoolCompactSize int64         //optional, compact spool file when acked bytes over it
+		ClientTag        string        //optional, use client tag if empty, part of spool file name
+		Host             string        //optional, use client host if empty, for raw search and docs api
+		ApiKey           string        //optional, use client api key if empty
+		HttpClient       *http.Client  //optional, use client http client if nil, for raw api
+		Retry            *RetryConf    //optional, use client retry if nil
+		Queue            *QueueConf    //optional, use client queue setting if nil
+		Metrics          lib.MetricsSink //optional, use client metrics if nil
+		//optional settings, applied when UpdateFields is true
+		SearchableFields    []string
+		DisplayedFields     []string
+		RankingRules        []string
+		DistinctField       string
+		Synonyms            map[string][]string
+		StopWords           []string
+		TypoTolerance       *TypoToleranceConf //overlay on live value
+		Faceting            *FacetingConf      //overlay on live value
+		Pagination          *meilisearch.Pagination
+		ProximityPrecision  meilisearch.ProximityPrecisionType
+		SeparatorTokens     []string
+		NonSeparatorTokens  []string
+		Dictionary          []string
+		SearchCutoffMs      int64
+		LocalizedAttributes []*meilisearch.LocalizedAttributes
+		Embedders           map[string]meilisearch.Embedder //embedder name -> config
 	}
 	ClientConf struct {
 		Tag         string
@@ -20,5 +95,12 @@ type (
 		TimeOut     time.Duration
 		IndexesConf []*IndexConf //indexes config
 		Workers     int          //inter concurrency workers
+		Retry       *RetryConf   //optional, retry policy for meili calls and tasks
+		Queue       *QueueConf   //optional, write queue size and overflow policy
+		Metrics     lib.MetricsSink //optional, expvar sink if nil, lib.NopSink{} for disable
+		TaskRetention *TaskRetentionConf //optional, prune finished tasks periodically
+		AliasIndex    string             //optional, metadata index for persist aliases
+		AliasRefresh  time.Duration      //optional, reload persisted aliases periodically
+		BackupSchedule *BackupScheduleConf //optional, create dump or snapshot periodically
 	}
 )
@@ -6,4 +6,44 @@ const (
 	DefaultPageSize = 10
 	DefaultWorkers  = 3
 	DefaultTimeOut  = 10 //xx seconds
-)
\ No newline at end of file
+	DefaultBatchMaxBytes = 10 * 1024 * 1024 //10MB, under meili payload limit
+	DefaultBatchLinger   = 20 //xx milliseconds
+	DefaultRetryBaseBackoff = 100 //xx milliseconds
+	DefaultRetryMaxBackoff  = 5   //xx seconds
+	DefaultTaskInterval = 50 //xx milliseconds
+	DefaultTaskRetentionInterval = 3600 //xx seconds
+	DefaultAliasPageSize = 1000
+	MultiSearchIndexLabel = "_multi" //metrics index label of multi search
+	DefaultEmbedder = "default"
+	DefaultScanPageSize = 1000
+	DefaultScanPrefetch = 1 //xx pages
+	DefaultTransferBatchSize = 1000
+	DefaultBulkBatchDocs = 1000
+	DefaultBulkConcurrency = 2
+	DefaultBackupTaskInterval = 1000 //xx milliseconds
+	DefaultKeyPageSize = 100
+	KeyRotatedTag = "@rotated@" //name tag of rotated key, followed by rotated unix time
+	DefaultSpoolSlots = 16
+	DefaultSpoolReplayInterval = 500 //xx milliseconds
+	DefaultSpoolReplayMaxInterval = 60 //xx seconds
+)
+
+//embedder source
+const (
+	EmbedderSourceUserProvided = "userProvided"
+	EmbedderSourceRest         = "rest"
+	EmbedderSourceOpenAi       = "openAi"
+	EmbedderSourceHuggingFace  = "huggingFace"
+	EmbedderSourceOllama       = "ollama"
+)
+
+//document level task error codes
+//batch task failed with these codes resubmitted request by request
+var DocumentErrorCodes = []string{
+	"missing_document_id",
+	"invalid_document_id",
+	"invalid_document_fields",
+	"invalid_document_geo_field",
+	"invalid_vector_dimensions",
+	"document_fields_limit_reached",
+}
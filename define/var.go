@@ -10,5 +10,29 @@ type (
 		Sort               []string
 		Facets             []string //agg fields
 		Page, PageSize     int
+		IndexName          string  //target index or alias, for multi search
+		Weight             float64 //query weight, for federated search
+
+		//highlight and crop
+		AttributesToHighlight []string //`*` for all displayed fields
+		HighlightPreTag       string
+		HighlightPostTag      string
+		AttributesToCrop      []string //support `field:length` format
+		CropLength            int
+		CropMarker            string
+		ShowMatchesPosition   bool
+
+		//vector and hybrid search
+		Vector                []float32   //query vector, needed for user provided embedder
+		Hybrid                *HybridPara //optional, hybrid search
+		RetrieveVectors       bool        //return `_vectors` of hits
+		ShowRankingScore      bool        //return `_rankingScore` of hits
+		RankingScoreThreshold float64     //exclude hits with lower ranking score, 0~1
+	}
+
+	//hybrid search para
+	HybridPara struct {
+		Embedder      string  //default embedder if empty
+		SemanticRatio *float64 //nil means meili default 0.5, 0 means full keyword, 1 means full semantic
 	}
 )
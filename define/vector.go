@@ -0,0 +1,43 @@
+package define
+
+//vectors of doc, embedder name -> vector value
+//embed VectorsDoc into doc struct to carry `_vectors`
+type (
+	Vectors map[string]*VectorValue
+
+	VectorValue struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Regenerate bool        `json:"regenerate"` //false for user provided vectors
+	}
+
+	VectorsDoc struct {
+		Vectors Vectors `json:"_vectors,omitempty"`
+	}
+)
+
+//set vectors of embedder
+func (v *VectorsDoc) SetVectors(
+	embedder string,
+	embeddings ...[]float32) {
+	if embedder == "" {
+		embedder = DefaultEmbedder
+	}
+	if v.Vectors == nil {
+		v.Vectors = Vectors{}
+	}
+	v.Vectors[embedder] = &VectorValue{
+		Embeddings: embeddings,
+	}
+}
+
+//get first vector of embedder
+func (v *VectorsDoc) GetVector(embedder string) []float32 {
+	if embedder == "" {
+		embedder = DefaultEmbedder
+	}
+	value, ok := v.Vectors[embedder]
+	if !ok || value == nil || len(value.Embeddings) <= 0 {
+		return nil
+	}
+	return value.Embeddings[0]
+}
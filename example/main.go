@@ -104,7 +104,7 @@ func addDoc(beginId int64) error {
 	}
 
 	//add doc
-	err = indexObj.GetDoc().AddDoc(*obj)
+	_, err = indexObj.GetDoc().AddDoc(*obj)
 	return err
 }
 
@@ -121,11 +121,11 @@ func delDoc() error {
 
 	//del doc by ids
 	docIds := []string{"1711266923113935000"}
-	err = indexObj.GetDoc().DelDoc("", docIds...)
+	_, err = indexObj.GetDoc().DelDoc("", docIds...)
 
 	////del doc by filter
 	//filter := "tags = 'china'"
-	//err = indexObj.GetDoc().DelDocsByFilter([]string{filter})
+	//_, err = indexObj.GetDoc().DelDocsByFilter([]string{filter})
 	return err
 }
 
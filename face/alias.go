@@ -0,0 +1,241 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * index alias face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - alias -> physical index name, resolved by client
+ * - optional persisted in metadata index on meili host
+ */
+
+//alias name rule, same as index uid
+var aliasNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+//inter type
+type (
+	aliasDoc struct {
+		Id        string `json:"id"`    //alias name
+		Index     string `json:"index"` //physical index name
+		UpdatedAt int64  `json:"updatedAt"`
+	}
+)
+
+//set alias of physical index
+func (f *Client) SetAlias(alias, indexName string) error {
+	return f.SetAliasWithContext(context.Background(), alias, indexName)
+}
+
+//set alias with context
+//alias persisted first if metadata index assigned
+func (f *Client) SetAliasWithContext(
+	ctx context.Context,
+	alias, indexName string) error {
+	//check
+	if alias == "" || indexName == "" || alias == indexName {
+		return errors.New("invalid parameter")
+	}
+	if !aliasNameRegexp.MatchString(alias) {
+		return fmt.Errorf("invalid alias name `%v`", alias)
+	}
+
+	//persist alias
+	if f.cfg.AliasIndex != "" {
+		doc := []aliasDoc{
+			{
+				Id: alias,
+				Index: indexName,
+				UpdatedAt: time.Now().Unix(),
+			},
+		}
+		_, err := f.tasks.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+			return f.client.Index(f.cfg.AliasIndex).AddDocumentsWithContext(ctx, doc, "id")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	//sync into local map
+	f.aliasLocker.Lock()
+	defer f.aliasLocker.Unlock()
+	f.aliasMap[alias] = indexName
+	return nil
+}
+
+//remove alias
+func (f *Client) RemoveAlias(alias string) error {
+	return f.RemoveAliasWithContext(context.Background(), alias)
+}
+
+//remove alias with context
+func (f *Client) RemoveAliasWithContext(
+	ctx context.Context,
+	alias string) error {
+	//check
+	if alias == "" {
+		return errors.New("invalid parameter")
+	}
+
+	//remove persisted alias
+	if f.cfg.AliasIndex != "" {
+		_, err := f.tasks.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+			return f.client.Index(f.cfg.AliasIndex).DeleteDocumentWithContext(ctx, alias)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	//remove from local map
+	f.aliasLocker.Lock()
+	defer f.aliasLocker.Unlock()
+	delete(f.aliasMap, alias)
+	return nil
+}
+
+//get all aliases, alias -> physical index name
+func (f *Client) GetAliases() map[string]string {
+	f.aliasLocker.RLock()
+	defer f.aliasLocker.RUnlock()
+	result := make(map[string]string, len(f.aliasMap))
+	for k, v := range f.aliasMap {
+		result[k] = v
+	}
+	return result
+}
+
+//resolve alias into physical index name
+//return origin name if not alias
+func (f *Client) ResolveIndexName(name string) string {
+	f.aliasLocker.RLock()
+	defer f.aliasLocker.RUnlock()
+	if indexName, ok := f.aliasMap[name]; ok {
+		return indexName
+	}
+	return name
+}
+
+//reload aliases from metadata index
+func (f *Client) ReloadAliases() error {
+	return f.ReloadAliasesWithContext(context.Background())
+}
+
+//reload aliases from metadata index with context
+func (f *Client) ReloadAliasesWithContext(ctx context.Context) error {
+	var (
+		offset int64
+	)
+	//check
+	if f.cfg.AliasIndex == "" {
+		return errors.New("alias index not assigned")
+	}
+
+	//load all alias docs page by page
+	aliasMap := map[string]string{}
+	index := f.client.Index(f.cfg.AliasIndex)
+	for {
+		resp := &meilisearch.DocumentsResult{}
+		err := index.GetDocumentsWithContext(ctx, &meilisearch.DocumentsQuery{
+			Offset: offset,
+			Limit: define.DefaultAliasPageSize,
+		}, resp)
+		if err != nil {
+			return err
+		}
+		for _, v := range resp.Results {
+			alias, _ := v["id"].(string)
+			indexName, _ := v["index"].(string)
+			if alias != "" && indexName != "" {
+				aliasMap[alias] = indexName
+			}
+		}
+		offset += int64(len(resp.Results))
+		if len(resp.Results) <= 0 || offset >= resp.Total {
+			break
+		}
+	}
+
+	//replace local map
+	f.aliasLocker.Lock()
+	defer f.aliasLocker.Unlock()
+	f.aliasMap = aliasMap
+	return nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//init alias metadata index and load aliases
+func (f *Client) initAlias() error {
+	//check
+	if f.cfg.AliasIndex == "" {
+		return nil
+	}
+	ctx := context.Background()
+
+	//create metadata index if not exists
+	_, err := f.tasks.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.CreateIndexWithContext(ctx, &meilisearch.IndexConfig{
+			Uid: f.cfg.AliasIndex,
+			PrimaryKey: "id",
+		})
+	})
+	if err != nil && !isTaskErrorCode(err, "index_already_exists") {
+		return err
+	}
+
+	//load aliases
+	err = f.ReloadAliasesWithContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	//refresh aliases periodically
+	if f.cfg.AliasRefresh > 0 {
+		f.aliasCloseChan = make(chan bool, 1)
+		go f.runAliasRefresh(f.cfg.AliasRefresh, f.aliasCloseChan)
+	}
+	return nil
+}
+
+//stop alias refresh
+func (f *Client) stopAliasRefresh() {
+	if f.aliasCloseChan != nil {
+		close(f.aliasCloseChan)
+		f.aliasCloseChan = nil
+	}
+}
+
+//run alias refresh process
+func (f *Client) runAliasRefresh(
+	interval time.Duration,
+	closeChan chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <- ticker.C:
+			{
+				err := f.ReloadAliases()
+				if err != nil {
+					log.Printf("client.runAliasRefresh, reload failed, err:%v\n", err.Error())
+				}
+			}
+		case <- closeChan:
+			return
+		}
+	}
+}
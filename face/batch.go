@@ -0,0 +1,283 @@
+package face
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+)
+
+/*
+ * doc write micro batching
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - coalesce queued add/update doc requests of one son worker
+ * - same operation in a row merged into one meili call
+ * - remove request breaks the row, keep requests order
+ * - batch failed by bad doc resubmitted request by request
+ */
+
+//inter type
+type (
+	docBatch struct {
+		isUpdate bool
+		reqs     []syncDocReq
+		counts   []int //docs count of each request
+		docs     []json.RawMessage
+		bytes    int
+	}
+)
+
+/////////////////
+//private func
+/////////////////
+
+//cb for worker batch opt
+func (f *Doc) cbForWorkerBatchOpt(inputs []interface{}) error {
+	var (
+		batch *docBatch
+	)
+	//check
+	if inputs == nil || len(inputs) <= 0 {
+		return errors.New("invalid parameter")
+	}
+
+	//flush current batch
+	flush := func() {
+		if batch != nil {
+			f.flushDocBatch(batch)
+			batch = nil
+		}
+	}
+
+	//process one by one
+	maxDocs, maxBytes := f.getBatchLimit()
+	for _, input := range inputs {
+		switch req := input.(type) {
+		case syncDocReq:
+			{
+				//check context and abandoned
+				err := f.getReqContext(req.ctx).Err()
+				if err == nil {
+					err = f.checkAbandoned()
+				}
+				if err != nil {
+					f.finishWriteReq(req.future, req.spoolSeq, nil, nil, 0, err)
+					continue
+				}
+
+				//encode docs
+				docs, size, err := f.encodeDocs(req.obj)
+				if err != nil {
+					f.finishWriteReq(req.future, req.spoolSeq, nil, nil, 0, err)
+					continue
+				}
+
+				//flush if operation changed or reach limit
+				if batch != nil &&
+					(batch.isUpdate != req.isUpdate ||
+						len(batch.docs) + len(docs) > maxDocs ||
+						batch.bytes + size > maxBytes) {
+					flush()
+				}
+				if batch == nil {
+					batch = &docBatch{
+						isUpdate: req.isUpdate,
+					}
+				}
+				batch.reqs = append(batch.reqs, req)
+				batch.counts = append(batch.counts, len(docs))
+				batch.docs = append(batch.docs, docs...)
+				batch.bytes += size
+			}
+		case removeDocReq:
+			{
+				//flush pending batch first for keep order
+				flush()
+				f.cbForWorkerOpt(req)
+			}
+		default:
+			{
+				flush()
+				return fmt.Errorf("invalid data type `%v`", req)
+			}
+		}
+	}
+	flush()
+	return nil
+}
+
+//flush one doc batch
+func (f *Doc) flushDocBatch(batch *docBatch) {
+	//check
+	if batch == nil || len(batch.reqs) <= 0 {
+		return
+	}
+
+	//skip requests done while lingering
+	reqs := make([]syncDocReq, 0, len(batch.reqs))
+	reqsDocs := make([][]json.RawMessage, 0, len(batch.reqs))
+	docs := make([]json.RawMessage, 0, len(batch.docs))
+	offset := 0
+	for i, v := range batch.reqs {
+		reqDocs := batch.docs[offset:offset + batch.counts[i]]
+		offset += batch.counts[i]
+		if err := f.getReqContext(v.ctx).Err(); err != nil {
+			f.finishWriteReq(v.future, v.spoolSeq, nil, nil, 0, err)
+			continue
+		}
+		reqs = append(reqs, v)
+		reqsDocs = append(reqsDocs, reqDocs)
+		docs = append(docs, reqDocs...)
+	}
+	if len(reqs) <= 0 {
+		return
+	}
+
+	//sync batch docs
+	ctx, cancel := genBatchContext(reqs)
+	defer cancel()
+	req := &syncDocReq{
+		ctx: ctx,
+		obj: docs,
+		isUpdate: batch.isUpdate,
+	}
+	taskInfo, task, attempts, err := f.syncDocObj(req)
+
+	//bad doc failed whole batch, resubmit one by one
+	//so that only the request with bad doc failed
+	if err != nil && len(reqs) > 1 && isDocumentError(err) {
+		for i, v := range reqs {
+			subReq := &syncDocReq{
+				ctx: v.ctx,
+				obj: reqsDocs[i],
+				isUpdate: batch.isUpdate,
+			}
+			subTaskInfo, subTask, subAttempts, subErr := f.syncDocObj(subReq)
+			f.finishWriteReq(v.future, v.spoolSeq, subTaskInfo, subTask, attempts + subAttempts, subErr)
+		}
+		return
+	}
+
+	//finish all futures of batch
+	for _, v := range reqs {
+		f.finishWriteReq(v.future, v.spoolSeq, taskInfo, task, attempts, err)
+	}
+}
+
+//check error is document level task error
+func isDocumentError(err error) bool {
+	for _, code := range define.DocumentErrorCodes {
+		if isTaskErrorCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+//gen context of batch requests
+//deadline is the earliest one of requests,
+//canceled when all requests' contexts done
+func genBatchContext(reqs []syncDocReq) (context.Context, context.CancelFunc) {
+	var (
+		deadline time.Time
+		doneChans []<-chan struct{}
+	)
+	//only one request, keep origin context
+	if len(reqs) == 1 && reqs[0].ctx != nil {
+		return reqs[0].ctx, func() {}
+	}
+
+	//pick earliest deadline and done chans
+	cancelable := true
+	for _, req := range reqs {
+		if req.ctx == nil || req.ctx.Done() == nil {
+			//never canceled
+			cancelable = false
+			continue
+		}
+		if d, ok := req.ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+		doneChans = append(doneChans, req.ctx.Done())
+	}
+
+	//setup batch context
+	ctx, cancel := context.WithCancel(context.Background())
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
+	if cancelable && len(doneChans) > 0 {
+		go func() {
+			for _, done := range doneChans {
+				select {
+				case <- done:
+				case <- ctx.Done():
+					return
+				}
+			}
+			cancel()
+		}()
+	}
+	return ctx, cancel
+}
+
+//encode doc obj into raw docs
+//return raw docs, total bytes, error
+func (f *Doc) encodeDocs(obj interface{}) ([]json.RawMessage, int, error) {
+	//check
+	if obj == nil {
+		return nil, 0, errors.New("invalid parameter")
+	}
+
+	//encode obj
+	objBytes, err := json.Marshal(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+	objBytes = bytes.TrimSpace(objBytes)
+
+	//one doc
+	if len(objBytes) <= 0 || objBytes[0] != '[' {
+		return []json.RawMessage{objBytes}, len(objBytes), nil
+	}
+
+	//batch docs
+	docs := make([]json.RawMessage, 0)
+	err = json.Unmarshal(objBytes, &docs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return docs, len(objBytes), nil
+}
+
+//get batch limit, max docs and max bytes
+func (f *Doc) getBatchLimit() (int, int) {
+	maxDocs := f.indexConf.BatchMaxDocs
+	if maxDocs <= 0 {
+		maxDocs = 1
+	}
+	maxBytes := f.indexConf.BatchMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = define.DefaultBatchMaxBytes
+	}
+	return maxDocs, maxBytes
+}
+
+//get batch linger time
+func (f *Doc) getBatchLinger() time.Duration {
+	linger := f.indexConf.BatchLinger
+	if linger <= 0 {
+		linger = time.Duration(define.DefaultBatchLinger) * time.Millisecond
+	}
+	return linger
+}
+
+//check batch mode is enabled or not
+func (f *Doc) batchEnabled() bool {
+	return f.indexConf.BatchMaxDocs > 1
+}
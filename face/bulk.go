@@ -0,0 +1,414 @@
+package face
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * bulk ingest face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - source: slice, channel or io.Reader of ndjson or json array
+ * - chunk by docs count and payload bytes
+ * - docs hashed into lanes by primary key, one batch in flight per lane,
+ *   keep order of same doc's writes
+ * - lanes count is max concurrency
+ * - per batch result and overall progress by callbacks
+ */
+
+//inter type
+type (
+	//bulk ingest options
+	BulkOptions struct {
+		BatchDocs   int  //max docs of one batch
+		BatchBytes  int  //max payload bytes of one batch, keep under meili payload limit
+		Concurrency int  //max batches in flight, docs of same id always in same lane
+		IsUpdate    bool //partial update docs instead of add or replace
+		OnBatch     func(result *BulkBatchResult) //called after each batch finished
+		OnProgress  func(progress BulkProgress)   //called after each batch finished
+	}
+
+	//one batch result
+	BulkBatchResult struct {
+		Seq      int64 //batch sequence, from 1
+		Docs     int
+		Bytes    int
+		TaskUID  int64
+		Task     *meilisearch.Task
+		Attempts int
+		Duration time.Duration
+		Err      error
+	}
+
+	//bulk progress
+	BulkProgress struct {
+		DocsSent      int64
+		DocsIndexed   int64
+		DocsFailed    int64
+		BatchesDone   int64
+		BatchesFailed int64
+		Elapsed       time.Duration
+		DocsPerSecond float64 //indexed docs per second
+	}
+
+	//bulk lane, batches of lane submitted one by one
+	bulkLane struct {
+		docs  []json.RawMessage
+		bytes int
+		busy  chan struct{} //one batch in flight
+	}
+
+	//bulk ingest runner
+	bulkRunner struct {
+		doc      *Doc
+		ctx      context.Context
+		opts     *BulkOptions
+		begin    time.Time
+		seq      int64
+		lanes    []*bulkLane
+		wg       sync.WaitGroup
+		progress BulkProgress
+		lastErr  error
+		locker   sync.Mutex
+	}
+)
+
+//bulk ingest docs from source
+//source can be slice, channel or io.Reader of ndjson or json array
+//sync opt, return final progress until all batches finished
+func (f *Doc) BulkIngest(
+	ctx context.Context,
+	source interface{},
+	opts *BulkOptions) (*BulkProgress, error) {
+	//check
+	if source == nil {
+		return nil, errors.New("invalid parameter")
+	}
+	if f.index == nil {
+		return nil, errors.New("inter index not init")
+	}
+	if f.IsClosed() {
+		return nil, ErrDocClosed
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//init runner
+	runner := newBulkRunner(f, ctx, opts)
+
+	//read source
+	var err error
+	switch v := source.(type) {
+	case io.Reader:
+		err = runner.readReader(v)
+	default:
+		{
+			rv := reflect.ValueOf(source)
+			switch rv.Kind() {
+			case reflect.Slice, reflect.Array:
+				err = runner.readSlice(rv)
+			case reflect.Chan:
+				if rv.Type().ChanDir() & reflect.RecvDir == 0 {
+					err = errors.New("source channel can not receive")
+				}else{
+					err = runner.readChan(rv)
+				}
+			default:
+				err = fmt.Errorf("unsupported source type %T", source)
+			}
+		}
+	}
+
+	//flush rest docs and wait all batches
+	if err == nil {
+		runner.flushAll()
+	}
+	runner.wg.Wait()
+
+	//gen final result
+	progress := runner.snapshot()
+	if err != nil {
+		return &progress, err
+	}
+	if progress.BatchesFailed > 0 {
+		return &progress, fmt.Errorf("%v of %v batches failed, last err:%v",
+			progress.BatchesFailed, progress.BatchesDone, runner.lastErr)
+	}
+	return &progress, nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//new bulk runner
+func newBulkRunner(
+	doc *Doc,
+	ctx context.Context,
+	opts *BulkOptions) *bulkRunner {
+	opt := &BulkOptions{}
+	if opts != nil {
+		*opt = *opts
+	}
+	if opt.BatchDocs <= 0 {
+		opt.BatchDocs = define.DefaultBulkBatchDocs
+	}
+	if opt.BatchBytes <= 0 {
+		opt.BatchBytes = define.DefaultBatchMaxBytes
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = define.DefaultBulkConcurrency
+	}
+	this := &bulkRunner{
+		doc: doc,
+		ctx: ctx,
+		opts: opt,
+		begin: time.Now(),
+		lanes: make([]*bulkLane, opt.Concurrency),
+	}
+	for i := range this.lanes {
+		this.lanes[i] = &bulkLane{
+			busy: make(chan struct{}, 1),
+		}
+	}
+	return this
+}
+
+//read docs from slice
+func (r *bulkRunner) readSlice(rv reflect.Value) error {
+	for i := 0; i < rv.Len(); i++ {
+		if err := r.addObj(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//read docs from channel until closed
+func (r *bulkRunner) readChan(rv reflect.Value) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: rv},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.ctx.Done())},
+	}
+	for {
+		chosen, val, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return r.ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		if err := r.addObj(val.Interface()); err != nil {
+			return err
+		}
+	}
+}
+
+//read docs from reader, ndjson or json array
+func (r *bulkRunner) readReader(reader io.Reader) error {
+	buffReader := bufio.NewReader(reader)
+
+	//check first non-space byte
+	for {
+		b, err := buffReader.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		buffReader.ReadByte()
+	}
+
+	//decode docs one by one
+	decoder := json.NewDecoder(buffReader)
+	isArray := false
+	if b, _ := buffReader.Peek(1); b[0] == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		isArray = true
+	}
+	for decoder.More() {
+		doc := json.RawMessage{}
+		if err := decoder.Decode(&doc); err != nil {
+			return err
+		}
+		if err := r.addDoc(doc); err != nil {
+			return err
+		}
+	}
+	if isArray {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//add one doc obj
+func (r *bulkRunner) addObj(obj interface{}) error {
+	doc, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return r.addDoc(doc)
+}
+
+//add one raw doc, flush lane if reach limit
+func (r *bulkRunner) addDoc(doc json.RawMessage) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	doc = bytes.TrimSpace(doc)
+	lane := r.lanes[r.pickLane(doc)]
+	if len(lane.docs) > 0 && lane.bytes + len(doc) + 1 > r.opts.BatchBytes {
+		r.flush(lane)
+	}
+	lane.docs = append(lane.docs, doc)
+	lane.bytes += len(doc) + 1
+	if len(lane.docs) >= r.opts.BatchDocs {
+		r.flush(lane)
+	}
+	return nil
+}
+
+//pick lane by primary key value of doc
+//whole doc hashed if primary key not found
+func (r *bulkRunner) pickLane(doc json.RawMessage) int {
+	if len(r.lanes) <= 1 {
+		return 0
+	}
+	key := []byte(doc)
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(doc, &fields) == nil {
+		if id, ok := fields[r.doc.indexConf.PrimaryKey]; ok {
+			//meili treats string and integer id as same
+			key = bytes.Trim(id, `"`)
+		}
+	}
+	hash := fnv.New32a()
+	hash.Write(key)
+	return int(hash.Sum32() % uint32(len(r.lanes)))
+}
+
+//submit rest batches of all lanes
+func (r *bulkRunner) flushAll() {
+	for _, lane := range r.lanes {
+		r.flush(lane)
+	}
+}
+
+//submit current batch of lane
+//blocked until previous batch of lane finished
+func (r *bulkRunner) flush(lane *bulkLane) {
+	//check
+	if len(lane.docs) <= 0 {
+		return
+	}
+	docs, size := lane.docs, lane.bytes
+	lane.docs, lane.bytes = nil, 0
+	r.seq++
+	seq := r.seq
+
+	r.locker.Lock()
+	r.progress.DocsSent += int64(len(docs))
+	r.locker.Unlock()
+
+	//wait previous batch of lane
+	lane.busy <- struct{}{}
+	r.wg.Add(1)
+	go func() {
+		defer func() {
+			<- lane.busy
+			r.wg.Done()
+		}()
+		r.submit(seq, docs, size)
+	}()
+}
+
+//submit one batch and wait task
+func (r *bulkRunner) submit(
+	seq int64,
+	docs []json.RawMessage,
+	size int) {
+	begin := time.Now()
+	req := &syncDocReq{
+		ctx: r.ctx,
+		obj: docs,
+		isUpdate: r.opts.IsUpdate,
+	}
+	taskInfo, task, attempts, err := r.doc.syncDocObj(req)
+
+	//gen batch result
+	result := &BulkBatchResult{
+		Seq: seq,
+		Docs: len(docs),
+		Bytes: size,
+		Task: task,
+		Attempts: attempts,
+		Duration: time.Since(begin),
+		Err: err,
+	}
+	if taskInfo != nil {
+		result.TaskUID = taskInfo.TaskUID
+	}
+
+	//update progress
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.progress.BatchesDone++
+	if err != nil {
+		r.progress.BatchesFailed++
+		r.progress.DocsFailed += int64(len(docs))
+		r.lastErr = err
+	}else{
+		indexed := int64(len(docs))
+		if task != nil && task.Details.IndexedDocuments > 0 {
+			indexed = task.Details.IndexedDocuments
+		}
+		r.progress.DocsIndexed += indexed
+	}
+
+	//notify callbacks, called in order under lock
+	if r.opts.OnBatch != nil {
+		r.opts.OnBatch(result)
+	}
+	if r.opts.OnProgress != nil {
+		r.opts.OnProgress(r.genProgress())
+	}
+}
+
+//get progress snapshot
+func (r *bulkRunner) snapshot() BulkProgress {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.genProgress()
+}
+
+//gen progress with throughput, locker should be held
+func (r *bulkRunner) genProgress() BulkProgress {
+	progress := r.progress
+	progress.Elapsed = time.Since(r.begin)
+	if seconds := progress.Elapsed.Seconds(); seconds > 0 {
+		progress.DocsPerSecond = float64(progress.DocsIndexed) / seconds
+	}
+	return progress
+}
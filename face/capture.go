@@ -0,0 +1,158 @@
+package face
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * doc write capture face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - record applied writes while index rebuilding
+ * - gate writes while shadow index swapping
+ * - replay recorded writes into shadow index in order
+ */
+
+//capture errors
+var (
+	ErrCaptureStarted = errors.New("write capture already started")
+)
+
+//inter type
+type (
+	//one applied write
+	capturedWrite struct {
+		isRemove bool
+		isUpdate bool
+		docs     []json.RawMessage
+		docIds   []string
+		filter   interface{}
+	}
+	//writes recorded while capturing
+	writeCapture struct {
+		writes []*capturedWrite
+		active bool
+		sync.Mutex
+	}
+)
+
+/////////////////
+//private func
+/////////////////
+
+//start capture applied writes
+func (f *Doc) startCapture() error {
+	f.capture.Lock()
+	defer f.capture.Unlock()
+	if f.capture.active {
+		return ErrCaptureStarted
+	}
+	f.capture.active = true
+	f.capture.writes = nil
+	return nil
+}
+
+//stop capture and return recorded writes
+func (f *Doc) stopCapture() []*capturedWrite {
+	f.capture.Lock()
+	defer f.capture.Unlock()
+	writes := f.capture.writes
+	f.capture.active = false
+	f.capture.writes = nil
+	return writes
+}
+
+//pause writes, wait in-flight writes finished
+func (f *Doc) pauseWrites() {
+	f.gate.Lock()
+}
+
+//resume paused writes
+func (f *Doc) resumeWrites() {
+	f.gate.Unlock()
+}
+
+//record applied add or update write
+func (f *Doc) captureSync(req *syncDocReq) {
+	f.capture.Lock()
+	defer f.capture.Unlock()
+	if !f.capture.active {
+		return
+	}
+	docs, _, err := f.encodeDocs(req.obj)
+	if err != nil {
+		//obj already encoded by sdk, should not happen
+		return
+	}
+	f.capture.writes = append(f.capture.writes, &capturedWrite{
+		isUpdate: req.isUpdate,
+		docs: docs,
+	})
+}
+
+//record applied remove write
+func (f *Doc) captureRemove(req *removeDocReq) {
+	f.capture.Lock()
+	defer f.capture.Unlock()
+	if !f.capture.active {
+		return
+	}
+	f.capture.writes = append(f.capture.writes, &capturedWrite{
+		isRemove: true,
+		docIds: req.docIds,
+		filter: req.filter,
+	})
+}
+
+//replay captured writes into shadow index in order
+//continuous add or update writes merged into one task
+func (f *Index) replayCaptured(
+	ctx context.Context,
+	shadow meilisearch.IndexManager,
+	writes []*capturedWrite) error {
+	var (
+		err error
+	)
+	for i := 0; i < len(writes); {
+		write := writes[i]
+		if write.isRemove {
+			_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+				if write.filter != nil {
+					return shadow.DeleteDocumentsByFilterWithContext(ctx, write.filter)
+				}
+				return shadow.DeleteDocumentsWithContext(ctx, write.docIds)
+			})
+			if err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+
+		//merge continuous same kind writes
+		docs := make([]json.RawMessage, 0, len(write.docs))
+		j := i
+		for ; j < len(writes); j++ {
+			if writes[j].isRemove || writes[j].isUpdate != write.isUpdate {
+				break
+			}
+			docs = append(docs, writes[j].docs...)
+		}
+		_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+			if write.isUpdate {
+				return shadow.UpdateDocumentsWithContext(ctx, docs, f.indexConf.PrimaryKey)
+			}
+			return shadow.AddDocumentsWithContext(ctx, docs, f.indexConf.PrimaryKey)
+		})
+		if err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
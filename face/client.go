@@ -1,13 +1,17 @@
 package face
 
 import (
+	"context"
 	"errors"
+	"log"
+	"net/http"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/andyzhou/tinymeili/conf"
 	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/lib"
 	"github.com/meilisearch/meilisearch-go"
 )
 
@@ -23,7 +27,18 @@ import (
 type Client struct {
 	cfg      *conf.ClientConf //reference
 	client   meilisearch.ServiceManager
+	httpClient *http.Client //shared by sdk and raw requests
+	tasks    *TaskManager
+	keys     *KeyManager
+	retry    *retryPolicy
+	metrics  *metricsRecorder
 	indexMap map[string]*Index //tag -> *Index
+	aliasMap map[string]string //alias -> index name
+	aliasCloseChan chan bool
+	aliasLocker sync.RWMutex
+	backupCloseChan chan bool
+	backupStatus BackupStatus
+	backupLocker sync.RWMutex
 	sync.RWMutex
 }
 
@@ -32,32 +47,64 @@ func NewClient(cfg *conf.ClientConf) *Client {
 	this := &Client{
 		cfg: cfg,
 		indexMap: map[string]*Index{},
+		aliasMap: map[string]string{},
 	}
 	this.interInit()
 	return this
 }
 
 //quit
-func (f *Client) Quit() {
+//drain all indexes concurrently until ctx done
+//return merged report of all indexes
+func (f *Client) Quit(ctx context.Context) (*QuitReport, error) {
+	var (
+		wg sync.WaitGroup
+		locker sync.Mutex
+		err error
+	)
+	report := &QuitReport{}
+
+	//stop task retention job
+	if f.tasks != nil {
+		f.tasks.StopRetention()
+	}
+	f.stopAliasRefresh()
+	f.StopBackupSchedule()
+
 	//release index map
 	f.Lock()
 	defer f.Unlock()
 	for k, v := range f.indexMap {
-		v.Quit()
+		wg.Add(1)
+		go func(index *Index) {
+			defer wg.Done()
+			subReport, subErr := index.Quit(ctx)
+			locker.Lock()
+			defer locker.Unlock()
+			report.Merge(subReport)
+			if subErr != nil {
+				err = subErr
+			}
+		}(v)
 		delete(f.indexMap, k)
 	}
+	wg.Wait()
 
 	//gc opt
 	f.indexMap = map[string]*Index{}
 	runtime.GC()
+	return report, err
 }
 
 //get index by name
+//index name can be alias, resolved into physical name first
 func (f *Client) GetIndex(indexName string) (*Index, error) {
 	//check
 	if indexName == "" {
 		return nil, errors.New("invalid parameter")
 	}
+	indexName = f.ResolveIndexName(indexName)
+
 	//get with read locker
 	f.RLock()
 	defer f.RUnlock()
@@ -70,6 +117,14 @@ func (f *Client) GetIndex(indexName string) (*Index, error) {
 
 //create and init index
 func (f *Client) CreateIndex(indexConf *conf.IndexConf) error {
+	return f.CreateIndexWithContext(context.Background(), indexConf)
+}
+
+//create and init index with context
+//old index obj of same name quit before replaced
+func (f *Client) CreateIndexWithContext(
+	ctx context.Context,
+	indexConf *conf.IndexConf) error {
 	//check
 	if indexConf == nil ||
 		indexConf.IndexName == "" ||
@@ -77,8 +132,63 @@ func (f *Client) CreateIndex(indexConf *conf.IndexConf) error {
 		return errors.New("invalid parameter")
 	}
 
+	//copy conf, keep caller's conf untouched
+	confCopy := *indexConf
+	indexConf = &confCopy
+
+	//inherit client tag
+	if indexConf.ClientTag == "" {
+		indexConf.ClientTag = f.cfg.Tag
+	}
+
+	//inherit client host and api key
+	if indexConf.Host == "" {
+		indexConf.Host = f.cfg.Host
+	}
+	if indexConf.ApiKey == "" {
+		indexConf.ApiKey = f.cfg.ApiKey
+	}
+	if indexConf.HttpClient == nil {
+		indexConf.HttpClient = f.httpClient
+	}
+
+	//inherit client retry policy
+	if indexConf.Retry == nil {
+		indexConf.Retry = f.cfg.Retry
+	}
+
+	//inherit client queue setting
+	if indexConf.Queue == nil {
+		indexConf.Queue = f.cfg.Queue
+	}
+
+	//inherit client metrics, labeled by client tag
+	if indexConf.Metrics == nil {
+		indexConf.Metrics = lib.NewLabeledSink(f.getMetrics(), map[string]string{
+			lib.LabelClient: f.cfg.Tag,
+		})
+	}
+
+	//quit old index obj first, release workers and spool file
+	f.Lock()
+	oldIndex, ok := f.indexMap[indexConf.IndexName]
+	delete(f.indexMap, indexConf.IndexName)
+	f.Unlock()
+	if ok && oldIndex != nil {
+		report, err := oldIndex.Quit(ctx)
+		if err != nil {
+			log.Printf("client.CreateIndex, quit old index %v failed, report:%+v, err:%v\n",
+				indexConf.IndexName, report, err.Error())
+		}
+	}
+
 	//init new index obj
-	indexObj := NewIndex(f.client, indexConf, f.cfg.Workers)
+	//spool configured but not opened, quit and return error
+	indexObj := NewIndexWithContext(ctx, f.client, indexConf, f.cfg.Workers)
+	if doc := indexObj.GetDoc(); doc != nil && doc.spoolErr != nil {
+		indexObj.Quit(ctx)
+		return doc.spoolErr
+	}
 
 	//sync into map
 	f.Lock()
@@ -88,22 +198,41 @@ func (f *Client) CreateIndex(indexConf *conf.IndexConf) error {
 }
 
 //re-create and init index
-func (f *Client) ReCreateIndex(indexName string) error {
+//if fill func assigned, rebuild by shadow index without downtime
+func (f *Client) ReCreateIndex(
+	indexName string,
+	fills ...RebuildFillFunc) error {
+	return f.ReCreateIndexWithContext(context.Background(), indexName, fills...)
+}
+
+//re-create and init index with context
+func (f *Client) ReCreateIndexWithContext(
+	ctx context.Context,
+	indexName string,
+	fills ...RebuildFillFunc) error {
 	//check
 	if indexName == "" {
 		return errors.New("invalid parameter")
 	}
 
-	//get index by name with locker
-	f.Lock()
-	defer f.Unlock()
+	indexName = f.ResolveIndexName(indexName)
+
+	//get index by name with read locker
+	//locker released before rebuild, not block other indexes
+	f.RLock()
 	index, ok := f.indexMap[indexName]
+	f.RUnlock()
 	if !ok || index == nil {
 		return errors.New("no such index")
 	}
 
+	//rebuild by shadow index
+	if fills != nil && len(fills) > 0 && fills[0] != nil {
+		return index.RebuildWithContext(ctx, fills[0])
+	}
+
 	//begin recreate index
-	err := index.ReCreateIndex()
+	err := index.ReCreateIndexWithContext(ctx)
 	return err
 }
 
@@ -111,6 +240,24 @@ func (f *Client) ReCreateIndex(indexName string) error {
 //private func
 ////////////////
 
+//get task manager
+func (f *Client) Tasks() *TaskManager {
+	return f.tasks
+}
+
+//get key manager
+func (f *Client) Keys() *KeyManager {
+	return f.keys
+}
+
+//get metrics sink
+func (f *Client) getMetrics() lib.MetricsSink {
+	if f.cfg.Metrics != nil {
+		return f.cfg.Metrics
+	}
+	return lib.GetExpvarSink()
+}
+
 //inter init
 func (f *Client) interInit() {
 	var (
@@ -130,8 +277,56 @@ func (f *Client) interInit() {
 	//
 	//client := meilisearch.New(f.cfg.Host, meilisearch.WithAPIKey(f.cfg.ApiKey))
 
+	//init http client with timeout
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	f.httpClient = &http.Client{
+		Transport: transport,
+		Timeout: f.cfg.TimeOut,
+	}
+
 	//init search client
-	f.client = meilisearch.New(f.cfg.Host, meilisearch.WithAPIKey(f.cfg.ApiKey))
+	opts := []meilisearch.Option{
+		meilisearch.WithAPIKey(f.cfg.ApiKey),
+		meilisearch.WithCustomClient(f.httpClient),
+	}
+	if f.cfg.Retry != nil {
+		//use self retry policy
+		opts = append(opts, meilisearch.DisableRetries())
+	}
+	f.client = meilisearch.New(f.cfg.Host, opts...)
+
+	//init retry policy and metrics
+	f.retry = newRetryPolicy(f.cfg.Retry)
+	f.metrics = &metricsRecorder{
+		sink: lib.NewLabeledSink(f.getMetrics(), map[string]string{
+			lib.LabelClient: f.cfg.Tag,
+			lib.LabelIndex: define.MultiSearchIndexLabel,
+		}),
+	}
+
+	//init task and key manager
+	f.tasks = NewTaskManager(f.client, f.cfg.Retry)
+	f.keys = NewKeyManager(f.client, f.cfg.Retry)
+	if f.cfg.TaskRetention != nil {
+		err = f.tasks.StartRetention(f.cfg.TaskRetention)
+		if err != nil {
+			log.Printf("client.interInit, start task retention failed, err:%v\n", err.Error())
+		}
+	}
+
+	//init aliases
+	err = f.initAlias()
+	if err != nil {
+		log.Printf("client.interInit, init alias failed, err:%v\n", err.Error())
+	}
+
+	//start backup schedule
+	if f.cfg.BackupSchedule != nil {
+		err = f.StartBackupSchedule(f.cfg.BackupSchedule)
+		if err != nil {
+			log.Printf("client.interInit, start backup schedule failed, err:%v\n", err.Error())
+		}
+	}
 
 	//init indexes
 	if f.cfg.IndexesConf != nil {
@@ -2,14 +2,18 @@ package face
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/andyzhou/tinymeili/conf"
-	"strconv"
+	"log"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/filter"
 	"github.com/andyzhou/tinymeili/lib"
 	"github.com/meilisearch/meilisearch-go"
 )
@@ -23,12 +27,18 @@ import (
 //inter opt
 type (
 	syncDocReq struct {
+		ctx        context.Context
 		obj        interface{}
 		isUpdate   bool
+		future     *WriteFuture
+		spoolSeq   int64
 	}
 	removeDocReq struct {
+		ctx    context.Context
 		docIds []string
-		filter []string
+		filter interface{}
+		future *WriteFuture
+		spoolSeq int64
 	}
 )
 
@@ -38,6 +48,18 @@ type Doc struct {
 	index     meilisearch.IndexManager   //reference
 	indexConf *conf.IndexConf            //reference
 	worker    *lib.Worker
+	spool     *lib.Spool //optional
+	spoolErr  error      //spool configured but open failed, writes rejected
+	spoolCloseChan chan bool
+	spoolDoneChan  chan bool
+	httpClient *http.Client //for raw api
+	retry     *retryPolicy
+	metrics   *metricsRecorder
+	pending   pendingWrites //pending write futures
+	capture   writeCapture  //writes applied while rebuilding
+	gate      sync.RWMutex  //write gate, locked while swapping index
+	closed    int32
+	abandoned int32
 	workers   int
 }
 
@@ -53,16 +75,31 @@ func NewDoc(
 		index: index,
 		indexConf: indexConf,
 		worker: lib.NewWorker(),
+		retry: newRetryPolicy(indexConf.Retry),
+		metrics: newMetricsRecorder(indexConf),
 	}
 	this.interInit()
 	return this
 }
 
 //quit
-func (f *Doc) Quit() {
-	if f.worker != nil {
-		f.worker.Quit()
-	}
+//stop accepting writes and wait pending writes until ctx done
+//return report of flushed, failed and abandoned writes
+func (f *Doc) Quit(ctx context.Context) (*QuitReport, error) {
+	return f.drain(ctx)
+}
+
+//get write queue overflow policy
+//write opt returns lib.ErrQueueFull when queue full under
+//fail fast, block with timeout and bounded spill policy,
+//dropped write's future finished with lib.ErrQueueDropped
+func (f *Doc) GetOverflowPolicy() lib.OverflowPolicy {
+	return f.worker.GetOverflow()
+}
+
+//get queued write requests size
+func (f *Doc) GetQueueSize() int {
+	return f.worker.GetQueueSize()
 }
 
 //query batch doc one index
@@ -71,6 +108,16 @@ func (f *Doc) Quit() {
 func (f *Doc) QueryIndexDocs(
 		para *define.QueryPara,
 	) (int64, []interface{}, map[string]map[string]int64, error) {
+	return f.QueryIndexDocsWithContext(context.Background(), para)
+}
+
+//query batch doc one index with context
+//sync opt
+//return total, []docObj, facetMap, error
+func (f *Doc) QueryIndexDocsWithContext(
+		ctx context.Context,
+		para *define.QueryPara,
+	) (int64, []interface{}, map[string]map[string]int64, error) {
 	//check
 	if para == nil {
 		return 0, nil, nil, errors.New("invalid parameter")
@@ -79,62 +126,29 @@ func (f *Doc) QueryIndexDocs(
 		return 0, nil, nil, errors.New("inter index not init")
 	}
 
-	//setup offset
-	if para.Page <= 0 {
-		para.Page = define.DefaultPage
-	}
-	if para.PageSize <= 0 {
-		para.PageSize = define.DefaultPageSize
-	}
-
-	//setup search request
-	sq := &meilisearch.SearchRequest{
-		Query: para.Key,
-		AttributesToSearchOn: para.AttributesToSearch,
-		Filter: para.Filter,
-		Facets: para.Facets,
-		Sort: para.Sort,
-		Page: int64(para.Page),
-		HitsPerPage:int64(para.PageSize),
-	}
-	if para.Distinct != "" {
-		sq.Distinct = para.Distinct
-	}
-	if para.AttributesToSearch != nil && len(para.AttributesToSearch) > 0 {
-		sq.AttributesToSearchOn = para.AttributesToSearch
+	//query raw response
+	resp, err := f.searchRaw(ctx, para)
+	if err != nil {
+		return 0, nil, nil, err
 	}
 
-	//query origin doc
-	resp, subErr := f.index.Search(para.Key, sq)
-	if subErr != nil || resp == nil {
-		return 0, nil, nil, subErr
+	//decode origin docs
+	hits := make([]interface{}, 0, len(resp.Hits))
+	for _, rawHit := range resp.Hits {
+		var hit interface{}
+		err = json.Unmarshal(rawHit, &hit)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		hits = append(hits, hit)
 	}
 
 	//gather facet objs
-	facetObjs := make(map[string]map[string]int64)
-	if resp.FacetDistribution != nil {
-		facetMap, ok := resp.FacetDistribution.(map[string]interface{})
-		if ok && facetMap != nil {
-			for k, v := range facetMap {
-				if k == "" || v == nil {
-					continue
-				}
-				//sub facet objs
-				facetObj, subOk := v.(map[string]interface{})
-				if !subOk || facetObj == nil {
-					continue
-				}
-				subFacetObj := make(map[string]int64)
-				for k1, v1 := range facetObj {
-					countVal, _ := strconv.ParseInt(fmt.Sprintf("%v", v1), 10, 64)
-					subFacetObj[k1] = countVal
-				}
-				//gather one key and sub facet objs
-				facetObjs[k] = subFacetObj
-			}
-		}
+	facetObjs := resp.FacetDistribution
+	if facetObjs == nil {
+		facetObjs = make(map[string]map[string]int64)
 	}
-	return resp.TotalHits, resp.Hits, facetObjs, nil
+	return resp.TotalHits, hits, facetObjs, nil
 }
 
 //get batch doc by ids
@@ -143,6 +157,16 @@ func (f *Doc) GetBatchDocsByIds(
 		condField string,
 		docIds ...string,
 	) ([]map[string]interface{}, error) {
+	return f.GetBatchDocsByIdsWithContext(context.Background(), condField, docIds...)
+}
+
+//get batch doc by ids with context
+//field need set as filterable
+func (f *Doc) GetBatchDocsByIdsWithContext(
+		ctx context.Context,
+		condField string,
+		docIds ...string,
+	) ([]map[string]interface{}, error) {
 	//check
 	if docIds == nil || len(docIds) <= 0 {
 		return nil, errors.New("invalid parameter")
@@ -151,30 +175,31 @@ func (f *Doc) GetBatchDocsByIds(
 		return nil, errors.New("inter index not init")
 	}
 
-	//setup filter
-	filterBuff := bytes.NewBuffer(nil)
-	i := 0
+	//setup filter, ids quoted and escaped
+	ids := make([]string, 0, len(docIds))
 	for _, docId := range docIds {
 		if docId == "" {
 			continue
 		}
-		if i > 0 {
-			filterBuff.WriteString(" OR ")
-		}
-		filterBuff.WriteString(fmt.Sprintf("%v = %v", condField, docId))
-		i++
+		ids = append(ids, docId)
+	}
+	if len(ids) <= 0 {
+		return nil, errors.New("invalid parameter")
 	}
 
 	//setup doc query
 	dq := &meilisearch.DocumentsQuery{
-		Filter: []string{filterBuff.String()},
+		Filter: filter.InStrings(condField, ids...).String(),
+		Limit: int64(len(ids)),
 	}
 	resp := &meilisearch.DocumentsResult{
 		Results: []map[string]interface{}{},
 	}
 
 	//get real doc
-	err := f.index.GetDocuments(dq, resp)
+	_, err := f.retry.do(ctx, func() error {
+		return f.index.GetDocumentsWithContext(ctx, dq, resp)
+	})
 	if err != nil || resp == nil {
 		return nil, err
 	}
@@ -184,6 +209,15 @@ func (f *Doc) GetBatchDocsByIds(
 //get one doc by field condition
 //sync opt
 func (f *Doc) GetOneDocByFieldCond(
+	filters interface{},
+	out interface{}) error {
+	return f.GetOneDocByFieldCondWithContext(context.Background(), filters, out)
+}
+
+//get one doc by field condition with context
+//sync opt
+func (f *Doc) GetOneDocByFieldCondWithContext(
+	ctx context.Context,
 	filters interface{},
 	out interface{}) error {
 	//check
@@ -196,35 +230,47 @@ func (f *Doc) GetOneDocByFieldCond(
 
 	//setup search request
 	sq := &meilisearch.SearchRequest{
-		Filter: filters,
+		Filter: filter.Build(filters),
 		Offset: 0,
 		Limit: 1,
 		HitsPerPage:1,
 		//AttributesToSearchOn:[]string{matchField},
 	}
 
-	//get origin doc
-	resp, subErr := f.index.Search("", sq)
-	if subErr != nil || resp == nil ||
-		resp.Hits == nil || len(resp.Hits) <= 0 {
+	//get origin raw doc
+	var rawResp *json.RawMessage
+	_, subErr := f.retry.do(ctx, func() error {
+		var err error
+		rawResp, err = f.index.SearchRawWithContext(ctx, "", sq)
+		return err
+	})
+	if subErr != nil || rawResp == nil {
 		return subErr
 	}
-
-	//get first hit doc
-	hitDoc := resp.Hits[0]
-	recMap, ok := hitDoc.(map[string]interface{})
-	if !ok || recMap == nil {
-		return errors.New("invalid hit doc format")
+	resp := &rawSearchResp{}
+	err := json.Unmarshal(*rawResp, resp)
+	if err != nil {
+		return err
+	}
+	if resp.Hits == nil || len(resp.Hits) <= 0 {
+		return nil
 	}
 
-	//decode to out obj
-	recBytes, _ := json.Marshal(recMap)
-	err := json.Unmarshal(recBytes, out)
+	//decode first hit doc to out obj
+	err = json.Unmarshal(resp.Hits[0], out)
 	return err
 }
 
 //get one doc by id
 func (f *Doc) GetOneDocById(
+	docId string,
+	out interface{}) error {
+	return f.GetOneDocByIdWithContext(context.Background(), docId, out)
+}
+
+//get one doc by id with context
+func (f *Doc) GetOneDocByIdWithContext(
+	ctx context.Context,
 	docId string,
 	out interface{}) error {
 	//check
@@ -236,112 +282,185 @@ func (f *Doc) GetOneDocById(
 	}
 
 	//get real doc
-	err := f.index.GetDocument(docId, nil, &out)
+	begin := time.Now()
+	_, err := f.retry.do(ctx, func() error {
+		return f.index.GetDocumentWithContext(ctx, docId, nil, &out)
+	})
+	f.metrics.observeSearch(begin, err)
 	return err
 }
 
 //del one doc
 //dataId used for pick hashed son worker
+//return future for checking final result
 func (f *Doc) DelDoc(
 	dataId string,
-	docIds ...string) error {
+	docIds ...string) (*WriteFuture, error) {
+	return f.DelDocWithContext(context.Background(), dataId, docIds...)
+}
+
+//del one doc with context
+//ctx will be passed into worker queue and task waiting
+func (f *Doc) DelDocWithContext(
+	ctx context.Context,
+	dataId string,
+	docIds ...string) (*WriteFuture, error) {
 	//check
 	if docIds == nil || len(docIds) <= 0 {
-		return errors.New("invalid parameter")
+		return nil, errors.New("invalid parameter")
 	}
 	if f.index == nil {
-		return errors.New("inter index not init")
+		return nil, errors.New("inter index not init")
 	}
 
 	//init request
 	req := removeDocReq{
+		ctx: ctx,
 		docIds: docIds,
+		future: NewWriteFuture(),
 	}
 
 	//send worker queue
-	_, err := f.worker.SendData(req, dataId)
-	return err
+	err := f.sendWriteReq(ctx, req, dataId)
+	if err != nil {
+		return nil, err
+	}
+	return req.future, nil
 }
 
 //del docs by filter
-//filter like: 'a = 6 and b < 10'
+//filter like: 'a = 6 AND b < 10', []string or filter.Expr
+//return future for checking final result
 func (f *Doc) DelDocsByFilter(
-	filter []string) error {
+	filters interface{}) (*WriteFuture, error) {
+	return f.DelDocsByFilterWithContext(context.Background(), filters)
+}
+
+//del docs by filter with context
+//ctx will be passed into worker queue and task waiting
+func (f *Doc) DelDocsByFilterWithContext(
+	ctx context.Context,
+	filters interface{}) (*WriteFuture, error) {
 	//check
-	if filter == nil {
-		return errors.New("invalid parameter")
+	if filters == nil {
+		return nil, errors.New("invalid parameter")
 	}
 	if f.index == nil {
-		return errors.New("inter index not init")
+		return nil, errors.New("inter index not init")
 	}
 
 	//init request
 	req := removeDocReq{
-		filter: filter,
+		ctx: ctx,
+		filter: filter.Build(filters),
+		future: NewWriteFuture(),
 	}
 
 	//send worker queue
-	_, err := f.worker.SendData(req, "")
-	return err
+	err := f.sendWriteReq(ctx, req, "")
+	if err != nil {
+		return nil, err
+	}
+	return req.future, nil
 }
 
 //update one doc
-//dataIds used for pick hashed son worker
+//dataIds used for pick hashed son worker,
+//primary key value of doc used if not assigned
+//return future for checking final result
 func (f *Doc) UpdateDoc(
 	docObj interface{},
-	dataIds ...string) error {
+	dataIds ...string) (*WriteFuture, error) {
+	return f.UpdateDocWithContext(context.Background(), docObj, dataIds...)
+}
+
+//update one doc with context
+//ctx will be passed into worker queue and task waiting
+func (f *Doc) UpdateDocWithContext(
+	ctx context.Context,
+	docObj interface{},
+	dataIds ...string) (*WriteFuture, error) {
 	var (
 		dataId string
 	)
 	//check
 	if docObj == nil {
-		return errors.New("invalid parameter")
+		return nil, errors.New("invalid parameter")
 	}
 	if f.index == nil {
-		return errors.New("inter index not init")
+		return nil, errors.New("inter index not init")
 	}
 	if dataIds != nil && len(dataIds) > 0 {
 		dataId = dataIds[0]
 	}
+	if dataId == "" {
+		//routed by primary key, keep writes of one doc in order
+		dataId = f.genDataId(docObj)
+	}
 
 	//init request
 	req := syncDocReq{
+		ctx: ctx,
 		obj: docObj,
 		isUpdate: true,
+		future: NewWriteFuture(),
 	}
 
 	//send worker queue
-	_, err := f.worker.SendData(req, dataId)
-	return err
+	err := f.sendWriteReq(ctx, req, dataId)
+	if err != nil {
+		return nil, err
+	}
+	return req.future, nil
 }
 
 //add one or batch doc
-//dataIds used for pick hashed son worker
+//dataIds used for pick hashed son worker,
+//primary key value of doc used if not assigned
+//return future for checking final result
 func (f *Doc) AddDoc(
 	docObj interface{},
-	dataIds ...string) error {
+	dataIds ...string) (*WriteFuture, error) {
+	return f.AddDocWithContext(context.Background(), docObj, dataIds...)
+}
+
+//add one or batch doc with context
+//ctx will be passed into worker queue and task waiting
+func (f *Doc) AddDocWithContext(
+	ctx context.Context,
+	docObj interface{},
+	dataIds ...string) (*WriteFuture, error) {
 	var (
 		dataId string
 	)
 	//check
 	if docObj == nil {
-		return errors.New("invalid parameter")
+		return nil, errors.New("invalid parameter")
 	}
 	if f.index == nil {
-		return errors.New("inter index not init")
+		return nil, errors.New("inter index not init")
 	}
 	if dataIds != nil && len(dataIds) > 0 {
 		dataId = dataIds[0]
 	}
+	if dataId == "" {
+		//routed by primary key, keep writes of one doc in order
+		dataId = f.genDataId(docObj)
+	}
 
 	//init request
 	req := syncDocReq{
+		ctx: ctx,
 		obj: docObj,
+		future: NewWriteFuture(),
 	}
 
 	//send worker queue
-	_, err := f.worker.SendData(req, dataId)
-	return err
+	err := f.sendWriteReq(ctx, req, dataId)
+	if err != nil {
+		return nil, err
+	}
+	return req.future, nil
 }
 
 /////////////////
@@ -349,88 +468,91 @@ func (f *Doc) AddDoc(
 /////////////////
 
 //remove doc
-func (f *Doc) removeDocObj(req *removeDocReq) error {
-	var (
-		resp *meilisearch.TaskInfo
-		err error
-	)
+//return origin task info, final task, attempts and error
+func (f *Doc) removeDocObj(
+	req *removeDocReq) (*meilisearch.TaskInfo, *meilisearch.Task, int, error) {
 	//check
 	if req == nil {
-		return errors.New("invalid parameter")
+		return nil, nil, 0, errors.New("invalid parameter")
 	}
 	if f.index == nil {
-		return errors.New("inter index not init")
+		return nil, nil, 0, errors.New("inter index not init")
 	}
 
-	//remove real doc
-	if req.filter != nil {
-		//remove by filter
-		resp, err = f.index.DeleteDocumentsByFilter(req.filter)
-	}else{
-		//remove by ids
-		resp, err = f.index.DeleteDocuments(req.docIds)
-	}
-	if err != nil {
-		return err
-	}
-	if resp == nil {
-		return errors.New("no any response from meili search")
+	//check context
+	ctx := f.getReqContext(req.ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, 0, err
 	}
 
-	//wait for task status
-	finalTask, subErr := f.client.WaitForTask(resp.TaskUID, f.getTimeout())
-	if subErr != nil {
-		return subErr
-	}
-	if finalTask.Status != "succeeded" {
-		return fmt.Errorf(finalTask.Error.Code)
-	}
-	return nil
+	//pass write gate, blocked while swapping index
+	f.gate.RLock()
+	defer f.gate.RUnlock()
+
+	//remove real doc with retry
+	begin := time.Now()
+	resp, finalTask, attempts, err := f.retry.runTask(ctx, f.client, f.getTimeout(),
+		func() (*meilisearch.TaskInfo, error) {
+			if req.filter != nil {
+				//remove by filter
+				return f.index.DeleteDocumentsByFilterWithContext(ctx, req.filter)
+			}
+			//remove by ids
+			return f.index.DeleteDocumentsWithContext(ctx, req.docIds)
+		})
+	f.metrics.observeTask(begin, finalTask, err)
+	if err == nil {
+		f.captureRemove(req)
+	}
+	return resp, finalTask, attempts, err
 }
 
 //add or update doc
-func (f *Doc) syncDocObj(req *syncDocReq) (*meilisearch.TaskInfo, error) {
-	var (
-		resp *meilisearch.TaskInfo
-		err error
-	)
+//return origin task info, final task, attempts and error
+func (f *Doc) syncDocObj(
+	req *syncDocReq) (*meilisearch.TaskInfo, *meilisearch.Task, int, error) {
 	//check
 	if req == nil || req.obj == nil {
-		return nil, errors.New("invalid parameter")
+		return nil, nil, 0, errors.New("invalid parameter")
 	}
 	if f.index == nil {
-		return nil, errors.New("inter index not init")
+		return nil, nil, 0, errors.New("inter index not init")
 	}
 
-	//add real doc
-	if req.isUpdate {
-		resp, err = f.index.UpdateDocuments(req.obj, f.indexConf.PrimaryKey)
-	}else{
-		resp, err = f.index.AddDocuments(req.obj, f.indexConf.PrimaryKey)
-	}
-	if err != nil {
-		return nil, err
-	}
-	if resp == nil {
-		return nil, errors.New("no any response from meili search")
+	//check context
+	ctx := f.getReqContext(req.ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, 0, err
 	}
 
-	//wait for task status
-	finalTask, subErr := f.client.WaitForTask(resp.TaskUID, f.getTimeout())
-	if subErr != nil {
-		return nil, subErr
+	//pass write gate, blocked while swapping index
+	f.gate.RLock()
+	defer f.gate.RUnlock()
+
+	//add real doc with retry
+	//sdk index saves primary key of each write, use own index obj for concurrent writes
+	index := f.index
+	if f.client != nil {
+		index = f.client.Index(f.indexConf.IndexName)
 	}
-	if finalTask.Status != "succeeded" {
-		return nil, fmt.Errorf(finalTask.Error.Code)
+	begin := time.Now()
+	f.metrics.observeBatch(req.obj)
+	resp, finalTask, attempts, err := f.retry.runTask(ctx, f.client, f.getTimeout(),
+		func() (*meilisearch.TaskInfo, error) {
+			if req.isUpdate {
+				return index.UpdateDocumentsWithContext(ctx, req.obj, f.indexConf.PrimaryKey)
+			}
+			return index.AddDocumentsWithContext(ctx, req.obj, f.indexConf.PrimaryKey)
+		})
+	f.metrics.observeTask(begin, finalTask, err)
+	if err == nil {
+		f.captureSync(req)
 	}
-	return resp, err
+	return resp, finalTask, attempts, err
 }
 
 //cb for worker opt
 func (f *Doc) cbForWorkerOpt(input interface{}) (interface{}, error) {
-	var (
-		err error
-	)
 	//check
 	if input == nil {
 		return nil, errors.New("invalid parameter")
@@ -445,8 +567,13 @@ func (f *Doc) cbForWorkerOpt(input interface{}) (interface{}, error) {
 			if !ok || &req == nil {
 				return nil, errors.New("invalid data type")
 			}
-			_, err = f.syncDocObj(&req)
-			return nil, err
+			if err := f.checkAbandoned(); err != nil {
+				f.finishWriteReq(req.future, req.spoolSeq, nil, nil, 0, err)
+				return nil, err
+			}
+			taskInfo, task, attempts, err := f.syncDocObj(&req)
+			f.finishWriteReq(req.future, req.spoolSeq, taskInfo, task, attempts, err)
+			return taskInfo, err
 		}
 	case removeDocReq:
 		{
@@ -455,8 +582,13 @@ func (f *Doc) cbForWorkerOpt(input interface{}) (interface{}, error) {
 			if !ok || &req == nil {
 				return nil, errors.New("invalid data type")
 			}
-			err = f.removeDocObj(&req)
-			return nil, err
+			if err := f.checkAbandoned(); err != nil {
+				f.finishWriteReq(req.future, req.spoolSeq, nil, nil, 0, err)
+				return nil, err
+			}
+			taskInfo, task, attempts, err := f.removeDocObj(&req)
+			f.finishWriteReq(req.future, req.spoolSeq, taskInfo, task, attempts, err)
+			return taskInfo, err
 		}
 	default:
 		{
@@ -465,6 +597,44 @@ func (f *Doc) cbForWorkerOpt(input interface{}) (interface{}, error) {
 	}
 }
 
+//cb for worker dropped data
+//finish dropped write request with lib.ErrQueueDropped
+func (f *Doc) cbForWorkerDrop(input interface{}) {
+	switch req := input.(type) {
+	case syncDocReq:
+		f.finishWriteReq(req.future, req.spoolSeq, nil, nil, 0, lib.ErrQueueDropped)
+	case removeDocReq:
+		f.finishWriteReq(req.future, req.spoolSeq, nil, nil, 0, lib.ErrQueueDropped)
+	}
+}
+
+//gen data id by primary key value of doc
+//batch docs routed by first doc, empty if primary key not found
+func (f *Doc) genDataId(docObj interface{}) string {
+	docs, _, err := f.encodeDocs(docObj)
+	if err != nil || len(docs) <= 0 {
+		return ""
+	}
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(docs[0], &fields) != nil {
+		return ""
+	}
+	id, ok := fields[f.indexConf.PrimaryKey]
+	if !ok {
+		return ""
+	}
+	//meili treats string and integer id as same
+	return string(bytes.Trim(id, `"`))
+}
+
+//get request context
+func (f *Doc) getReqContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
 //get timeout
 func (f *Doc) getTimeout() time.Duration {
 	timeout := f.indexConf.Timeout
@@ -481,7 +651,38 @@ func (f *Doc) interInit() {
 		f.workers = lib.DefaultWorkers
 	}
 
+	//setup queue size and overflow policy
+	if f.indexConf.Queue != nil {
+		queueConf := f.indexConf.Queue
+		f.worker.SetQueueSize(queueConf.QueueSize)
+		f.worker.SetOverflow(queueConf.Overflow, queueConf.BlockTimeout, queueConf.SpillSize)
+	}
+	f.worker.SetCBForDropOpt(f.cbForWorkerDrop)
+	f.worker.SetMetrics(f.metrics.getSink())
+
 	//init workers
 	f.worker.SetCBForQueueOpt(f.cbForWorkerOpt)
+	if f.batchEnabled() {
+		//coalesce queued writes into batch
+		f.worker.SetCBForBatchQueueOpt(f.cbForWorkerBatchOpt, f.indexConf.BatchMaxDocs, f.getBatchLinger())
+	}
 	f.worker.CreateWorkers(f.workers)
+
+	//http client of raw api, use client's if assigned
+	f.httpClient = f.indexConf.HttpClient
+	if f.httpClient == nil {
+		f.httpClient = &http.Client{
+			Timeout: time.Duration(define.DefaultTimeOut) * time.Second,
+		}
+	}
+
+	//open spool and replay left records
+	//writes rejected if spool configured but not opened
+	err := f.openSpool()
+	if err != nil && f.spool == nil {
+		f.spoolErr = fmt.Errorf("open spool failed, err:%w", err)
+		log.Printf("doc.interInit, %v\n", f.spoolErr.Error())
+	}else if err != nil {
+		log.Printf("doc.interInit, replay spool failed, err:%v\n", err.Error())
+	}
 }
\ No newline at end of file
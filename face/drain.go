@@ -0,0 +1,182 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * doc write drain face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - track pending write futures
+ * - flush barrier and graceful quit with deadline
+ */
+
+//drain errors
+var (
+	ErrDocClosed      = errors.New("doc is closed")
+	ErrWriteAbandoned = errors.New("write abandoned by quit")
+)
+
+//quit report
+type QuitReport struct {
+	Flushed   int //writes applied before deadline
+	Failed    int //writes finished with error before deadline
+	Abandoned int //writes not finished before deadline
+}
+
+//inter type
+type (
+	pendingWrites struct {
+		futures map[*WriteFuture]struct{}
+		closed  bool //no more futures accepted
+		sync.Mutex
+	}
+)
+
+//merge other report
+func (r *QuitReport) Merge(other *QuitReport) {
+	if other == nil {
+		return
+	}
+	r.Flushed += other.Flushed
+	r.Failed += other.Failed
+	r.Abandoned += other.Abandoned
+}
+
+//flush barrier
+//wait until all writes enqueued before this call finished
+//return ctx error if not finished before ctx done
+func (f *Doc) Flush(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	futures := f.pending.snapshot()
+	for _, future := range futures {
+		select {
+		case <- future.Done():
+		case <- ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+//check doc is closed or not
+func (f *Doc) IsClosed() bool {
+	return atomic.LoadInt32(&f.closed) > 0
+}
+
+/////////////////
+//private func
+/////////////////
+
+//drain and quit
+//stop accepting writes, wait pending writes until ctx done
+func (f *Doc) drain(ctx context.Context) (*QuitReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	report := &QuitReport{}
+
+	//stop accepting new writes
+	if !atomic.CompareAndSwapInt32(&f.closed, 0, 1) {
+		return report, nil
+	}
+	f.stopSpoolReplay()
+
+	//wait pending writes
+	//pending closed with snapshot in one lock,
+	//write added later rejected and not missed by report
+	futures := f.pending.close()
+	flushErr := f.Flush(ctx)
+	if flushErr != nil {
+		//skip left queued writes
+		atomic.StoreInt32(&f.abandoned, 1)
+	}
+
+	//quit workers, left queued writes finished directly
+	quitErr := f.worker.QuitWithContext(ctx)
+	if f.spool != nil {
+		f.spool.Close()
+	}
+
+	//gen report
+	for _, future := range futures {
+		if !future.IsDone() ||
+			errors.Is(future.Err(), ErrWriteAbandoned) {
+			report.Abandoned++
+		}else if future.Err() != nil {
+			report.Failed++
+		}else{
+			report.Flushed++
+		}
+	}
+	if flushErr != nil {
+		return report, flushErr
+	}
+	return report, quitErr
+}
+
+//check left writes should be abandoned
+func (f *Doc) checkAbandoned() error {
+	if atomic.LoadInt32(&f.abandoned) > 0 {
+		return ErrWriteAbandoned
+	}
+	return nil
+}
+
+//add pending future
+//return false if pending closed
+func (p *pendingWrites) add(future *WriteFuture) bool {
+	if future == nil {
+		return true
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return false
+	}
+	if p.futures == nil {
+		p.futures = map[*WriteFuture]struct{}{}
+	}
+	p.futures[future] = struct{}{}
+	return true
+}
+
+//remove pending future
+func (p *pendingWrites) remove(future *WriteFuture) {
+	if future == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	delete(p.futures, future)
+}
+
+//close pending, return snapshot of pending futures
+func (p *pendingWrites) close() []*WriteFuture {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	return p.genSnapshot()
+}
+
+//snapshot pending futures
+func (p *pendingWrites) snapshot() []*WriteFuture {
+	p.Lock()
+	defer p.Unlock()
+	return p.genSnapshot()
+}
+
+//gen snapshot, locker should be held
+func (p *pendingWrites) genSnapshot() []*WriteFuture {
+	futures := make([]*WriteFuture, 0, len(p.futures))
+	for future := range p.futures {
+		futures = append(futures, future)
+	}
+	return futures
+}
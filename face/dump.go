@@ -0,0 +1,213 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * dump and snapshot face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - create dump or snapshot and wait task finished
+ * - scheduler for periodic backup, keep last successful one
+ */
+
+//backup kind
+const (
+	BackupKindDump     = "dump"
+	BackupKindSnapshot = "snapshot"
+)
+
+//inter type
+type (
+	//backup result
+	BackupResult struct {
+		Kind       string
+		TaskUID    int64
+		DumpUid    string //dump only
+		EnqueuedAt time.Time
+		StartedAt  time.Time
+		FinishedAt time.Time
+		Duration   time.Duration //processing time of meili
+	}
+
+	//backup schedule status
+	BackupStatus struct {
+		LastRunAt           time.Time
+		LastErr             error
+		LastSuccess         *BackupResult //nil if never succeeded
+		ConsecutiveFailures int
+	}
+)
+
+//create dump and wait until finished
+func (f *Client) CreateDump(ctx context.Context) (*BackupResult, error) {
+	return f.runBackup(ctx, BackupKindDump, func() (*meilisearch.TaskInfo, error) {
+		return f.client.CreateDumpWithContext(ctx)
+	})
+}
+
+//create snapshot and wait until finished
+func (f *Client) CreateSnapshot(ctx context.Context) (*BackupResult, error) {
+	return f.runBackup(ctx, BackupKindSnapshot, func() (*meilisearch.TaskInfo, error) {
+		return f.client.CreateSnapshotWithContext(ctx)
+	})
+}
+
+//start backup scheduler
+func (f *Client) StartBackupSchedule(cfg *conf.BackupScheduleConf) error {
+	//check
+	if cfg == nil || cfg.Interval <= 0 {
+		return errors.New("invalid parameter")
+	}
+	f.backupLocker.Lock()
+	defer f.backupLocker.Unlock()
+	if f.backupCloseChan != nil {
+		return errors.New("backup schedule already started")
+	}
+	f.backupCloseChan = make(chan bool, 1)
+	go f.runBackupSchedule(cfg, f.backupCloseChan)
+	return nil
+}
+
+//stop backup scheduler
+func (f *Client) StopBackupSchedule() {
+	f.backupLocker.Lock()
+	defer f.backupLocker.Unlock()
+	if f.backupCloseChan == nil {
+		return
+	}
+	close(f.backupCloseChan)
+	f.backupCloseChan = nil
+}
+
+//get backup schedule status
+func (f *Client) GetBackupStatus() BackupStatus {
+	f.backupLocker.RLock()
+	defer f.backupLocker.RUnlock()
+	return f.backupStatus
+}
+
+/////////////////
+//private func
+/////////////////
+
+//submit backup task and wait until finished
+func (f *Client) runBackup(
+	ctx context.Context,
+	kind string,
+	submit func() (*meilisearch.TaskInfo, error)) (*BackupResult, error) {
+	var (
+		taskInfo *meilisearch.TaskInfo
+	)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//submit task with retry
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		taskInfo, subErr = submit()
+		if subErr == nil && taskInfo == nil {
+			subErr = errors.New("no any response from meili search")
+		}
+		return subErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//wait task, backup may take long time
+	interval := time.Duration(define.DefaultBackupTaskInterval) * time.Millisecond
+	task, err := waitForTask(ctx, f.client, taskInfo.TaskUID, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	//gen result
+	result := &BackupResult{
+		Kind: kind,
+		TaskUID: task.UID,
+		DumpUid: task.Details.DumpUid,
+		EnqueuedAt: task.EnqueuedAt,
+		StartedAt: task.StartedAt,
+		FinishedAt: task.FinishedAt,
+	}
+	if !task.StartedAt.IsZero() && task.FinishedAt.After(task.StartedAt) {
+		result.Duration = task.FinishedAt.Sub(task.StartedAt)
+	}
+	return result, nil
+}
+
+//run backup schedule
+//each run recovered from panic, schedule kept until stopped
+func (f *Client) runBackupSchedule(
+	cfg *conf.BackupScheduleConf,
+	closeChan chan bool) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <- ticker.C:
+			f.runScheduledBackup(cfg)
+		case <- closeChan:
+			return
+		}
+	}
+}
+
+//run one scheduled backup and update status
+func (f *Client) runScheduledBackup(cfg *conf.BackupScheduleConf) {
+	//create backup
+	result, err := f.createScheduledBackup(cfg)
+	if err != nil {
+		log.Printf("client.runScheduledBackup, backup failed, err:%v\n", err.Error())
+	}
+
+	//update status
+	f.backupLocker.Lock()
+	defer f.backupLocker.Unlock()
+	f.backupStatus.LastRunAt = time.Now()
+	f.backupStatus.LastErr = err
+	if err != nil {
+		f.backupStatus.ConsecutiveFailures++
+		return
+	}
+	f.backupStatus.LastSuccess = result
+	f.backupStatus.ConsecutiveFailures = 0
+}
+
+//create one scheduled backup
+//panic recovered into error, counted as failed run
+func (f *Client) createScheduledBackup(
+	cfg *conf.BackupScheduleConf) (result *BackupResult, err error) {
+	var (
+		m any = nil
+	)
+	//defer
+	defer func() {
+		if subErr := recover(); subErr != m {
+			result = nil
+			err = fmt.Errorf("backup panic, err:%v", subErr)
+		}
+	}()
+
+	ctx := context.Background()
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	if cfg.Snapshot {
+		return f.CreateSnapshot(ctx)
+	}
+	return f.CreateDump(ctx)
+}
@@ -1,6 +1,7 @@
 package face
 
 import (
+	"context"
 	"errors"
 	"github.com/andyzhou/tinymeili/conf"
 	"sync"
@@ -42,34 +43,63 @@ func NewInterFace() *InterFace {
 }
 
 //quit
-func (f *InterFace) Quit() {
+//drain all clients concurrently until ctx done
+func (f *InterFace) Quit(ctx context.Context) (*QuitReport, error) {
+	var (
+		wg sync.WaitGroup
+		locker sync.Mutex
+		err error
+	)
+	report := &QuitReport{}
 	f.Lock()
 	defer f.Unlock()
 	for tag, client := range f.clientMap {
-		client.Quit()
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			subReport, subErr := c.Quit(ctx)
+			locker.Lock()
+			defer locker.Unlock()
+			report.Merge(subReport)
+			if subErr != nil {
+				err = subErr
+			}
+		}(client)
 		delete(f.clientMap, tag)
 	}
+	wg.Wait()
+	return report, err
 }
 
 //remove client by tag
 func (f *InterFace) RemoveClient(tag string) error {
+	_, err := f.RemoveClientWithContext(context.Background(), tag)
+	return err
+}
+
+//remove client by tag with context
+//pending writes of client drained until ctx done
+func (f *InterFace) RemoveClientWithContext(
+	ctx context.Context,
+	tag string) (*QuitReport, error) {
 	//check
 	if tag == "" {
-		return errors.New("invalid parameter")
+		return nil, errors.New("invalid parameter")
 	}
 
-	//get and quit client
+	//get client
 	client, err := f.GetClient(tag)
 	if err != nil || client == nil {
-		return err
+		return nil, err
 	}
-	client.Quit()
 
 	//remove with locker
 	f.Lock()
-	defer f.Unlock()
 	delete(f.clientMap, tag)
-	return nil
+	f.Unlock()
+
+	//quit client
+	return client.Quit(ctx)
 }
 
 //get all clients
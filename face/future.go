@@ -0,0 +1,232 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * async write future face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - returned by queued add/update/del doc opt
+ * - finished by son worker after meili task done
+ */
+
+//inter type
+type (
+	//failed or canceled meili task
+	TaskError struct {
+		TaskUID int64
+		Status  meilisearch.TaskStatus
+		Code    string
+		Message string
+		Type    string
+	}
+)
+
+//face info
+type WriteFuture struct {
+	taskInfo *meilisearch.TaskInfo //origin task info from meili
+	task     *meilisearch.Task     //final task after waiting
+	attempts int                   //total attempts of meili calls
+	err      error
+	done     bool
+	doneChan chan struct{}
+	cbForDone []func(*WriteFuture)
+	sync.RWMutex
+}
+
+//construct
+func NewWriteFuture() *WriteFuture {
+	this := &WriteFuture{
+		doneChan: make(chan struct{}),
+		cbForDone: []func(*WriteFuture){},
+	}
+	return this
+}
+
+//get done chan, non-blocking check
+func (f *WriteFuture) Done() <-chan struct{} {
+	return f.doneChan
+}
+
+//check is finished or not
+func (f *WriteFuture) IsDone() bool {
+	f.RLock()
+	defer f.RUnlock()
+	return f.done
+}
+
+//wait until write finished or ctx done
+func (f *WriteFuture) Wait(ctx context.Context) error {
+	//check
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//wait for done or ctx signal
+	select {
+	case <- f.doneChan:
+		return f.Err()
+	case <- ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//set callback for done
+//if already done, call it at once
+func (f *WriteFuture) OnDone(cb func(*WriteFuture)) bool {
+	//check
+	if cb == nil {
+		return false
+	}
+
+	//append or run cb with locker
+	f.Lock()
+	if !f.done {
+		f.cbForDone = append(f.cbForDone, cb)
+		f.Unlock()
+		return true
+	}
+	f.Unlock()
+	cb(f)
+	return true
+}
+
+//get origin task info
+func (f *WriteFuture) TaskInfo() *meilisearch.TaskInfo {
+	f.RLock()
+	defer f.RUnlock()
+	return f.taskInfo
+}
+
+//get final task
+func (f *WriteFuture) Task() *meilisearch.Task {
+	f.RLock()
+	defer f.RUnlock()
+	return f.task
+}
+
+//get final task status
+func (f *WriteFuture) Status() meilisearch.TaskStatus {
+	f.RLock()
+	defer f.RUnlock()
+	if f.task != nil {
+		return f.task.Status
+	}
+	if f.taskInfo != nil {
+		return f.taskInfo.Status
+	}
+	return meilisearch.TaskStatusUnknown
+}
+
+//get total attempts of meili calls
+func (f *WriteFuture) Attempts() int {
+	f.RLock()
+	defer f.RUnlock()
+	return f.attempts
+}
+
+//get error
+func (f *WriteFuture) Err() error {
+	f.RLock()
+	defer f.RUnlock()
+	return f.err
+}
+
+//get error message of task error
+func (e *TaskError) Error() string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return string(e.Status)
+}
+
+/////////////////
+//private func
+/////////////////
+
+//finish future, only first call works
+func (f *WriteFuture) finish(
+	taskInfo *meilisearch.TaskInfo,
+	task *meilisearch.Task,
+	attempts int,
+	err error) bool {
+	//update with locker
+	f.Lock()
+	if f.done {
+		f.Unlock()
+		return false
+	}
+	f.taskInfo = taskInfo
+	f.task = task
+	f.attempts = attempts
+	f.err = err
+	f.done = true
+	cbs := f.cbForDone
+	f.cbForDone = nil
+	close(f.doneChan)
+	f.Unlock()
+
+	//run callbacks
+	for _, cb := range cbs {
+		cb(f)
+	}
+	return true
+}
+
+//wait for task done and check final status
+func waitForTask(
+	ctx context.Context,
+	client meilisearch.ServiceManager,
+	taskUID int64,
+	interval time.Duration) (*meilisearch.Task, error) {
+	//check
+	if client == nil {
+		return nil, errors.New("inter client not init")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//wait for task
+	finalTask, err := client.WaitForTaskWithContext(ctx, taskUID, interval)
+	if err != nil {
+		return nil, err
+	}
+	return finalTask, checkTaskStatus(finalTask)
+}
+
+//check error is task error with assigned code
+func isTaskErrorCode(err error, code string) bool {
+	var (
+		taskErr *TaskError
+	)
+	if errors.As(err, &taskErr) {
+		return taskErr.Code == code
+	}
+	return false
+}
+
+//check task final status
+func checkTaskStatus(task *meilisearch.Task) error {
+	//check
+	if task == nil {
+		return errors.New("no any task from meili search")
+	}
+	if task.Status != meilisearch.TaskStatusSucceeded {
+		return &TaskError{
+			TaskUID: task.UID,
+			Status: task.Status,
+			Code: task.Error.Code,
+			Message: task.Error.Message,
+			Type: task.Error.Type,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package face
+
+import (
+	"encoding/json"
+)
+
+/*
+ * highlighted search hit
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - origin doc, `_formatted` and `_matchesPosition` of one hit
+ * - used as type parameter, like Search[SearchHit[T]](doc, para)
+ */
+
+//inter type
+type (
+	//match position of one field
+	MatchPosition struct {
+		Start   int   `json:"start"`
+		Length  int   `json:"length"`
+		Indices []int `json:"indices,omitempty"` //for array field
+	}
+
+	//search hit with formatted data
+	SearchHit[T any] struct {
+		Doc             T                          //origin doc
+		Formatted       map[string]json.RawMessage //field -> highlighted or cropped value
+		MatchesPosition map[string][]MatchPosition //field -> positions
+	}
+
+	//meta fields of raw hit
+	rawHitMeta struct {
+		Formatted       map[string]json.RawMessage `json:"_formatted"`
+		MatchesPosition map[string][]MatchPosition `json:"_matchesPosition"`
+	}
+)
+
+//decode raw hit
+func (h *SearchHit[T]) UnmarshalJSON(data []byte) error {
+	//decode origin doc
+	err := json.Unmarshal(data, &h.Doc)
+	if err != nil {
+		return err
+	}
+
+	//decode formatted meta
+	meta := rawHitMeta{}
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return err
+	}
+	h.Formatted = meta.Formatted
+	h.MatchesPosition = meta.MatchesPosition
+	if h.Formatted == nil {
+		h.Formatted = map[string]json.RawMessage{}
+	}
+	if h.MatchesPosition == nil {
+		h.MatchesPosition = map[string][]MatchPosition{}
+	}
+	return nil
+}
+
+//get formatted string value of field
+//return empty if field not formatted or not string
+func (h *SearchHit[T]) GetFormatted(field string) string {
+	var (
+		val string
+	)
+	raw, ok := h.Formatted[field]
+	if !ok {
+		return ""
+	}
+	json.Unmarshal(raw, &val)
+	return val
+}
+
+//map formatted data onto typed doc
+//only string and string array fields of origin doc are replaced,
+//meili formats numbers as strings, so other fields keep origin values.
+//fields kept as raw json, big int64 values not lost by float64
+func (h *SearchHit[T]) FormattedDoc() (T, error) {
+	var (
+		result T
+	)
+	//convert origin doc into raw map
+	docBytes, err := json.Marshal(h.Doc)
+	if err != nil {
+		return result, err
+	}
+	docMap := map[string]json.RawMessage{}
+	err = json.Unmarshal(docBytes, &docMap)
+	if err != nil {
+		return result, err
+	}
+
+	//overlay formatted text fields
+	for field, raw := range h.Formatted {
+		var origin, val interface{}
+		if json.Unmarshal(docMap[field], &origin) != nil {
+			continue
+		}
+		switch origin.(type) {
+		case string, []interface{}:
+			{
+				if json.Unmarshal(raw, &val) == nil && isTextValue(val) {
+					docMap[field] = raw
+				}
+			}
+		}
+	}
+
+	//decode into typed doc
+	docBytes, err = json.Marshal(docMap)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(docBytes, &result)
+	return result, err
+}
+
+//decode formatted data into out
+func (h *SearchHit[T]) FormattedAs(out interface{}) error {
+	formattedBytes, err := json.Marshal(h.Formatted)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(formattedBytes, out)
+}
+
+/////////////////
+//private func
+/////////////////
+
+//check value is string or string array
+func isTextValue(val interface{}) bool {
+	switch v := val.(type) {
+	case string:
+		return true
+	case []interface{}:
+		for _, sub := range v {
+			if _, ok := sub.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
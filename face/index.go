@@ -1,9 +1,11 @@
 package face
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/andyzhou/tinymeili/conf"
@@ -16,17 +18,35 @@ import (
  * @mail <diudiu8848@163.com>
  */
 
+//index errors
+var (
+	ErrIndexRebuilding = errors.New("index is rebuilding")
+)
+
 //face info
 type Index struct {
 	indexConf *conf.IndexConf
 	client    meilisearch.ServiceManager //reference
 	index     meilisearch.IndexManager
-	doc       *Doc
+	doc       atomic.Pointer[Doc] //replaced by re-create
+	retry     *retryPolicy
+	metrics   *metricsRecorder
 	workers   int
+	rebuilding int32 //rebuild or re-create in progress
 }
 
 //construct
 func NewIndex(
+	client meilisearch.ServiceManager,
+	indexConf *conf.IndexConf,
+	workers int) *Index {
+	return NewIndexWithContext(context.Background(), client, indexConf, workers)
+}
+
+//construct with context
+//ctx used for index creating and fields updating
+func NewIndexWithContext(
+	ctx context.Context,
 	client meilisearch.ServiceManager,
 	indexConf *conf.IndexConf,
 	workers int) *Index {
@@ -34,136 +54,189 @@ func NewIndex(
 		client: client,
 		indexConf: indexConf,
 		workers: workers,
+		retry: newRetryPolicy(indexConf.Retry),
+		metrics: newMetricsRecorder(indexConf),
 	}
-	this.interInit()
+	this.interInit(ctx)
 	return this
 }
 
 //quit
-func (f *Index) Quit() {
-	f.doc.Quit()
+//stop accepting writes and wait pending writes until ctx done
+func (f *Index) Quit(ctx context.Context) (*QuitReport, error) {
+	doc := f.doc.Load()
+	if doc == nil {
+		return &QuitReport{}, nil
+	}
+	return doc.Quit(ctx)
 }
 
 //get doc face
 func (f *Index) GetDoc() *Doc {
-	return f.doc
+	return f.doc.Load()
+}
+
+//get index config
+func (f *Index) GetConf() *conf.IndexConf {
+	return f.indexConf
 }
 
 //get status info
 func (f *Index) GetStatus() (*meilisearch.StatsIndex, error) {
-	return f.index.GetStats()
+	return f.GetStatusWithContext(context.Background())
+}
+
+//get status info with context
+func (f *Index) GetStatusWithContext(
+	ctx context.Context) (*meilisearch.StatsIndex, error) {
+	return f.index.GetStatsWithContext(ctx)
 }
 
 //update filterable fields
 func (f *Index) UpdateFilterableAttributes(fields []string) error {
+	return f.UpdateFilterableAttributesWithContext(context.Background(), fields)
+}
+
+//update filterable fields with context
+func (f *Index) UpdateFilterableAttributesWithContext(
+	ctx context.Context,
+	fields []string) error {
 	//check
 	if fields == nil || len(fields) <= 0 {
 		return errors.New("invalid parameter")
 	}
 
-	//reset filterable fields
-	task, err := f.index.ResetFilterableAttributes()
-	if err != nil {
-		return err
-	}
-	//wait for task
-	finalTask, _ := f.client.WaitForTask(task.TaskUID, f.getTimeout())
-	if finalTask.Status != "succeeded" {
-		return fmt.Errorf(finalTask.Error.Code)
-	}
-
-	//update filterable fields
-	task, err = f.index.UpdateFilterableAttributes(&fields)
-	if err != nil {
-		return err
-	}
-
-	//wait for task
-	finalTask, _ = f.client.WaitForTask(task.TaskUID, f.getTimeout())
-	if finalTask.Status != "succeeded" {
-		return fmt.Errorf(finalTask.Error.Code)
-	}
-	return nil
+	//update filterable fields, replaced in one task
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateFilterableAttributesWithContext(ctx, &fields)
+	})
+	return err
 }
 
 //update sortable fields
 func (f *Index) UpdateSortableFields(fields []string) error {
+	return f.UpdateSortableFieldsWithContext(context.Background(), fields)
+}
+
+//update sortable fields with context
+func (f *Index) UpdateSortableFieldsWithContext(
+	ctx context.Context,
+	fields []string) error {
 	//check
 	if fields == nil || len(fields) <= 0 {
 		return errors.New("invalid parameter")
 	}
 
 	//update sortable fields
-	task, err := f.index.UpdateSortableAttributes(&fields)
-	if err != nil {
-		return err
-	}
-
-	//wait for task
-	finalTask, _ := f.client.WaitForTask(task.TaskUID, f.getTimeout())
-	if finalTask.Status != "succeeded" {
-		return fmt.Errorf(finalTask.Error.Code)
-	}
-	return nil
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateSortableAttributesWithContext(ctx, &fields)
+	})
+	return err
 }
 
 //update primary key
 func (f *Index) UpdatePrimaryKey(key string) error {
+	return f.UpdatePrimaryKeyWithContext(context.Background(), key)
+}
+
+//update primary key with context
+func (f *Index) UpdatePrimaryKeyWithContext(
+	ctx context.Context,
+	key string) error {
 	//check
 	if key == "" {
 		return errors.New("invalid parameter")
 	}
-	//update key
-	task, err := f.index.UpdateIndex(key)
-	if err != nil {
-		return err
-	}
 
-	//wait for task
-	finalTask, _ := f.client.WaitForTask(task.TaskUID, f.getTimeout())
-	if finalTask.Status != "succeeded" {
-		return fmt.Errorf(finalTask.Error.Code)
-	}
-	return nil
+	//update key
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateIndexWithContext(ctx, key)
+	})
+	return err
 }
 
 //rebuild index
 func (f *Index) ReCreateIndex() error {
-	//remove index first
-	err := f.DeleteIndex(f.indexConf.IndexName)
-	if err != nil {
-		return err
+	return f.ReCreateIndexWithContext(context.Background())
+}
+
+//rebuild index with context
+//old doc drained and closed first, writes during recreating rejected,
+//fresh doc over existing index setup if recreating failed
+func (f *Index) ReCreateIndexWithContext(ctx context.Context) error {
+	//one rebuild at a time
+	if !atomic.CompareAndSwapInt32(&f.rebuilding, 0, 1) {
+		return ErrIndexRebuilding
+	}
+	defer atomic.StoreInt32(&f.rebuilding, 0)
+
+	//drain old doc, release workers and spool file
+	if doc := f.doc.Load(); doc != nil {
+		report, err := doc.Quit(ctx)
+		if err != nil {
+			return fmt.Errorf("drain old doc failed, err:%v", err.Error())
+		}
+		if report.Abandoned > 0 || report.Failed > 0 {
+			log.Printf("index.ReCreateIndex, index %v drained, report:%+v\n",
+				f.indexConf.IndexName, *report)
+		}
 	}
 
-	//begin init new index
-	err = f.interInit(true)
+	//remove index and init new index
+	err := f.DeleteIndexWithContext(ctx, f.indexConf.IndexName)
+	if err == nil {
+		err = f.interInit(ctx, true)
+	}
+	if err != nil {
+		//old doc closed, keep writes available
+		f.recoverDoc()
+	}
 	return err
 }
 
 //delete index
 func (f *Index) DeleteIndex(indexName string) error {
+	return f.DeleteIndexWithContext(context.Background(), indexName)
+}
+
+//delete index with context
+func (f *Index) DeleteIndexWithContext(
+	ctx context.Context,
+	indexName string) error {
 	//check
 	if indexName == "" {
 		return errors.New("invalid parameter")
 	}
 
 	//remove index first
-	task, err := f.client.DeleteIndex(indexName)
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.DeleteIndexWithContext(ctx, indexName)
+	})
 	if err != nil {
+		log.Printf("delete index %v failed, err:%v\n", indexName, err.Error())
 		return err
 	}
+	return nil
+}
 
-	//wait for task
-	finalTask, subErr := f.client.WaitForTask(task.TaskUID, f.getTimeout())
-	if subErr != nil {
-		return subErr
-	}
-	if finalTask.Status != "succeeded" {
-		err = fmt.Errorf("create index failed, err:%v", finalTask.Status)
-		log.Printf("init index %v failed, err:%v\n", f.indexConf.IndexName, err.Error())
-		return err
+//submit task and wait for final status with retry
+func (f *Index) runTask(
+	ctx context.Context,
+	submit func() (*meilisearch.TaskInfo, error)) (*meilisearch.Task, error) {
+	//submit and wait with retry
+	begin := time.Now()
+	_, finalTask, _, err := f.retry.runTask(ctx, f.client, f.getTimeout(), submit)
+	f.metrics.observeTask(begin, finalTask, err)
+	return finalTask, err
+}
+
+//setup fresh doc over existing index
+func (f *Index) recoverDoc() {
+	if f.index == nil {
+		f.index = f.client.Index(f.indexConf.IndexName)
 	}
-	return nil
+	f.doc.Store(NewDoc(f.client, f.index, f.indexConf, f.workers))
+	log.Printf("index.recoverDoc, index %v doc recovered\n", f.indexConf.IndexName)
 }
 
 //get timeout
@@ -176,7 +249,9 @@ func (f *Index) getTimeout() time.Duration {
 }
 
 //inter init
-func (f *Index) interInit(onlyReturns ...bool) error {
+func (f *Index) interInit(
+	ctx context.Context,
+	onlyReturns ...bool) error {
 	var (
 		index meilisearch.IndexManager
 		err error
@@ -195,26 +270,11 @@ func (f *Index) interInit(onlyReturns ...bool) error {
 	//create or init index
 	if f.indexConf.CreateIndex {
 		//create index
-		task, subErr := f.client.CreateIndex(indexCfg)
-		if subErr != nil {
-			if onlyReturn {
-				return subErr
-			}else{
-				panic(any(subErr))
-			}
-		}
-
-		//wait for task
-		finalTask, subErrTwo := f.client.WaitForTask(task.TaskUID, f.getTimeout())
-		if subErrTwo != nil {
-			if onlyReturn {
-				return subErrTwo
-			}else{
-				panic(any(subErrTwo))
-			}
-		}
-		if finalTask.Status != "succeeded" && finalTask.Error.Code != "index_already_exists" {
-			err = fmt.Errorf("create index failed, err:%v", finalTask.Status)
+		_, subErr := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+			return f.client.CreateIndexWithContext(ctx, indexCfg)
+		})
+		if subErr != nil && !isTaskErrorCode(subErr, "index_already_exists") {
+			err = fmt.Errorf("create index failed, err:%v", subErr.Error())
 			log.Printf("init index %v failed, err:%v\n", f.indexConf.IndexName, err.Error())
 			if onlyReturn {
 				return err
@@ -222,7 +282,7 @@ func (f *Index) interInit(onlyReturns ...bool) error {
 				panic(any(err))
 			}
 		}
-		index, _ = f.client.GetIndex(f.indexConf.IndexName)
+		index, _ = f.client.GetIndexWithContext(ctx, f.indexConf.IndexName)
 	}else{
 		//init index
 		index = f.client.Index(f.indexConf.IndexName)
@@ -236,35 +296,22 @@ func (f *Index) interInit(onlyReturns ...bool) error {
 	//sync index obj
 	f.index = index
 
-	//set filterable fields
-	if f.indexConf.FilterableFields != nil && len(f.indexConf.FilterableFields) > 0 {
-		if f.indexConf.UpdateFields {
-			err = f.UpdateFilterableAttributes(f.indexConf.FilterableFields)
-			if err != nil {
-				if onlyReturn {
-					return err
-				}else{
-					panic(any(err))
-				}
+	//reconcile declared settings, only changed settings applied
+	if f.indexConf.UpdateFields {
+		plan, subErr := f.ReconcileSettingsWithContext(ctx)
+		if subErr != nil {
+			if onlyReturn {
+				return subErr
+			}else{
+				panic(any(subErr))
 			}
 		}
-	}
-
-	//set sortable fields
-	if f.indexConf.SortableFields != nil && len(f.indexConf.SortableFields) > 0 {
-		if f.indexConf.UpdateFields {
-			err = f.UpdateSortableFields(f.indexConf.SortableFields)
-			if err != nil {
-				if onlyReturn {
-					return err
-				}else{
-					panic(any(err))
-				}
-			}
+		if plan.HasChanges() {
+			log.Printf("%v\n", plan.String())
 		}
 	}
 
 	//init doc obj
-	f.doc = NewDoc(f.client, f.index, f.indexConf, f.workers)
+	f.doc.Store(NewDoc(f.client, f.index, f.indexConf, f.workers))
 	return nil
 }
\ No newline at end of file
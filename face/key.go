@@ -0,0 +1,441 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * api key face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - key crud with typed actions and index scopes
+ * - provision declared keys from master key
+ * - rotated old key renamed and kept by default,
+ *   deleted at once or after grace period if opted in
+ */
+
+//key action
+type KeyAction string
+
+const (
+	KeyActionAll             KeyAction = "*"
+	KeyActionSearch          KeyAction = "search"
+	KeyActionDocumentsAll    KeyAction = "documents.*"
+	KeyActionDocumentsAdd    KeyAction = "documents.add"
+	KeyActionDocumentsGet    KeyAction = "documents.get"
+	KeyActionDocumentsDelete KeyAction = "documents.delete"
+	KeyActionIndexesAll      KeyAction = "indexes.*"
+	KeyActionIndexesCreate   KeyAction = "indexes.create"
+	KeyActionIndexesGet      KeyAction = "indexes.get"
+	KeyActionIndexesUpdate   KeyAction = "indexes.update"
+	KeyActionIndexesDelete   KeyAction = "indexes.delete"
+	KeyActionIndexesSwap     KeyAction = "indexes.swap"
+	KeyActionTasksAll        KeyAction = "tasks.*"
+	KeyActionTasksGet        KeyAction = "tasks.get"
+	KeyActionTasksCancel     KeyAction = "tasks.cancel"
+	KeyActionTasksDelete     KeyAction = "tasks.delete"
+	KeyActionSettingsAll     KeyAction = "settings.*"
+	KeyActionSettingsGet     KeyAction = "settings.get"
+	KeyActionSettingsUpdate  KeyAction = "settings.update"
+	KeyActionStatsGet        KeyAction = "stats.get"
+	KeyActionDumpsCreate     KeyAction = "dumps.create"
+	KeyActionSnapshotsCreate KeyAction = "snapshots.create"
+	KeyActionVersion         KeyAction = "version"
+	KeyActionKeysGet         KeyAction = "keys.get"
+	KeyActionKeysCreate      KeyAction = "keys.create"
+	KeyActionKeysUpdate      KeyAction = "keys.update"
+	KeyActionKeysDelete      KeyAction = "keys.delete"
+)
+
+//all indexes scope
+const KeyIndexesAll = "*"
+
+//inter type
+type (
+	//key spec
+	KeySpec struct {
+		Name        string //must value, unique name for provision
+		Description string
+		Actions     []KeyAction
+		Indexes     []string  //index names or patterns, `*` for all
+		ExpiresAt   time.Time //zero means never expire
+	}
+
+	//provision options
+	ProvisionOptions struct {
+		DeleteRotated bool          //delete rotated old key at once, services using it broken
+		RotatedGrace  time.Duration //delete rotated old keys after this period, 0 means kept
+	}
+)
+
+//face info
+type KeyManager struct {
+	client meilisearch.ServiceManager //reference
+	retry  *retryPolicy
+}
+
+//construct
+func NewKeyManager(
+	client meilisearch.ServiceManager,
+	retryConf *conf.RetryConf) *KeyManager {
+	this := &KeyManager{
+		client: client,
+		retry: newRetryPolicy(retryConf),
+	}
+	return this
+}
+
+//gen search only key spec of index
+func SearchKeySpec(indexName string) *KeySpec {
+	return &KeySpec{
+		Name: fmt.Sprintf("search-%v", indexName),
+		Description: fmt.Sprintf("search only key of %v", indexName),
+		Actions: []KeyAction{KeyActionSearch},
+		Indexes: []string{indexName},
+	}
+}
+
+//gen admin key spec for writers of indexes
+//no key management and instance level actions
+func AdminKeySpec(name string, indexNames ...string) *KeySpec {
+	if len(indexNames) <= 0 {
+		indexNames = []string{KeyIndexesAll}
+	}
+	return &KeySpec{
+		Name: name,
+		Description: fmt.Sprintf("admin key of %v", indexNames),
+		Actions: []KeyAction{
+			KeyActionSearch,
+			KeyActionDocumentsAll,
+			KeyActionIndexesAll,
+			KeyActionSettingsAll,
+			KeyActionTasksAll,
+			KeyActionStatsGet,
+		},
+		Indexes: indexNames,
+	}
+}
+
+//list keys
+func (f *KeyManager) List(limit, offset int64) (*meilisearch.KeysResults, error) {
+	return f.ListWithContext(context.Background(), limit, offset)
+}
+
+//list keys with context
+func (f *KeyManager) ListWithContext(
+	ctx context.Context,
+	limit, offset int64) (*meilisearch.KeysResults, error) {
+	var (
+		resp *meilisearch.KeysResults
+	)
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		resp, subErr = f.client.GetKeysWithContext(ctx, &meilisearch.KeysQuery{
+			Limit: limit,
+			Offset: offset,
+		})
+		return subErr
+	})
+	return resp, err
+}
+
+//list all keys
+func (f *KeyManager) ListAll(ctx context.Context) ([]meilisearch.Key, error) {
+	var (
+		offset int64
+	)
+	result := make([]meilisearch.Key, 0)
+	for {
+		resp, err := f.ListWithContext(ctx, define.DefaultKeyPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, resp.Results...)
+		offset += int64(len(resp.Results))
+		if len(resp.Results) <= 0 || offset >= resp.Total {
+			break
+		}
+	}
+	return result, nil
+}
+
+//get key by key value or uid
+func (f *KeyManager) Get(keyOrUID string) (*meilisearch.Key, error) {
+	return f.GetWithContext(context.Background(), keyOrUID)
+}
+
+//get key with context
+func (f *KeyManager) GetWithContext(
+	ctx context.Context,
+	keyOrUID string) (*meilisearch.Key, error) {
+	var (
+		key *meilisearch.Key
+	)
+	//check
+	if keyOrUID == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		key, subErr = f.client.GetKeyWithContext(ctx, keyOrUID)
+		return subErr
+	})
+	return key, err
+}
+
+//create key
+func (f *KeyManager) Create(spec *KeySpec) (*meilisearch.Key, error) {
+	return f.CreateWithContext(context.Background(), spec)
+}
+
+//create key with context
+//not retried, avoid duplicated keys
+func (f *KeyManager) CreateWithContext(
+	ctx context.Context,
+	spec *KeySpec) (*meilisearch.Key, error) {
+	//check
+	if spec == nil || len(spec.Actions) <= 0 || len(spec.Indexes) <= 0 {
+		return nil, errors.New("invalid parameter")
+	}
+	return f.client.CreateKeyWithContext(ctx, spec.toKey())
+}
+
+//update name and description of key
+//actions and indexes can not be updated by meili
+func (f *KeyManager) Update(keyOrUID, name, description string) (*meilisearch.Key, error) {
+	return f.UpdateWithContext(context.Background(), keyOrUID, name, description)
+}
+
+//update key with context
+func (f *KeyManager) UpdateWithContext(
+	ctx context.Context,
+	keyOrUID, name, description string) (*meilisearch.Key, error) {
+	var (
+		key *meilisearch.Key
+	)
+	//check
+	if keyOrUID == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		key, subErr = f.client.UpdateKeyWithContext(ctx, keyOrUID, &meilisearch.Key{
+			Name: name,
+			Description: description,
+		})
+		return subErr
+	})
+	return key, err
+}
+
+//delete key
+func (f *KeyManager) Delete(keyOrUID string) error {
+	return f.DeleteWithContext(context.Background(), keyOrUID)
+}
+
+//delete key with context
+func (f *KeyManager) DeleteWithContext(
+	ctx context.Context,
+	keyOrUID string) error {
+	//check
+	if keyOrUID == "" {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.retry.do(ctx, func() error {
+		_, subErr := f.client.DeleteKeyWithContext(ctx, keyOrUID)
+		return subErr
+	})
+	return err
+}
+
+//make sure declared keys exist
+//old key renamed as `<name>@rotated@<unix>` and kept after rotation
+//return name -> key, include key value
+func (f *KeyManager) Provision(
+	ctx context.Context,
+	specs ...*KeySpec) (map[string]*meilisearch.Key, error) {
+	return f.ProvisionWithOptions(ctx, nil, specs...)
+}
+
+//make sure declared keys exist with options
+//key matched by name, recreated if actions or indexes changed or expired
+//new key created before old one rotated, rotation logged
+//keys of same name, newest matched one kept and others rotated
+func (f *KeyManager) ProvisionWithOptions(
+	ctx context.Context,
+	opts *ProvisionOptions,
+	specs ...*KeySpec) (map[string]*meilisearch.Key, error) {
+	//check
+	if len(specs) <= 0 {
+		return nil, errors.New("invalid parameter")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts == nil {
+		opts = &ProvisionOptions{}
+	}
+	specMap := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if spec == nil || spec.Name == "" {
+			return nil, errors.New("key name not assigned")
+		}
+		if strings.Contains(spec.Name, define.KeyRotatedTag) {
+			return nil, fmt.Errorf("key name %v is reserved", spec.Name)
+		}
+		if specMap[spec.Name] {
+			return nil, fmt.Errorf("key name %v duplicated", spec.Name)
+		}
+		specMap[spec.Name] = true
+	}
+
+	//get exists keys by name, newest first
+	keys, err := f.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	keyMap := make(map[string][]meilisearch.Key, len(keys))
+	for _, key := range keys {
+		name, rotatedAt, rotated := parseRotatedName(key.Name)
+		if !specMap[name] {
+			continue
+		}
+		if !rotated {
+			keyMap[name] = append(keyMap[name], key)
+			continue
+		}
+
+		//delete rotated key out of grace period
+		if opts.RotatedGrace > 0 && time.Since(rotatedAt) >= opts.RotatedGrace {
+			err = f.DeleteWithContext(ctx, key.UID)
+			if err != nil {
+				return nil, fmt.Errorf("delete rotated key %v failed, err:%v", key.Name, err.Error())
+			}
+			log.Printf("keyManager.Provision, rotated key %v deleted, uid:%v\n", key.Name, key.UID)
+		}
+	}
+
+	//check spec one by one
+	result := make(map[string]*meilisearch.Key, len(specs))
+	for _, spec := range specs {
+		//pick newest matched key
+		olds := keyMap[spec.Name]
+		var picked *meilisearch.Key
+		for i := range olds {
+			if spec.sameAs(&olds[i]) {
+				key := olds[i]
+				picked = &key
+				break
+			}
+		}
+		if picked == nil {
+			key, subErr := f.CreateWithContext(ctx, spec)
+			if subErr != nil {
+				return result, fmt.Errorf("create key %v failed, err:%v", spec.Name, subErr.Error())
+			}
+			picked = key
+		}
+		result[spec.Name] = picked
+
+		//scope changed, expired or duplicated, old keys rotated
+		for _, old := range olds {
+			if old.UID == picked.UID {
+				continue
+			}
+			err = f.rotateKey(ctx, &old, opts)
+			if err != nil {
+				return result, err
+			}
+			log.Printf("keyManager.Provision, key %v rotated, old uid:%v, new uid:%v\n",
+				spec.Name, old.UID, picked.UID)
+		}
+	}
+	return result, nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//rotate old key
+//deleted if opted in, or renamed with rotated time and kept
+func (f *KeyManager) rotateKey(
+	ctx context.Context,
+	key *meilisearch.Key,
+	opts *ProvisionOptions) error {
+	if opts.DeleteRotated {
+		err := f.DeleteWithContext(ctx, key.UID)
+		if err != nil {
+			return fmt.Errorf("delete old key %v failed, err:%v", key.Name, err.Error())
+		}
+		return nil
+	}
+	rotatedName := fmt.Sprintf("%v%v%v", key.Name, define.KeyRotatedTag, time.Now().Unix())
+	_, err := f.UpdateWithContext(ctx, key.UID, rotatedName, key.Description)
+	if err != nil {
+		return fmt.Errorf("rename old key %v failed, err:%v", key.Name, err.Error())
+	}
+	return nil
+}
+
+//parse key name
+//return origin name, rotated time and rotated or not
+func parseRotatedName(name string) (string, time.Time, bool) {
+	idx := strings.LastIndex(name, define.KeyRotatedTag)
+	if idx < 0 {
+		return name, time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(name[idx + len(define.KeyRotatedTag):], 10, 64)
+	if err != nil {
+		return name, time.Time{}, false
+	}
+	return name[:idx], time.Unix(unix, 0), true
+}
+
+//convert spec to meili key
+func (s *KeySpec) toKey() *meilisearch.Key {
+	actions := make([]string, 0, len(s.Actions))
+	for _, action := range s.Actions {
+		actions = append(actions, string(action))
+	}
+	return &meilisearch.Key{
+		Name: s.Name,
+		Description: s.Description,
+		Actions: actions,
+		Indexes: s.Indexes,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+//check key has same scope with spec
+//expired key never same
+func (s *KeySpec) sameAs(key *meilisearch.Key) bool {
+	if key == nil {
+		return false
+	}
+	if !key.ExpiresAt.IsZero() && !key.ExpiresAt.After(time.Now()) {
+		return false
+	}
+	if !sameStringSet(s.toKey().Actions, key.Actions) ||
+		!sameStringSet(s.Indexes, key.Indexes) {
+		return false
+	}
+	if s.ExpiresAt.IsZero() != key.ExpiresAt.IsZero() {
+		return false
+	}
+	return s.ExpiresAt.IsZero() || s.ExpiresAt.Unix() == key.ExpiresAt.Unix()
+}
@@ -0,0 +1,140 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/lib"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * metrics recorder
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - record task, search, batch and error metrics of one index
+ * - metrics labeled by client tag and index name
+ */
+
+//face info
+type metricsRecorder struct {
+	sink lib.MetricsSink
+}
+
+//construct
+func newMetricsRecorder(indexConf *conf.IndexConf) *metricsRecorder {
+	var (
+		sink lib.MetricsSink
+	)
+	//use expvar sink if not assigned
+	sink = indexConf.Metrics
+	if sink == nil {
+		sink = lib.GetExpvarSink()
+	}
+
+	//self init
+	this := &metricsRecorder{
+		sink: lib.NewLabeledSink(sink, map[string]string{
+			lib.LabelIndex: indexConf.IndexName,
+		}),
+	}
+	return this
+}
+
+//get labeled sink
+func (f *metricsRecorder) getSink() lib.MetricsSink {
+	return f.sink
+}
+
+//observe task latency and status
+func (f *metricsRecorder) observeTask(
+	begin time.Time,
+	task *meilisearch.Task,
+	err error) {
+	status := "failed"
+	if task != nil {
+		status = string(task.Status)
+	}else if err == nil {
+		status = string(meilisearch.TaskStatusSucceeded)
+	}
+	f.sink.Observe(lib.MetricTaskLatency, float64(time.Since(begin).Milliseconds()), nil)
+	f.sink.IncCounter(lib.MetricTaskStatus, 1, map[string]string{
+		lib.LabelStatus: status,
+	})
+	f.incError(err)
+}
+
+//observe search latency
+func (f *metricsRecorder) observeSearch(
+	begin time.Time,
+	err error) {
+	f.sink.Observe(lib.MetricSearchLatency, float64(time.Since(begin).Milliseconds()), nil)
+	f.incError(err)
+}
+
+//observe docs size of one write call
+func (f *metricsRecorder) observeBatch(obj interface{}) {
+	size := 1
+	if obj != nil {
+		v := reflect.ValueOf(obj)
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			size = v.Len()
+		}
+	}
+	f.sink.Observe(lib.MetricWriteBatchSize, float64(size), nil)
+}
+
+//count error by code
+func (f *metricsRecorder) incError(err error) {
+	if err == nil {
+		return
+	}
+	f.sink.IncCounter(lib.MetricErrors, 1, map[string]string{
+		lib.LabelCode: getErrorCode(err),
+	})
+}
+
+//get error code for metrics
+func getErrorCode(err error) string {
+	var (
+		taskErr *TaskError
+		apiErr *meilisearch.Error
+	)
+	switch {
+	case errors.As(err, &taskErr):
+		if taskErr.Code != "" {
+			return taskErr.Code
+		}
+		return string(taskErr.Status)
+	case errors.As(err, &apiErr):
+		if apiErr.MeilisearchApiError.Code != "" {
+			return apiErr.MeilisearchApiError.Code
+		}
+		switch apiErr.ErrCode {
+		case meilisearch.MeilisearchCommunicationError:
+			return "communication_error"
+		case meilisearch.MeilisearchTimeoutError:
+			return "timeout_error"
+		case meilisearch.MeilisearchMaxRetriesExceeded:
+			return "max_retries_exceeded"
+		}
+		return fmt.Sprintf("http_%v", apiErr.StatusCode)
+	case errors.Is(err, lib.ErrQueueFull):
+		return "queue_full"
+	case errors.Is(err, lib.ErrQueueDropped):
+		return "queue_dropped"
+	case errors.Is(err, ErrWriteAbandoned):
+		return "write_abandoned"
+	case errors.Is(err, ErrDocClosed):
+		return "doc_closed"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+	return "unknown"
+}
@@ -0,0 +1,284 @@
+package face
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * multi and federated search face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - multi queries of diff indexes in one round trip
+ * - federated mode merges hits with query weights
+ * - federated hits decoded from raw response, numbers kept
+ */
+
+//inter type
+type (
+	//result of one query
+	MultiSearchResult struct {
+		IndexName          string
+		Query              string
+		Hits               []interface{}
+		TotalHits          int64
+		EstimatedTotalHits int64
+		Page               int64
+		PageSize           int64
+		TotalPages         int64
+		ProcessingTimeMs   int64
+		FacetDistribution  map[string]map[string]int64
+	}
+
+	//one federated hit
+	FederatedHit struct {
+		IndexName     string          //source index
+		QueryPosition int             //position of query para
+		Score         float64         //weighted ranking score
+		Doc           json.RawMessage //origin doc
+	}
+
+	//federated result
+	FederatedResult struct {
+		Hits               []*FederatedHit
+		Page               int
+		PageSize           int
+		EstimatedTotalHits int64
+		ProcessingTimeMs   int64
+	}
+
+	//raw federated response
+	rawFederatedResult struct {
+		Hits               []json.RawMessage `json:"hits"`
+		ProcessingTimeMs   int64             `json:"processingTimeMs"`
+		EstimatedTotalHits int64             `json:"estimatedTotalHits"`
+	}
+
+	//raw multi search request
+	rawMultiSearchReq struct {
+		Federation *meilisearch.MultiSearchFederation `json:"federation,omitempty"`
+		Queries    []*searchQuery                     `json:"queries"`
+	}
+
+	//federation info of raw hit
+	federationInfo struct {
+		IndexUid             string  `json:"indexUid"`
+		QueriesPosition      int     `json:"queriesPosition"`
+		WeightedRankingScore float64 `json:"weightedRankingScore"`
+	}
+)
+
+//decode hit doc into out
+func (h *FederatedHit) Decode(out interface{}) error {
+	return json.Unmarshal(h.Doc, out)
+}
+
+//multi search in one round trip
+//index name of each para is needed, alias supported
+func (f *Client) MultiSearch(
+	paras ...*define.QueryPara) ([]*MultiSearchResult, error) {
+	return f.MultiSearchWithContext(context.Background(), paras...)
+}
+
+//multi search with context
+func (f *Client) MultiSearchWithContext(
+	ctx context.Context,
+	paras ...*define.QueryPara) ([]*MultiSearchResult, error) {
+	//gen queries
+	queries, err := f.genMultiQueries(paras, false)
+	if err != nil {
+		return nil, err
+	}
+
+	//search
+	resp := &meilisearch.MultiSearchResponse{}
+	err = f.multiSearch(ctx, &rawMultiSearchReq{
+		Queries: queries,
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	//format results
+	results := make([]*MultiSearchResult, 0, len(resp.Results))
+	for _, v := range resp.Results {
+		results = append(results, &MultiSearchResult{
+			IndexName: v.IndexUID,
+			Query: v.Query,
+			Hits: v.Hits,
+			TotalHits: v.TotalHits,
+			EstimatedTotalHits: v.EstimatedTotalHits,
+			Page: v.Page,
+			PageSize: v.HitsPerPage,
+			TotalPages: v.TotalPages,
+			ProcessingTimeMs: v.ProcessingTimeMs,
+			FacetDistribution: convertFacets(v.FacetDistribution),
+		})
+	}
+	return results, nil
+}
+
+//federated search, merge hits of all queries into one ranked list
+//weight of query para used as federation weight
+func (f *Client) FederatedSearch(
+	page, pageSize int,
+	paras ...*define.QueryPara) (*FederatedResult, error) {
+	return f.FederatedSearchWithContext(context.Background(), page, pageSize, paras...)
+}
+
+//federated search with context
+func (f *Client) FederatedSearchWithContext(
+	ctx context.Context,
+	page, pageSize int,
+	paras ...*define.QueryPara) (*FederatedResult, error) {
+	//setup page
+	if page <= 0 {
+		page = define.DefaultPage
+	}
+	if pageSize <= 0 {
+		pageSize = define.DefaultPageSize
+	}
+
+	//gen queries
+	queries, err := f.genMultiQueries(paras, true)
+	if err != nil {
+		return nil, err
+	}
+
+	//search with raw response
+	resp := &rawFederatedResult{}
+	err = f.multiSearch(ctx, &rawMultiSearchReq{
+		Federation: &meilisearch.MultiSearchFederation{
+			Offset: int64((page - 1) * pageSize),
+			Limit: int64(pageSize),
+		},
+		Queries: queries,
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	//format hits with source index
+	result := &FederatedResult{
+		Hits: make([]*FederatedHit, 0, len(resp.Hits)),
+		Page: page,
+		PageSize: pageSize,
+		EstimatedTotalHits: resp.EstimatedTotalHits,
+		ProcessingTimeMs: resp.ProcessingTimeMs,
+	}
+	for _, v := range resp.Hits {
+		hit, subErr := genFederatedHit(v)
+		if subErr != nil {
+			return nil, subErr
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//multi search with retry
+//response decoded into out
+func (f *Client) multiSearch(
+	ctx context.Context,
+	req *rawMultiSearchReq,
+	out interface{}) error {
+	begin := time.Now()
+	_, err := f.retry.do(ctx, func() error {
+		return doRawRequest(ctx, f.httpClient, f.cfg.Host, f.cfg.ApiKey,
+			http.MethodPost, "/multi-search", "MultiSearch", req, out)
+	})
+	f.metrics.observeSearch(begin, err)
+	return err
+}
+
+//gen search queries
+func (f *Client) genMultiQueries(
+	paras []*define.QueryPara,
+	federated bool) ([]*searchQuery, error) {
+	//check
+	if paras == nil || len(paras) <= 0 {
+		return nil, errors.New("invalid parameter")
+	}
+
+	queries := make([]*searchQuery, 0, len(paras))
+	for i, para := range paras {
+		if para == nil || para.IndexName == "" {
+			return nil, fmt.Errorf("index name of query %v not assigned", i)
+		}
+		if federated && len(para.Facets) > 0 {
+			//meili rejects facets of query in federated mode
+			return nil, fmt.Errorf("facets of query %v not supported in federated mode", i)
+		}
+		query := newSearchRequest(para)
+		sq := query.req
+		sq.IndexUID = f.ResolveIndexName(para.IndexName)
+		if federated {
+			//pagination controlled by federation
+			sq.Page = 0
+			sq.HitsPerPage = 0
+			if para.Weight > 0 {
+				sq.FederationOptions = &meilisearch.SearchFederationOptions{
+					Weight: para.Weight,
+				}
+			}
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+//gen federated hit from raw hit
+//doc fields kept as raw json
+func genFederatedHit(rawHit json.RawMessage) (*FederatedHit, error) {
+	//decode fields
+	hitMap := map[string]json.RawMessage{}
+	err := json.Unmarshal(rawHit, &hitMap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hit format, err:%v", err.Error())
+	}
+
+	//pick federation info
+	info := federationInfo{}
+	if v, ok := hitMap["_federation"]; ok {
+		json.Unmarshal(v, &info)
+	}
+	delete(hitMap, "_federation")
+
+	//encode origin doc
+	doc, err := json.Marshal(hitMap)
+	if err != nil {
+		return nil, err
+	}
+	hit := &FederatedHit{
+		IndexName: info.IndexUid,
+		QueryPosition: info.QueriesPosition,
+		Score: info.WeightedRankingScore,
+		Doc: doc,
+	}
+	return hit, nil
+}
+
+//convert facet distribution
+func convertFacets(v interface{}) map[string]map[string]int64 {
+	facets := map[string]map[string]int64{}
+	if v == nil {
+		return facets
+	}
+	facetBytes, err := json.Marshal(v)
+	if err != nil {
+		return facets
+	}
+	json.Unmarshal(facetBytes, &facets)
+	return facets
+}
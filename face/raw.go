@@ -0,0 +1,87 @@
+package face
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * raw http request face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - call meili api directly, response kept as raw json
+ * - used where sdk decodes numbers into float64
+ * - non-200 response converted into sdk api error
+ */
+
+//send raw request and decode response into out
+//endpoint with query string, reqBody encoded as json if not nil
+func doRawRequest(
+	ctx context.Context,
+	httpClient *http.Client,
+	host, apiKey string,
+	method, endpoint, function string,
+	reqBody interface{},
+	out interface{}) error {
+	var (
+		body io.Reader
+	)
+	//check
+	if host == "" {
+		return errors.New("host not assigned")
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	//setup request
+	if reqBody != nil {
+		reqBytes, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(reqBytes)
+	}
+	reqUrl := strings.TrimRight(host, "/") + endpoint
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer " + apiKey)
+	}
+
+	//send request
+	httpResp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	respBytes, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		apiErr := &meilisearch.Error{
+			Endpoint: endpoint,
+			Method: method,
+			Function: function,
+			ResponseToString: string(respBytes),
+			StatusCode: httpResp.StatusCode,
+			ErrCode: meilisearch.MeilisearchApiError,
+		}
+		json.Unmarshal(respBytes, &apiErr.MeilisearchApiError)
+		return apiErr
+	}
+	return json.Unmarshal(respBytes, out)
+}
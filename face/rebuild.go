@@ -0,0 +1,233 @@
+package face
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * zero-downtime index rebuild
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - create shadow index `<name>_tmp_<ts>_<rand>` with declared settings
+ * - caller fill shadow index by builder
+ * - writes applied to live index while filling are recorded,
+ *   replayed into shadow index with writes paused before swap
+ * - swap shadow with live index, then delete old copy
+ * - shadow index removed if any step failed
+ */
+
+//fill func for rebuild
+type RebuildFillFunc func(builder *IndexBuilder) error
+
+//shadow index builder
+type IndexBuilder struct {
+	ctx       context.Context
+	owner     *Index                   //live index
+	index     meilisearch.IndexManager //shadow index
+	indexName string
+	docs      int64
+}
+
+//get shadow index name
+func (f *IndexBuilder) GetIndexName() string {
+	return f.indexName
+}
+
+//get added docs count
+func (f *IndexBuilder) GetDocsCount() int64 {
+	return f.docs
+}
+
+//get context of rebuilding
+func (f *IndexBuilder) Context() context.Context {
+	return f.ctx
+}
+
+//add docs into shadow index
+//sync opt, wait until task finished
+func (f *IndexBuilder) AddDocs(docObj interface{}) error {
+	//check
+	if docObj == nil {
+		return errors.New("invalid parameter")
+	}
+
+	//add docs and wait task
+	task, err := f.owner.runTask(f.ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.AddDocumentsWithContext(f.ctx, docObj, f.owner.indexConf.PrimaryKey)
+	})
+	if err != nil {
+		return err
+	}
+	if task != nil {
+		f.docs += task.Details.IndexedDocuments
+	}
+	return nil
+}
+
+//rebuild index without downtime
+func (f *Index) Rebuild(fill RebuildFillFunc) error {
+	return f.RebuildWithContext(context.Background(), fill)
+}
+
+//rebuild index without downtime with context
+func (f *Index) RebuildWithContext(
+	ctx context.Context,
+	fill RebuildFillFunc) error {
+	//check
+	if fill == nil {
+		return errors.New("invalid parameter")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := checkEmbedders(f.indexConf.Embedders); err != nil {
+		return err
+	}
+
+	//one rebuild at a time
+	if !atomic.CompareAndSwapInt32(&f.rebuilding, 0, 1) {
+		return ErrIndexRebuilding
+	}
+	defer atomic.StoreInt32(&f.rebuilding, 0)
+	indexName := f.indexConf.IndexName
+	shadowName, err := genShadowName(indexName)
+	if err != nil {
+		return err
+	}
+
+	//create shadow index
+	_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.CreateIndexWithContext(ctx, &meilisearch.IndexConfig{
+			Uid: shadowName,
+			PrimaryKey: f.indexConf.PrimaryKey,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("create shadow index failed, err:%v", err.Error())
+	}
+	shadowIndex := f.client.Index(shadowName)
+
+	//apply declared settings, overlaid on shadow settings
+	var shadowSettings *meilisearch.Settings
+	_, err = f.retry.do(ctx, func() error {
+		var subErr error
+		shadowSettings, subErr = shadowIndex.GetSettingsWithContext(ctx)
+		return subErr
+	})
+	if err == nil {
+		plan := f.diffSettings(shadowSettings, f.genDesiredSettings(shadowSettings))
+		if plan.HasChanges() {
+			_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+				return shadowIndex.UpdateSettingsWithContext(ctx, plan.Settings)
+			})
+		}
+	}
+	if err != nil {
+		f.dropShadowIndex(shadowName)
+		return fmt.Errorf("apply shadow settings failed, err:%v", err.Error())
+	}
+
+	//record writes applied to live index while filling
+	doc := f.GetDoc()
+	err = doc.startCapture()
+	if err != nil {
+		f.dropShadowIndex(shadowName)
+		return err
+	}
+
+	//fill shadow index by caller
+	builder := &IndexBuilder{
+		ctx: ctx,
+		owner: f,
+		index: shadowIndex,
+		indexName: shadowName,
+	}
+	err = fill(builder)
+	if err != nil {
+		doc.stopCapture()
+		f.dropShadowIndex(shadowName)
+		return fmt.Errorf("fill shadow index failed, err:%v", err.Error())
+	}
+
+	//pause writes until swapped, in-flight writes finished first
+	doc.pauseWrites()
+
+	//replay writes applied while filling
+	err = f.replayCaptured(ctx, shadowIndex, doc.stopCapture())
+	if err != nil {
+		doc.resumeWrites()
+		f.dropShadowIndex(shadowName)
+		return fmt.Errorf("replay writes into shadow index failed, err:%v", err.Error())
+	}
+
+	//make sure live index exists for swap
+	_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.CreateIndexWithContext(ctx, &meilisearch.IndexConfig{
+			Uid: indexName,
+			PrimaryKey: f.indexConf.PrimaryKey,
+		})
+	})
+	if err != nil && !isTaskErrorCode(err, "index_already_exists") {
+		doc.resumeWrites()
+		f.dropShadowIndex(shadowName)
+		return fmt.Errorf("create live index failed, err:%v", err.Error())
+	}
+
+	//swap live and shadow index
+	_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.SwapIndexesWithContext(ctx, []*meilisearch.SwapIndexesParams{
+			{Indexes: []string{indexName, shadowName}},
+		})
+	})
+	if err != nil {
+		doc.resumeWrites()
+		f.dropShadowIndex(shadowName)
+		return fmt.Errorf("swap index failed, err:%v", err.Error())
+	}
+
+	doc.resumeWrites()
+
+	//delete old copy, now named as shadow
+	f.dropShadowIndex(shadowName)
+	return nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//gen shadow index name
+//random suffix avoid collision of rebuilds in same second
+func genShadowName(indexName string) (string, error) {
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v_tmp_%v_%v", indexName, time.Now().Unix(),
+		hex.EncodeToString(suffix)), nil
+}
+
+//drop shadow index, failure only logged
+func (f *Index) dropShadowIndex(shadowName string) {
+	//use new context, dropping should not be canceled
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(define.DefaultTimeOut) * time.Second)
+	defer cancel()
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.DeleteIndexWithContext(ctx, shadowName)
+	})
+	if err != nil {
+		log.Printf("index.dropShadowIndex, delete %v failed, err:%v\n", shadowName, err.Error())
+	}
+}
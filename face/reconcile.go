@@ -0,0 +1,372 @@
+package face
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * index settings reconciler
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - diff live settings with declared index config
+ * - plan and payload from same config merged value
+ * - only changed settings applied in one task
+ * - dry run returns plan without applying
+ */
+
+//inter type
+type (
+	//one setting change
+	SettingChange struct {
+		Name string
+		From interface{}
+		To   interface{}
+	}
+
+	//settings plan
+	SettingsPlan struct {
+		IndexName string
+		Changes   []SettingChange
+		Settings  *meilisearch.Settings //changed settings only
+		Applied   bool
+	}
+)
+
+//check plan has changes or not
+func (p *SettingsPlan) HasChanges() bool {
+	return p != nil && len(p.Changes) > 0
+}
+
+//format plan as human-readable text
+func (p *SettingsPlan) String() string {
+	if p == nil {
+		return ""
+	}
+	if len(p.Changes) <= 0 {
+		return fmt.Sprintf("index %v: settings up to date", p.IndexName)
+	}
+	lines := []string{
+		fmt.Sprintf("index %v: %v setting(s) to change", p.IndexName, len(p.Changes)),
+	}
+	for _, change := range p.Changes {
+		lines = append(lines, fmt.Sprintf("  ~ %v: %v -> %v",
+			change.Name, formatSetting(change.From), formatSetting(change.To)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+//plan settings change without applying
+func (f *Index) PlanSettings() (*SettingsPlan, error) {
+	return f.ReconcileSettingsWithContext(context.Background(), true)
+}
+
+//reconcile settings with index config
+//dryRuns -> true means only return plan
+func (f *Index) ReconcileSettings(dryRuns ...bool) (*SettingsPlan, error) {
+	return f.ReconcileSettingsWithContext(context.Background(), dryRuns...)
+}
+
+//reconcile settings with context
+func (f *Index) ReconcileSettingsWithContext(
+	ctx context.Context,
+	dryRuns ...bool) (*SettingsPlan, error) {
+	var (
+		dryRun bool
+	)
+	if dryRuns != nil && len(dryRuns) > 0 {
+		dryRun = dryRuns[0]
+	}
+
+	//check declared embedders
+	err := checkEmbedders(f.indexConf.Embedders)
+	if err != nil {
+		return nil, err
+	}
+
+	//get live settings
+	live, err := f.GetSettingsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	//diff with declared settings
+	plan := f.diffSettings(live, f.genDesiredSettings(live))
+	if dryRun || !plan.HasChanges() {
+		return plan, nil
+	}
+
+	//apply changed settings in one task
+	err = f.UpdateSettingsWithContext(ctx, plan.Settings)
+	if err != nil {
+		return plan, err
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//gen desired settings, include filterable and sortable fields
+//config overlaid on live settings
+func (f *Index) genDesiredSettings(live *meilisearch.Settings) *meilisearch.Settings {
+	settings := f.genConfSettings(live)
+	if settings == nil {
+		settings = &meilisearch.Settings{}
+	}
+	if len(f.indexConf.FilterableFields) > 0 {
+		settings.FilterableAttributes = f.indexConf.FilterableFields
+	}
+	if len(f.indexConf.SortableFields) > 0 {
+		settings.SortableAttributes = f.indexConf.SortableFields
+	}
+	return settings
+}
+
+//diff live and desired settings
+//only assigned desired settings compared
+func (f *Index) diffSettings(
+	live, desired *meilisearch.Settings) *SettingsPlan {
+	plan := &SettingsPlan{
+		IndexName: f.indexConf.IndexName,
+		Settings: &meilisearch.Settings{},
+	}
+	if live == nil {
+		live = &meilisearch.Settings{}
+	}
+	changed := func(name string, from, to interface{}) {
+		plan.Changes = append(plan.Changes, SettingChange{
+			Name: name,
+			From: from,
+			To: to,
+		})
+	}
+
+	//order insensitive lists
+	if desired.FilterableAttributes != nil &&
+		!sameStringSet(live.FilterableAttributes, desired.FilterableAttributes) {
+		changed("filterableAttributes", live.FilterableAttributes, desired.FilterableAttributes)
+		plan.Settings.FilterableAttributes = desired.FilterableAttributes
+	}
+	if desired.SortableAttributes != nil &&
+		!sameStringSet(live.SortableAttributes, desired.SortableAttributes) {
+		changed("sortableAttributes", live.SortableAttributes, desired.SortableAttributes)
+		plan.Settings.SortableAttributes = desired.SortableAttributes
+	}
+	if desired.StopWords != nil &&
+		!sameStringSet(live.StopWords, desired.StopWords) {
+		changed("stopWords", live.StopWords, desired.StopWords)
+		plan.Settings.StopWords = desired.StopWords
+	}
+	if desired.SeparatorTokens != nil &&
+		!sameStringSet(live.SeparatorTokens, desired.SeparatorTokens) {
+		changed("separatorTokens", live.SeparatorTokens, desired.SeparatorTokens)
+		plan.Settings.SeparatorTokens = desired.SeparatorTokens
+	}
+	if desired.NonSeparatorTokens != nil &&
+		!sameStringSet(live.NonSeparatorTokens, desired.NonSeparatorTokens) {
+		changed("nonSeparatorTokens", live.NonSeparatorTokens, desired.NonSeparatorTokens)
+		plan.Settings.NonSeparatorTokens = desired.NonSeparatorTokens
+	}
+	if desired.Dictionary != nil &&
+		!sameStringSet(live.Dictionary, desired.Dictionary) {
+		changed("dictionary", live.Dictionary, desired.Dictionary)
+		plan.Settings.Dictionary = desired.Dictionary
+	}
+
+	//order sensitive lists
+	if desired.SearchableAttributes != nil &&
+		!reflect.DeepEqual(live.SearchableAttributes, desired.SearchableAttributes) {
+		changed("searchableAttributes", live.SearchableAttributes, desired.SearchableAttributes)
+		plan.Settings.SearchableAttributes = desired.SearchableAttributes
+	}
+	if desired.DisplayedAttributes != nil &&
+		!reflect.DeepEqual(live.DisplayedAttributes, desired.DisplayedAttributes) {
+		changed("displayedAttributes", live.DisplayedAttributes, desired.DisplayedAttributes)
+		plan.Settings.DisplayedAttributes = desired.DisplayedAttributes
+	}
+	if desired.RankingRules != nil &&
+		!reflect.DeepEqual(live.RankingRules, desired.RankingRules) {
+		changed("rankingRules", live.RankingRules, desired.RankingRules)
+		plan.Settings.RankingRules = desired.RankingRules
+	}
+
+	//scalar values
+	if desired.DistinctAttribute != nil &&
+		(live.DistinctAttribute == nil || *live.DistinctAttribute != *desired.DistinctAttribute) {
+		changed("distinctAttribute", live.DistinctAttribute, desired.DistinctAttribute)
+		plan.Settings.DistinctAttribute = desired.DistinctAttribute
+	}
+	if desired.ProximityPrecision != "" &&
+		live.ProximityPrecision != desired.ProximityPrecision {
+		changed("proximityPrecision", live.ProximityPrecision, desired.ProximityPrecision)
+		plan.Settings.ProximityPrecision = desired.ProximityPrecision
+	}
+	if desired.SearchCutoffMs > 0 &&
+		live.SearchCutoffMs != desired.SearchCutoffMs {
+		changed("searchCutoffMs", live.SearchCutoffMs, desired.SearchCutoffMs)
+		plan.Settings.SearchCutoffMs = desired.SearchCutoffMs
+	}
+
+	//structured values
+	if desired.Synonyms != nil && !sameSynonyms(live.Synonyms, desired.Synonyms) {
+		changed("synonyms", live.Synonyms, desired.Synonyms)
+		plan.Settings.Synonyms = desired.Synonyms
+	}
+	if desired.TypoTolerance != nil &&
+		!sameTypoTolerance(live.TypoTolerance, desired.TypoTolerance) {
+		changed("typoTolerance", live.TypoTolerance, desired.TypoTolerance)
+		plan.Settings.TypoTolerance = desired.TypoTolerance
+	}
+	if desired.Faceting != nil &&
+		!sameFaceting(live.Faceting, desired.Faceting) {
+		changed("faceting", live.Faceting, desired.Faceting)
+		plan.Settings.Faceting = desired.Faceting
+	}
+	if desired.Pagination != nil &&
+		(live.Pagination == nil || live.Pagination.MaxTotalHits != desired.Pagination.MaxTotalHits) {
+		changed("pagination", live.Pagination, desired.Pagination)
+		plan.Settings.Pagination = desired.Pagination
+	}
+	if desired.LocalizedAttributes != nil &&
+		!reflect.DeepEqual(live.LocalizedAttributes, desired.LocalizedAttributes) {
+		changed("localizedAttributes", live.LocalizedAttributes, desired.LocalizedAttributes)
+		plan.Settings.LocalizedAttributes = desired.LocalizedAttributes
+	}
+	if desired.Embedders != nil &&
+		!sameEmbedders(live.Embedders, desired.Embedders) {
+		changed("embedders", live.Embedders, desired.Embedders)
+		plan.Settings.Embedders = desired.Embedders
+	}
+	return plan
+}
+
+//check two string lists has same elements
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	return reflect.DeepEqual(sortedA, sortedB)
+}
+
+//check synonyms same or not
+func sameSynonyms(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range b {
+		if !sameStringSet(a[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+//check typo tolerance same or not
+//desired value merged from live value, whole value compared
+func sameTypoTolerance(live, desired *meilisearch.TypoTolerance) bool {
+	if live == nil {
+		return false
+	}
+	return live.Enabled == desired.Enabled &&
+		live.MinWordSizeForTypos == desired.MinWordSizeForTypos &&
+		sameStringSet(live.DisableOnWords, desired.DisableOnWords) &&
+		sameStringSet(live.DisableOnAttributes, desired.DisableOnAttributes)
+}
+
+//check faceting same or not
+//desired value merged from live value, whole value compared
+func sameFaceting(live, desired *meilisearch.Faceting) bool {
+	if live == nil ||
+		live.MaxValuesPerFacet != desired.MaxValuesPerFacet ||
+		len(live.SortFacetValuesBy) != len(desired.SortFacetValuesBy) {
+		return false
+	}
+	for k, v := range desired.SortFacetValuesBy {
+		if live.SortFacetValuesBy[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+//check declared embedders same or not
+//only assigned desired fields compared, live api key is masked
+//and header values may hold secrets, so only header names compared
+func sameEmbedders(live, desired map[string]meilisearch.Embedder) bool {
+	for name, want := range desired {
+		got, ok := live[name]
+		if !ok || got.Source != want.Source {
+			return false
+		}
+		if (want.Model != "" && got.Model != want.Model) ||
+			(want.DocumentTemplate != "" && got.DocumentTemplate != want.DocumentTemplate) ||
+			(want.Dimensions > 0 && got.Dimensions != want.Dimensions) ||
+			(want.URL != "" && got.URL != want.URL) ||
+			(want.Revision != "" && got.Revision != want.Revision) {
+			return false
+		}
+		if want.Distribution != nil &&
+			(got.Distribution == nil || *got.Distribution != *want.Distribution) {
+			return false
+		}
+		if want.Request != nil && !sameJsonValue(got.Request, want.Request) {
+			return false
+		}
+		if want.Response != nil && !sameJsonValue(got.Response, want.Response) {
+			return false
+		}
+		if want.Headers != nil {
+			if len(got.Headers) != len(want.Headers) {
+				return false
+			}
+			for k := range want.Headers {
+				if _, ok := got.Headers[k]; !ok {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+//check two values same after json normalized
+func sameJsonValue(a, b interface{}) bool {
+	aBytes, errA := json.Marshal(a)
+	bBytes, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	var aVal, bVal interface{}
+	if json.Unmarshal(aBytes, &aVal) != nil || json.Unmarshal(bBytes, &bVal) != nil {
+		return false
+	}
+	return reflect.DeepEqual(aVal, bVal)
+}
+
+//format setting value for plan
+func formatSetting(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "<none>"
+		}
+		return fmt.Sprintf("%+v", rv.Elem().Interface())
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,255 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * retry policy face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - exponential backoff with jitter
+ * - retry network errors, 5xx, 429 and assigned task error codes
+ * - task submitting and polling retried separately,
+ *   accepted task only re-submitted if failed with assigned code
+ */
+
+//face info
+type retryPolicy struct {
+	cfg *conf.RetryConf //reference, nil means no retry
+}
+
+//construct
+func newRetryPolicy(cfg *conf.RetryConf) *retryPolicy {
+	this := &retryPolicy{
+		cfg: cfg,
+	}
+	return this
+}
+
+//run opt with retry
+//return attempts, error
+func (f *retryPolicy) do(
+	ctx context.Context,
+	opt func() error) (int, error) {
+	var (
+		attempt int
+		err error
+	)
+	//check
+	if opt == nil {
+		return 0, errors.New("invalid parameter")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//run with retry
+	maxAttempts := f.getMaxAttempts()
+	for attempt = 1; ; attempt++ {
+		err = opt()
+		if err == nil || attempt >= maxAttempts || !f.isRetryable(err) {
+			return attempt, err
+		}
+
+		//wait for backoff
+		if !f.waitBackoff(ctx, attempt) {
+			return attempt, err
+		}
+	}
+}
+
+//submit task and wait for final status
+//submit errors retried by re-submit, polling errors retried by
+//polling again, failed task re-submitted only with retryable code
+//return origin task info, final task, submit attempts and error
+func (f *retryPolicy) runTask(
+	ctx context.Context,
+	client meilisearch.ServiceManager,
+	interval time.Duration,
+	submit func() (*meilisearch.TaskInfo, error)) (*meilisearch.TaskInfo, *meilisearch.Task, int, error) {
+	var (
+		attempt int
+		taskInfo *meilisearch.TaskInfo
+		task *meilisearch.Task
+		err error
+	)
+	//check
+	if submit == nil {
+		return nil, nil, 0, errors.New("invalid parameter")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//run with retry
+	maxAttempts := f.getMaxAttempts()
+	for attempt = 1; ; attempt++ {
+		//submit task
+		task = nil
+		taskInfo, err = submit()
+		if err == nil && taskInfo == nil {
+			err = errors.New("no any response from meili search")
+		}
+		if err == nil {
+			//task accepted, poll without re-submit
+			task, err = f.waitTask(ctx, client, taskInfo.TaskUID, interval)
+			if err == nil {
+				err = checkTaskStatus(task)
+			}
+			var taskErr *TaskError
+			if err != nil && !errors.As(err, &taskErr) {
+				//polling failed, task status unknown
+				return taskInfo, task, attempt, err
+			}
+		}
+		if err == nil || attempt >= maxAttempts || !f.isRetryable(err) {
+			return taskInfo, task, attempt, err
+		}
+
+		//wait for backoff
+		if !f.waitBackoff(ctx, attempt) {
+			return taskInfo, task, attempt, err
+		}
+	}
+}
+
+//wait task finished, polling errors retried
+func (f *retryPolicy) waitTask(
+	ctx context.Context,
+	client meilisearch.ServiceManager,
+	taskUID int64,
+	interval time.Duration) (*meilisearch.Task, error) {
+	var (
+		task *meilisearch.Task
+	)
+	//check
+	if client == nil {
+		return nil, errors.New("inter client not init")
+	}
+	_, err := f.do(ctx, func() error {
+		var subErr error
+		task, subErr = client.WaitForTaskWithContext(ctx, taskUID, interval)
+		return subErr
+	})
+	return task, err
+}
+
+//wait backoff before next attempt
+//return false if ctx done
+func (f *retryPolicy) waitBackoff(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(f.getBackoff(attempt))
+	defer timer.Stop()
+	select {
+	case <- timer.C:
+		return true
+	case <- ctx.Done():
+		return false
+	}
+}
+
+//check error can be retried or not
+func (f *retryPolicy) isRetryable(err error) bool {
+	var (
+		taskErr *TaskError
+		apiErr *meilisearch.Error
+		netErr net.Error
+	)
+	//check
+	if err == nil || f.cfg == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	//failed task
+	if errors.As(err, &taskErr) {
+		for _, code := range f.cfg.RetryTaskCodes {
+			if code == taskErr.Code {
+				return true
+			}
+		}
+		return false
+	}
+
+	//check error classes
+	retryNetwork, retry5xx, retry429 := f.getErrorClasses()
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrCode {
+		case meilisearch.MeilisearchCommunicationError,
+			meilisearch.MeilisearchTimeoutError:
+			return retryNetwork
+		}
+		if apiErr.StatusCode == http.StatusTooManyRequests {
+			return retry429
+		}
+		if apiErr.StatusCode >= http.StatusInternalServerError {
+			return retry5xx
+		}
+		return false
+	}
+	if errors.As(err, &netErr) {
+		return retryNetwork
+	}
+	return false
+}
+
+//get retry error classes
+//all classes enabled if not assigned
+func (f *retryPolicy) getErrorClasses() (bool, bool, bool) {
+	if !f.cfg.RetryNetwork && !f.cfg.Retry5xx && !f.cfg.Retry429 {
+		return true, true, true
+	}
+	return f.cfg.RetryNetwork, f.cfg.Retry5xx, f.cfg.Retry429
+}
+
+//get max attempts
+func (f *retryPolicy) getMaxAttempts() int {
+	if f.cfg == nil || f.cfg.MaxAttempts <= 1 {
+		return 1
+	}
+	return f.cfg.MaxAttempts
+}
+
+//get backoff before next attempt
+func (f *retryPolicy) getBackoff(attempt int) time.Duration {
+	baseBackoff := f.cfg.BaseBackoff
+	if baseBackoff <= 0 {
+		baseBackoff = time.Duration(define.DefaultRetryBaseBackoff) * time.Millisecond
+	}
+	maxBackoff := f.cfg.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Duration(define.DefaultRetryMaxBackoff) * time.Second
+	}
+
+	//exponential backoff
+	backoff := baseBackoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	//add random jitter
+	if f.cfg.Jitter > 0 {
+		jitter := f.cfg.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delta := float64(backoff) * jitter
+		backoff = time.Duration(float64(backoff) - delta + rand.Float64() * 2 * delta)
+	}
+	return backoff
+}
@@ -0,0 +1,350 @@
+package face
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/filter"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * full index scan face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - page through documents api by offset and limit
+ * - docs kept as raw json, numbers not passed through float64
+ * - next pages prefetched by background goroutine
+ * - memory bounded by page size * (prefetch + 2)
+ */
+
+//inter type
+type (
+	//scan options
+	ScanOptions struct {
+		Filter   interface{} //optional, string, []string or filter.Expr, fields need filterable
+		Fields   []string    //optional, fields returned
+		PageSize int64       //optional, docs of one page
+		Prefetch int         //optional, pages fetched ahead
+	}
+
+	//scanned page
+	scanPage struct {
+		docs  []json.RawMessage
+		total int64
+		err   error
+	}
+
+	//raw documents api result
+	rawDocsResult struct {
+		Results []json.RawMessage `json:"results"`
+		Total   int64             `json:"total"`
+	}
+
+	//doc iterator
+	DocIterator struct {
+		ctx       context.Context
+		cancel    context.CancelFunc
+		pageChan  chan *scanPage
+		page      []json.RawMessage
+		idx       int
+		doc       map[string]interface{} //decoded current doc
+		docIdx    int                    //page idx of decoded doc
+		total     int64
+		err       error
+		done      bool
+		closed    bool
+		closeOnce sync.Once
+	}
+
+	//typed doc iterator
+	TypedDocIterator[T any] struct {
+		iter *DocIterator
+		doc  T
+		err  error
+	}
+)
+
+//scan all docs of index
+//docs changed during scan may be missed or repeated
+func (f *Doc) Scan(
+	ctx context.Context,
+	opts *ScanOptions) *DocIterator {
+	var (
+		query meilisearch.DocumentsQuery
+	)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = define.DefaultScanPageSize
+	}
+	prefetch := opts.Prefetch
+	if prefetch <= 0 {
+		prefetch = define.DefaultScanPrefetch
+	}
+
+	//setup query
+	query.Limit = pageSize
+	query.Fields = opts.Fields
+	if opts.Filter != nil {
+		query.Filter = filter.Build(opts.Filter)
+	}
+
+	//init iterator
+	scanCtx, cancel := context.WithCancel(ctx)
+	this := &DocIterator{
+		ctx: scanCtx,
+		cancel: cancel,
+		pageChan: make(chan *scanPage, prefetch),
+	}
+
+	//check
+	if f.index == nil {
+		this.pageChan <- &scanPage{err: errors.New("inter index not init")}
+		close(this.pageChan)
+		return this
+	}
+
+	//fetch pages in background
+	go f.runScan(scanCtx, query, this.pageChan)
+	return this
+}
+
+//scan all docs with typed result
+func ScanDocs[T any](
+	ctx context.Context,
+	doc *Doc,
+	opts *ScanOptions) *TypedDocIterator[T] {
+	return &TypedDocIterator[T]{
+		iter: doc.Scan(ctx, opts),
+	}
+}
+
+//move to next doc
+func (f *DocIterator) Next() bool {
+	//check
+	if f.err != nil {
+		return false
+	}
+
+	//pick from current page
+	if f.idx < len(f.page) {
+		f.idx++
+		return true
+	}
+	if f.done {
+		return false
+	}
+
+	//wait next page
+	for {
+		page, ok := <- f.pageChan
+		if !ok {
+			//scan finished or canceled
+			if !f.closed {
+				f.err = f.ctx.Err()
+			}
+			f.done = true
+			f.cancel()
+			return false
+		}
+		if page.err != nil {
+			f.err = page.err
+			return false
+		}
+		f.page = page.docs
+		f.total = page.total
+		f.idx = 0
+		f.doc = nil
+		if len(f.page) > 0 {
+			f.idx++
+			return true
+		}
+	}
+}
+
+//get current raw doc
+func (f *DocIterator) Raw() json.RawMessage {
+	if f.idx <= 0 || f.idx > len(f.page) {
+		return nil
+	}
+	return f.page[f.idx - 1]
+}
+
+//get current doc
+//numbers decoded as json.Number, keep precision of large int64
+func (f *DocIterator) Doc() map[string]interface{} {
+	raw := f.Raw()
+	if raw == nil {
+		return nil
+	}
+	if f.doc != nil && f.docIdx == f.idx {
+		return f.doc
+	}
+	doc := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil
+	}
+	f.doc = doc
+	f.docIdx = f.idx
+	return doc
+}
+
+//decode current doc into out
+func (f *DocIterator) Decode(out interface{}) error {
+	raw := f.Raw()
+	if raw == nil {
+		return errors.New("no current doc")
+	}
+	return json.Unmarshal(raw, out)
+}
+
+//get total docs matched
+func (f *DocIterator) Total() int64 {
+	return f.total
+}
+
+//get iterator error
+func (f *DocIterator) Err() error {
+	return f.err
+}
+
+//close iterator, stop prefetching
+//should be called if not iterated to the end
+func (f *DocIterator) Close() {
+	f.closeOnce.Do(func() {
+		f.closed = true
+		f.cancel()
+		//drain pages to release fetching goroutine
+		go func() {
+			for range f.pageChan {
+			}
+		}()
+	})
+}
+
+//move to next typed doc
+func (f *TypedDocIterator[T]) Next() bool {
+	if f.err != nil || !f.iter.Next() {
+		return false
+	}
+	var doc T
+	f.err = f.iter.Decode(&doc)
+	if f.err != nil {
+		return false
+	}
+	f.doc = doc
+	return true
+}
+
+//get current typed doc
+func (f *TypedDocIterator[T]) Doc() T {
+	return f.doc
+}
+
+//get total docs matched
+func (f *TypedDocIterator[T]) Total() int64 {
+	return f.iter.Total()
+}
+
+//get iterator error
+func (f *TypedDocIterator[T]) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.iter.Err()
+}
+
+//close iterator
+func (f *TypedDocIterator[T]) Close() {
+	f.iter.Close()
+}
+
+/////////////////
+//private func
+/////////////////
+
+//get docs page as raw json
+//sdk decodes docs into map, numbers passed through float64
+//sent by http client of doc, timeout and transport shared with client
+func (f *Doc) getRawDocs(
+	ctx context.Context,
+	query *meilisearch.DocumentsQuery,
+	resp *rawDocsResult) error {
+	var (
+		reqBody interface{}
+	)
+	//setup request, post fetch api if filter assigned
+	method := http.MethodGet
+	endpoint := fmt.Sprintf("/indexes/%v/documents", url.PathEscape(f.indexConf.IndexName))
+	if query.Filter != nil {
+		method = http.MethodPost
+		endpoint += "/fetch"
+		reqBody = query
+	}else{
+		values := url.Values{}
+		values.Set("limit", strconv.FormatInt(query.Limit, 10))
+		values.Set("offset", strconv.FormatInt(query.Offset, 10))
+		if len(query.Fields) > 0 {
+			values.Set("fields", strings.Join(query.Fields, ","))
+		}
+		endpoint += "?" + values.Encode()
+	}
+	return doRawRequest(ctx, f.httpClient, f.indexConf.Host, f.indexConf.ApiKey,
+		method, endpoint, "GetDocuments", reqBody, resp)
+}
+
+//run scan process
+func (f *Doc) runScan(
+	ctx context.Context,
+	query meilisearch.DocumentsQuery,
+	pageChan chan *scanPage) {
+	defer close(pageChan)
+	for {
+		//fetch one page
+		resp := &rawDocsResult{}
+		begin := time.Now()
+		_, err := f.retry.do(ctx, func() error {
+			return f.getRawDocs(ctx, &query, resp)
+		})
+		f.metrics.observeSearch(begin, err)
+		page := &scanPage{
+			docs: resp.Results,
+			total: resp.Total,
+			err: err,
+		}
+
+		//send to iterator
+		select {
+		case pageChan <- page:
+		case <- ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		//check finished
+		query.Offset += int64(len(resp.Results))
+		if len(resp.Results) <= 0 || query.Offset >= resp.Total {
+			return
+		}
+	}
+}
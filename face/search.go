@@ -0,0 +1,264 @@
+package face
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/filter"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * generic typed search face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - decode hits into []T from raw response directly
+ * - request body marshalled by self, zero semantic ratio kept
+ */
+
+//inter type
+type (
+	//facet stats of one numeric field
+	FacetStat struct {
+		Min float64 `json:"min"`
+		Max float64 `json:"max"`
+	}
+
+	//typed search result
+	SearchResult[T any] struct {
+		Hits               []T
+		Query              string
+		ProcessingTimeMs   int64
+		Page               int64
+		PageSize           int64
+		TotalPages         int64
+		TotalHits          int64
+		EstimatedTotalHits int64
+		Offset             int64
+		Limit              int64
+		FacetDistribution  map[string]map[string]int64 //field -> value -> count
+		FacetStats         map[string]FacetStat        //field -> stat
+	}
+
+	//search request body
+	//hybrid block marshalled by self, sdk omits zero semantic ratio
+	searchQuery struct {
+		req    *meilisearch.SearchRequest
+		hybrid *searchHybrid
+	}
+
+	//hybrid block of search request
+	searchHybrid struct {
+		Embedder      string   `json:"embedder"`
+		SemanticRatio *float64 `json:"semanticRatio,omitempty"`
+	}
+
+	//raw search response
+	rawSearchResp struct {
+		Hits               []json.RawMessage           `json:"hits"`
+		Query              string                      `json:"query"`
+		ProcessingTimeMs   int64                       `json:"processingTimeMs"`
+		Page               int64                       `json:"page"`
+		HitsPerPage        int64                       `json:"hitsPerPage"`
+		TotalPages         int64                       `json:"totalPages"`
+		TotalHits          int64                       `json:"totalHits"`
+		EstimatedTotalHits int64                       `json:"estimatedTotalHits"`
+		Offset             int64                       `json:"offset"`
+		Limit              int64                       `json:"limit"`
+		FacetDistribution  map[string]map[string]int64 `json:"facetDistribution"`
+		FacetStats         map[string]FacetStat        `json:"facetStats"`
+	}
+)
+
+//search docs with typed result
+//sync opt
+func Search[T any](
+	doc *Doc,
+	para *define.QueryPara) (*SearchResult[T], error) {
+	return SearchWithContext[T](context.Background(), doc, para)
+}
+
+//search docs with typed result and context
+//sync opt
+func SearchWithContext[T any](
+	ctx context.Context,
+	doc *Doc,
+	para *define.QueryPara) (*SearchResult[T], error) {
+	//check
+	if doc == nil || para == nil {
+		return nil, errors.New("invalid parameter")
+	}
+
+	//query raw response
+	resp, err := doc.searchRaw(ctx, para)
+	if err != nil {
+		return nil, err
+	}
+
+	//decode hits one by one
+	hits := make([]T, 0, len(resp.Hits))
+	for _, rawHit := range resp.Hits {
+		var hit T
+		err = json.Unmarshal(rawHit, &hit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+
+	//format result
+	result := &SearchResult[T]{
+		Hits: hits,
+		Query: resp.Query,
+		ProcessingTimeMs: resp.ProcessingTimeMs,
+		Page: resp.Page,
+		PageSize: resp.HitsPerPage,
+		TotalPages: resp.TotalPages,
+		TotalHits: resp.TotalHits,
+		EstimatedTotalHits: resp.EstimatedTotalHits,
+		Offset: resp.Offset,
+		Limit: resp.Limit,
+		FacetDistribution: resp.FacetDistribution,
+		FacetStats: resp.FacetStats,
+	}
+	if result.FacetDistribution == nil {
+		result.FacetDistribution = map[string]map[string]int64{}
+	}
+	if result.FacetStats == nil {
+		result.FacetStats = map[string]FacetStat{}
+	}
+	return result, nil
+}
+
+//encode search request
+//sdk fields encoded first, then hybrid block overlaid
+func (q *searchQuery) MarshalJSON() ([]byte, error) {
+	reqBytes, err := json.Marshal(q.req)
+	if err != nil || q.hybrid == nil {
+		return reqBytes, err
+	}
+	body := map[string]json.RawMessage{}
+	err = json.Unmarshal(reqBytes, &body)
+	if err != nil {
+		return nil, err
+	}
+	body["hybrid"], err = json.Marshal(q.hybrid)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(body)
+}
+
+/////////////////
+//private func
+/////////////////
+
+//search and decode raw response
+func (f *Doc) searchRaw(
+	ctx context.Context,
+	para *define.QueryPara) (*rawSearchResp, error) {
+	//check
+	if para == nil {
+		return nil, errors.New("invalid parameter")
+	}
+	if f.index == nil {
+		return nil, errors.New("inter index not init")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//setup search request
+	sq := f.genSearchRequest(para)
+
+	//query raw response
+	resp := &rawSearchResp{}
+	endpoint := fmt.Sprintf("/indexes/%v/search", url.PathEscape(f.indexConf.IndexName))
+	begin := time.Now()
+	_, err := f.retry.do(ctx, func() error {
+		return doRawRequest(ctx, f.httpClient, f.indexConf.Host, f.indexConf.ApiKey,
+			http.MethodPost, endpoint, "SearchRaw", sq, resp)
+	})
+	f.metrics.observeSearch(begin, err)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+//gen search request by query para
+func (f *Doc) genSearchRequest(
+	para *define.QueryPara) *searchQuery {
+	return newSearchRequest(para)
+}
+
+//new search request by query para
+func newSearchRequest(
+	para *define.QueryPara) *searchQuery {
+	//setup offset
+	if para.Page <= 0 {
+		para.Page = define.DefaultPage
+	}
+	if para.PageSize <= 0 {
+		para.PageSize = define.DefaultPageSize
+	}
+
+	//setup search request
+	sq := &meilisearch.SearchRequest{
+		Query: para.Key,
+		Filter: filter.Build(para.Filter),
+		Facets: para.Facets,
+		Sort: para.Sort,
+		Page: int64(para.Page),
+		HitsPerPage:int64(para.PageSize),
+	}
+	if para.Distinct != "" {
+		sq.Distinct = para.Distinct
+	}
+	if para.AttributesToSearch != nil && len(para.AttributesToSearch) > 0 {
+		sq.AttributesToSearchOn = para.AttributesToSearch
+	}
+
+	//setup highlight and crop
+	if len(para.AttributesToHighlight) > 0 {
+		sq.AttributesToHighlight = para.AttributesToHighlight
+		sq.HighlightPreTag = para.HighlightPreTag
+		sq.HighlightPostTag = para.HighlightPostTag
+	}
+	if len(para.AttributesToCrop) > 0 {
+		sq.AttributesToCrop = para.AttributesToCrop
+		sq.CropLength = int64(para.CropLength)
+		sq.CropMarker = para.CropMarker
+	}
+	sq.ShowMatchesPosition = para.ShowMatchesPosition
+
+	//setup vector and hybrid
+	if len(para.Vector) > 0 {
+		sq.Vector = para.Vector
+	}
+	query := &searchQuery{
+		req: sq,
+	}
+	if para.Hybrid != nil {
+		embedder := para.Hybrid.Embedder
+		if embedder == "" {
+			embedder = define.DefaultEmbedder
+		}
+		query.hybrid = &searchHybrid{
+			Embedder: embedder,
+			SemanticRatio: para.Hybrid.SemanticRatio,
+		}
+	}
+	sq.RetrieveVectors = para.RetrieveVectors
+	sq.ShowRankingScore = para.ShowRankingScore
+	if para.RankingScoreThreshold > 0 {
+		sq.RankingScoreThreshold = para.RankingScoreThreshold
+	}
+	return query
+}
@@ -0,0 +1,560 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * index settings face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - declarative settings from index config
+ * - typed update methods for runtime change
+ * - typo tolerance and faceting overlaid on live value
+ */
+
+//get all settings
+func (f *Index) GetSettings() (*meilisearch.Settings, error) {
+	return f.GetSettingsWithContext(context.Background())
+}
+
+//get all settings with context
+func (f *Index) GetSettingsWithContext(
+	ctx context.Context) (*meilisearch.Settings, error) {
+	var (
+		settings *meilisearch.Settings
+	)
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		settings, subErr = f.index.GetSettingsWithContext(ctx)
+		return subErr
+	})
+	return settings, err
+}
+
+//update settings in one task
+func (f *Index) UpdateSettings(settings *meilisearch.Settings) error {
+	return f.UpdateSettingsWithContext(context.Background(), settings)
+}
+
+//update settings in one task with context
+func (f *Index) UpdateSettingsWithContext(
+	ctx context.Context,
+	settings *meilisearch.Settings) error {
+	//check
+	if settings == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateSettingsWithContext(ctx, settings)
+	})
+	return err
+}
+
+//update searchable fields
+func (f *Index) UpdateSearchableFields(fields []string) error {
+	return f.UpdateSearchableFieldsWithContext(context.Background(), fields)
+}
+
+//update searchable fields with context
+func (f *Index) UpdateSearchableFieldsWithContext(
+	ctx context.Context,
+	fields []string) error {
+	//check
+	if len(fields) <= 0 {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateSearchableAttributesWithContext(ctx, &fields)
+	})
+	return err
+}
+
+//update displayed fields
+func (f *Index) UpdateDisplayedFields(fields []string) error {
+	return f.UpdateDisplayedFieldsWithContext(context.Background(), fields)
+}
+
+//update displayed fields with context
+func (f *Index) UpdateDisplayedFieldsWithContext(
+	ctx context.Context,
+	fields []string) error {
+	//check
+	if len(fields) <= 0 {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateDisplayedAttributesWithContext(ctx, &fields)
+	})
+	return err
+}
+
+//update ranking rules
+func (f *Index) UpdateRankingRules(rules []string) error {
+	return f.UpdateRankingRulesWithContext(context.Background(), rules)
+}
+
+//update ranking rules with context
+func (f *Index) UpdateRankingRulesWithContext(
+	ctx context.Context,
+	rules []string) error {
+	//check
+	if len(rules) <= 0 {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateRankingRulesWithContext(ctx, &rules)
+	})
+	return err
+}
+
+//update distinct field
+func (f *Index) UpdateDistinctField(field string) error {
+	return f.UpdateDistinctFieldWithContext(context.Background(), field)
+}
+
+//update distinct field with context
+func (f *Index) UpdateDistinctFieldWithContext(
+	ctx context.Context,
+	field string) error {
+	//check
+	if field == "" {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateDistinctAttributeWithContext(ctx, field)
+	})
+	return err
+}
+
+//update synonyms
+func (f *Index) UpdateSynonyms(synonyms map[string][]string) error {
+	return f.UpdateSynonymsWithContext(context.Background(), synonyms)
+}
+
+//update synonyms with context
+func (f *Index) UpdateSynonymsWithContext(
+	ctx context.Context,
+	synonyms map[string][]string) error {
+	//check
+	if synonyms == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateSynonymsWithContext(ctx, &synonyms)
+	})
+	return err
+}
+
+//update stop words
+func (f *Index) UpdateStopWords(words []string) error {
+	return f.UpdateStopWordsWithContext(context.Background(), words)
+}
+
+//update stop words with context
+func (f *Index) UpdateStopWordsWithContext(
+	ctx context.Context,
+	words []string) error {
+	//check
+	if words == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateStopWordsWithContext(ctx, &words)
+	})
+	return err
+}
+
+//update typo tolerance
+//only assigned fields changed, others keep live value
+func (f *Index) UpdateTypoTolerance(typo *conf.TypoToleranceConf) error {
+	return f.UpdateTypoToleranceWithContext(context.Background(), typo)
+}
+
+//update typo tolerance with context
+func (f *Index) UpdateTypoToleranceWithContext(
+	ctx context.Context,
+	typo *conf.TypoToleranceConf) error {
+	var (
+		live *meilisearch.TypoTolerance
+	)
+	//check
+	if typo == nil {
+		return errors.New("invalid parameter")
+	}
+
+	//get live value
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		live, subErr = f.index.GetTypoToleranceWithContext(ctx)
+		return subErr
+	})
+	if err != nil {
+		return err
+	}
+
+	//overlay and update
+	merged := mergeTypoTolerance(live, typo)
+	_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateTypoToleranceWithContext(ctx, merged)
+	})
+	return err
+}
+
+//update faceting
+//only assigned fields changed, others keep live value
+func (f *Index) UpdateFaceting(faceting *conf.FacetingConf) error {
+	return f.UpdateFacetingWithContext(context.Background(), faceting)
+}
+
+//update faceting with context
+func (f *Index) UpdateFacetingWithContext(
+	ctx context.Context,
+	faceting *conf.FacetingConf) error {
+	var (
+		live *meilisearch.Faceting
+	)
+	//check
+	if faceting == nil {
+		return errors.New("invalid parameter")
+	}
+
+	//get live value
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		live, subErr = f.index.GetFacetingWithContext(ctx)
+		return subErr
+	})
+	if err != nil {
+		return err
+	}
+
+	//overlay and update
+	merged := mergeFaceting(live, faceting)
+	_, err = f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateFacetingWithContext(ctx, merged)
+	})
+	return err
+}
+
+//update pagination
+func (f *Index) UpdatePagination(pagination *meilisearch.Pagination) error {
+	return f.UpdatePaginationWithContext(context.Background(), pagination)
+}
+
+//update pagination with context
+func (f *Index) UpdatePaginationWithContext(
+	ctx context.Context,
+	pagination *meilisearch.Pagination) error {
+	//check
+	if pagination == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdatePaginationWithContext(ctx, pagination)
+	})
+	return err
+}
+
+//update proximity precision
+func (f *Index) UpdateProximityPrecision(precision meilisearch.ProximityPrecisionType) error {
+	return f.UpdateProximityPrecisionWithContext(context.Background(), precision)
+}
+
+//update proximity precision with context
+func (f *Index) UpdateProximityPrecisionWithContext(
+	ctx context.Context,
+	precision meilisearch.ProximityPrecisionType) error {
+	//check
+	if precision == "" {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateProximityPrecisionWithContext(ctx, precision)
+	})
+	return err
+}
+
+//update separator tokens
+func (f *Index) UpdateSeparatorTokens(tokens []string) error {
+	return f.UpdateSeparatorTokensWithContext(context.Background(), tokens)
+}
+
+//update separator tokens with context
+func (f *Index) UpdateSeparatorTokensWithContext(
+	ctx context.Context,
+	tokens []string) error {
+	//check
+	if tokens == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateSeparatorTokensWithContext(ctx, tokens)
+	})
+	return err
+}
+
+//update non separator tokens
+func (f *Index) UpdateNonSeparatorTokens(tokens []string) error {
+	return f.UpdateNonSeparatorTokensWithContext(context.Background(), tokens)
+}
+
+//update non separator tokens with context
+func (f *Index) UpdateNonSeparatorTokensWithContext(
+	ctx context.Context,
+	tokens []string) error {
+	//check
+	if tokens == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateNonSeparatorTokensWithContext(ctx, tokens)
+	})
+	return err
+}
+
+//update dictionary
+func (f *Index) UpdateDictionary(words []string) error {
+	return f.UpdateDictionaryWithContext(context.Background(), words)
+}
+
+//update dictionary with context
+func (f *Index) UpdateDictionaryWithContext(
+	ctx context.Context,
+	words []string) error {
+	//check
+	if words == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateDictionaryWithContext(ctx, words)
+	})
+	return err
+}
+
+//update search cutoff ms
+func (f *Index) UpdateSearchCutoffMs(cutoffMs int64) error {
+	return f.UpdateSearchCutoffMsWithContext(context.Background(), cutoffMs)
+}
+
+//update search cutoff ms with context
+func (f *Index) UpdateSearchCutoffMsWithContext(
+	ctx context.Context,
+	cutoffMs int64) error {
+	//check
+	if cutoffMs <= 0 {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateSearchCutoffMsWithContext(ctx, cutoffMs)
+	})
+	return err
+}
+
+//update localized attributes
+func (f *Index) UpdateLocalizedAttributes(attributes []*meilisearch.LocalizedAttributes) error {
+	return f.UpdateLocalizedAttributesWithContext(context.Background(), attributes)
+}
+
+//update localized attributes with context
+func (f *Index) UpdateLocalizedAttributesWithContext(
+	ctx context.Context,
+	attributes []*meilisearch.LocalizedAttributes) error {
+	//check
+	if attributes == nil {
+		return errors.New("invalid parameter")
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateLocalizedAttributesWithContext(ctx, attributes)
+	})
+	return err
+}
+
+//update embedders
+func (f *Index) UpdateEmbedders(embedders map[string]meilisearch.Embedder) error {
+	return f.UpdateEmbeddersWithContext(context.Background(), embedders)
+}
+
+//update embedders with context
+func (f *Index) UpdateEmbeddersWithContext(
+	ctx context.Context,
+	embedders map[string]meilisearch.Embedder) error {
+	//check
+	if len(embedders) <= 0 {
+		return errors.New("invalid parameter")
+	}
+	if err := checkEmbedders(embedders); err != nil {
+		return err
+	}
+	_, err := f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.index.UpdateEmbeddersWithContext(ctx, embedders)
+	})
+	return err
+}
+
+/////////////////
+//private func
+/////////////////
+
+//check embedders by source
+//required fields of each source must be assigned
+func checkEmbedders(embedders map[string]meilisearch.Embedder) error {
+	for name, embedder := range embedders {
+		switch embedder.Source {
+		case define.EmbedderSourceUserProvided:
+			if embedder.Dimensions <= 0 {
+				return fmt.Errorf("embedder %v need dimensions", name)
+			}
+		case define.EmbedderSourceRest:
+			if embedder.URL == "" || embedder.Request == nil || embedder.Response == nil {
+				return fmt.Errorf("embedder %v need url, request and response", name)
+			}
+		case define.EmbedderSourceOllama:
+			if embedder.Model == "" {
+				return fmt.Errorf("embedder %v need model", name)
+			}
+		case define.EmbedderSourceOpenAi, define.EmbedderSourceHuggingFace:
+		default:
+			return fmt.Errorf("embedder %v has invalid source `%v`", name, embedder.Source)
+		}
+	}
+	return nil
+}
+
+//merge typo tolerance config into live value
+func mergeTypoTolerance(
+	live *meilisearch.TypoTolerance,
+	cfg *conf.TypoToleranceConf) *meilisearch.TypoTolerance {
+	merged := &meilisearch.TypoTolerance{}
+	if live != nil {
+		*merged = *live
+	}
+	if cfg.Enabled != nil {
+		merged.Enabled = *cfg.Enabled
+	}
+	if cfg.OneTypo != nil {
+		merged.MinWordSizeForTypos.OneTypo = *cfg.OneTypo
+	}
+	if cfg.TwoTypos != nil {
+		merged.MinWordSizeForTypos.TwoTypos = *cfg.TwoTypos
+	}
+	if cfg.DisableOnWords != nil {
+		merged.DisableOnWords = cfg.DisableOnWords
+	}
+	if cfg.DisableOnAttributes != nil {
+		merged.DisableOnAttributes = cfg.DisableOnAttributes
+	}
+	return merged
+}
+
+//merge faceting config into live value
+func mergeFaceting(
+	live *meilisearch.Faceting,
+	cfg *conf.FacetingConf) *meilisearch.Faceting {
+	merged := &meilisearch.Faceting{
+		SortFacetValuesBy: map[string]meilisearch.SortFacetType{},
+	}
+	if live != nil {
+		merged.MaxValuesPerFacet = live.MaxValuesPerFacet
+		for k, v := range live.SortFacetValuesBy {
+			merged.SortFacetValuesBy[k] = v
+		}
+	}
+	if cfg.MaxValuesPerFacet != nil {
+		merged.MaxValuesPerFacet = *cfg.MaxValuesPerFacet
+	}
+	for k, v := range cfg.SortFacetValuesBy {
+		merged.SortFacetValuesBy[k] = v
+	}
+	return merged
+}
+
+//gen settings from index config
+//typo tolerance and faceting config overlaid on live settings
+//filterable and sortable fields not included
+//return nil if no any settings assigned
+func (f *Index) genConfSettings(live *meilisearch.Settings) *meilisearch.Settings {
+	var (
+		assigned bool
+	)
+	cfg := f.indexConf
+	if live == nil {
+		live = &meilisearch.Settings{}
+	}
+	settings := &meilisearch.Settings{}
+	if len(cfg.SearchableFields) > 0 {
+		settings.SearchableAttributes = cfg.SearchableFields
+		assigned = true
+	}
+	if len(cfg.DisplayedFields) > 0 {
+		settings.DisplayedAttributes = cfg.DisplayedFields
+		assigned = true
+	}
+	if len(cfg.RankingRules) > 0 {
+		settings.RankingRules = cfg.RankingRules
+		assigned = true
+	}
+	if cfg.DistinctField != "" {
+		distinctField := cfg.DistinctField
+		settings.DistinctAttribute = &distinctField
+		assigned = true
+	}
+	if cfg.Synonyms != nil {
+		settings.Synonyms = cfg.Synonyms
+		assigned = true
+	}
+	if cfg.StopWords != nil {
+		settings.StopWords = cfg.StopWords
+		assigned = true
+	}
+	if cfg.TypoTolerance != nil {
+		settings.TypoTolerance = mergeTypoTolerance(live.TypoTolerance, cfg.TypoTolerance)
+		assigned = true
+	}
+	if cfg.Faceting != nil {
+		settings.Faceting = mergeFaceting(live.Faceting, cfg.Faceting)
+		assigned = true
+	}
+	if cfg.Pagination != nil {
+		settings.Pagination = cfg.Pagination
+		assigned = true
+	}
+	if cfg.ProximityPrecision != "" {
+		settings.ProximityPrecision = cfg.ProximityPrecision
+		assigned = true
+	}
+	if cfg.SeparatorTokens != nil {
+		settings.SeparatorTokens = cfg.SeparatorTokens
+		assigned = true
+	}
+	if cfg.NonSeparatorTokens != nil {
+		settings.NonSeparatorTokens = cfg.NonSeparatorTokens
+		assigned = true
+	}
+	if cfg.Dictionary != nil {
+		settings.Dictionary = cfg.Dictionary
+		assigned = true
+	}
+	if cfg.SearchCutoffMs > 0 {
+		settings.SearchCutoffMs = cfg.SearchCutoffMs
+		assigned = true
+	}
+	if cfg.LocalizedAttributes != nil {
+		settings.LocalizedAttributes = cfg.LocalizedAttributes
+		assigned = true
+	}
+	if cfg.Embedders != nil {
+		settings.Embedders = cfg.Embedders
+		assigned = true
+	}
+	if !assigned {
+		return nil
+	}
+	return settings
+}
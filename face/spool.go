@@ -0,0 +1,389 @@
+package face
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/lib"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * doc write-ahead spool
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - write request spooled into local file before enqueue
+ * - record acked after meili task succeed or failed
+ * - transport failed record kept and replayed on startup and in background
+ * - spool file `<tag>_<index>_<slot>.spool` locked by one doc,
+ *   first unlocked slot picked, same slot picked again after restart
+ */
+
+//spool record opt
+const (
+	spoolOptAdd       = "add"
+	spoolOptUpdate    = "update"
+	spoolOptDel       = "del"
+	spoolOptDelFilter = "delFilter"
+)
+
+//inter type
+type (
+	spoolRecord struct {
+		Opt    string          `json:"opt"`
+		DataId string          `json:"dataId,omitempty"`
+		Docs   json.RawMessage `json:"docs,omitempty"`
+		DocIds []string        `json:"docIds,omitempty"`
+		Filter interface{}     `json:"filter,omitempty"`
+	}
+)
+
+//replay pending spool records
+//return replayed records count
+func (f *Doc) ReplaySpool() (int, error) {
+	//check
+	if f.spool == nil {
+		return 0, errors.New("spool not enabled")
+	}
+	return f.spool.Replay(f.replaySpoolRecord)
+}
+
+//get pending spool records count
+func (f *Doc) GetSpoolPendingSize() int {
+	if f.spool == nil {
+		return 0
+	}
+	return f.spool.GetPendingSize()
+}
+
+/////////////////
+//private func
+/////////////////
+
+//send write request with spool
+func (f *Doc) sendWriteReq(
+	ctx context.Context,
+	req interface{},
+	dataId string) error {
+	var (
+		spoolSeq int64
+		future *WriteFuture
+		err error
+	)
+	//check
+	if f.IsClosed() {
+		return ErrDocClosed
+	}
+	if f.spoolErr != nil {
+		//spool configured but not opened
+		return f.spoolErr
+	}
+
+	//write through spool
+	switch v := req.(type) {
+	case syncDocReq:
+		{
+			spoolSeq, err = f.appendSpool(v, dataId)
+			v.spoolSeq = spoolSeq
+			future = v.future
+			req = v
+		}
+	case removeDocReq:
+		{
+			spoolSeq, err = f.appendSpool(v, dataId)
+			v.spoolSeq = spoolSeq
+			future = v.future
+			req = v
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	//track pending, rejected if closed by quit
+	if !f.pending.add(future) {
+		if spoolSeq > 0 {
+			f.spool.Ack(spoolSeq)
+		}
+		return ErrDocClosed
+	}
+
+	//send worker queue
+	_, err = f.worker.SendDataWithContext(ctx, req, dataId)
+	if err != nil {
+		//not accepted, no need replay
+		//finish future, counted as failed if quitting
+		f.metrics.incError(err)
+		future.finish(nil, nil, 0, err)
+		f.pending.remove(future)
+		if spoolSeq > 0 {
+			f.spool.Ack(spoolSeq)
+		}
+	}
+	return err
+}
+
+//finish write request
+//ack or release spool record, then finish future
+func (f *Doc) finishWriteReq(
+	future *WriteFuture,
+	spoolSeq int64,
+	taskInfo *meilisearch.TaskInfo,
+	task *meilisearch.Task,
+	attempts int,
+	err error) {
+	//ack or release spool record
+	if f.spool != nil && spoolSeq > 0 {
+		if f.needReplay(err) {
+			f.spool.Release(spoolSeq)
+		}else{
+			f.spool.Ack(spoolSeq)
+		}
+	}
+
+	//finish future
+	if future != nil {
+		future.finish(taskInfo, task, attempts, err)
+		f.pending.remove(future)
+	}
+}
+
+//check failed request need replay or not
+//only transport failed request need replay
+func (f *Doc) needReplay(err error) bool {
+	var (
+		taskErr *TaskError
+		apiErr *meilisearch.Error
+	)
+	if err == nil {
+		return false
+	}
+	if errors.As(err, &taskErr) ||
+		errors.Is(err, lib.ErrQueueDropped) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.As(err, &apiErr) &&
+		apiErr.StatusCode >= http.StatusBadRequest &&
+		apiErr.StatusCode < http.StatusInternalServerError &&
+		apiErr.StatusCode != http.StatusRequestTimeout &&
+		apiErr.StatusCode != http.StatusTooManyRequests {
+		//request rejected by meili
+		return false
+	}
+	return true
+}
+
+//append request into spool
+//return spool seq, 0 means spool not enabled
+func (f *Doc) appendSpool(
+	req interface{},
+	dataId string) (int64, error) {
+	var (
+		rec spoolRecord
+	)
+	//check
+	if f.spool == nil {
+		return 0, nil
+	}
+
+	//setup record
+	rec.DataId = dataId
+	switch v := req.(type) {
+	case syncDocReq:
+		{
+			docs, err := json.Marshal(v.obj)
+			if err != nil {
+				return 0, err
+			}
+			rec.Opt = spoolOptAdd
+			if v.isUpdate {
+				rec.Opt = spoolOptUpdate
+			}
+			rec.Docs = docs
+		}
+	case removeDocReq:
+		{
+			rec.Opt = spoolOptDel
+			rec.DocIds = v.docIds
+			if v.filter != nil {
+				rec.Opt = spoolOptDelFilter
+				rec.Filter = v.filter
+			}
+		}
+	default:
+		return 0, fmt.Errorf("invalid data type `%v`", v)
+	}
+
+	//encode and append
+	recBytes, err := json.Marshal(&rec)
+	if err != nil {
+		return 0, err
+	}
+	return f.spool.Append(recBytes)
+}
+
+//replay one spool record
+func (f *Doc) replaySpoolRecord(seq int64, data []byte) error {
+	var (
+		rec spoolRecord
+		req interface{}
+	)
+	//decode record
+	err := json.Unmarshal(data, &rec)
+	if err != nil {
+		//invalid record, drop it
+		log.Printf("doc.replaySpoolRecord, decode failed, err:%v\n", err.Error())
+		f.spool.Ack(seq)
+		return nil
+	}
+
+	//setup request
+	future := NewWriteFuture()
+	switch rec.Opt {
+	case spoolOptAdd, spoolOptUpdate:
+		req = syncDocReq{
+			obj: rec.Docs,
+			isUpdate: rec.Opt == spoolOptUpdate,
+			future: future,
+			spoolSeq: seq,
+		}
+	case spoolOptDel, spoolOptDelFilter:
+		req = removeDocReq{
+			docIds: rec.DocIds,
+			filter: rec.Filter,
+			future: future,
+			spoolSeq: seq,
+		}
+	default:
+		f.spool.Ack(seq)
+		return nil
+	}
+
+	//send worker queue
+	if !f.pending.add(future) {
+		return ErrDocClosed
+	}
+	_, err = f.worker.SendData(req, rec.DataId)
+	if err != nil {
+		future.finish(nil, nil, 0, err)
+		f.pending.remove(future)
+	}
+	return err
+}
+
+//gen spool file path
+//named by client tag, index name and slot,
+//keep spool files of different clients or processes apart in shared dir
+func (f *Doc) genSpoolPath(slot int) string {
+	parts := make([]string, 0, 3)
+	if f.indexConf.ClientTag != "" {
+		parts = append(parts, f.indexConf.ClientTag)
+	}
+	parts = append(parts, f.indexConf.IndexName, strconv.Itoa(slot))
+
+	//replace path separators
+	fileName := strings.Join(parts, "_") + ".spool"
+	fileName = strings.NewReplacer("/", "_", "\\", "_").Replace(fileName)
+	return filepath.Join(f.indexConf.SpoolDir, fileName)
+}
+
+//open spool and replay left records
+//first unlocked slot picked, start background replay
+func (f *Doc) openSpool() error {
+	var (
+		spool *lib.Spool
+		err error
+	)
+	//check
+	if f.indexConf.SpoolDir == "" {
+		return nil
+	}
+
+	//open spool file, locked by this doc
+	for slot := 0; slot < define.DefaultSpoolSlots; slot++ {
+		spool, err = lib.NewSpool(f.genSpoolPath(slot), f.indexConf.SpoolSync)
+		if !errors.Is(err, lib.ErrSpoolLocked) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	spool.SetCompactSize(f.indexConf.SpoolCompactSize)
+	f.spool = spool
+
+	//replay left records
+	replayed, err := f.spool.Replay(f.replaySpoolRecord)
+	if replayed > 0 {
+		log.Printf("doc.openSpool, index %v replayed %v records\n", f.indexConf.IndexName, replayed)
+	}
+
+	//replay released records in background
+	f.spoolCloseChan = make(chan bool, 1)
+	f.spoolDoneChan = make(chan bool)
+	go f.runSpoolReplay(f.spoolCloseChan, f.spoolDoneChan)
+	return err
+}
+
+//stop background replay and wait it quit
+func (f *Doc) stopSpoolReplay() {
+	if f.spoolCloseChan == nil {
+		return
+	}
+	close(f.spoolCloseChan)
+	<- f.spoolDoneChan
+	f.spoolCloseChan = nil
+}
+
+//run background replay process
+//replay released records, backoff doubled while records keep failing
+func (f *Doc) runSpoolReplay(closeChan, doneChan chan bool) {
+	minBackoff := time.Duration(define.DefaultSpoolReplayInterval) * time.Millisecond
+	maxBackoff := time.Duration(define.DefaultSpoolReplayMaxInterval) * time.Second
+	backoff := minBackoff
+	timer := time.NewTimer(backoff)
+	defer func() {
+		timer.Stop()
+		close(doneChan)
+	}()
+	for {
+		select {
+		case <- closeChan:
+			return
+		case <- timer.C:
+		}
+
+		//nothing to replay, reset backoff
+		if f.spool.GetReleasedSize() <= 0 {
+			backoff = minBackoff
+			timer.Reset(backoff)
+			continue
+		}
+
+		//replay and backoff
+		replayed, err := f.spool.Replay(f.replaySpoolRecord)
+		if err != nil {
+			log.Printf("doc.runSpoolReplay, index %v replay failed, err:%v\n",
+				f.indexConf.IndexName, err.Error())
+		}else if replayed > 0 {
+			log.Printf("doc.runSpoolReplay, index %v replayed %v records\n",
+				f.indexConf.IndexName, replayed)
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		timer.Reset(backoff)
+	}
+}
@@ -0,0 +1,444 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * task manager face
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - list, get, cancel and delete meili tasks
+ * - typed filters and pagination iterator
+ * - retention job for prune finished tasks
+ */
+
+//finished task statuses
+var finishedTaskStatuses = []meilisearch.TaskStatus{
+	meilisearch.TaskStatusSucceeded,
+	meilisearch.TaskStatusFailed,
+	meilisearch.TaskStatusCanceled,
+}
+
+//inter type
+type (
+	//task filter
+	TaskFilter struct {
+		UIDs           []int64
+		IndexNames     []string
+		Statuses       []meilisearch.TaskStatus
+		Types          []meilisearch.TaskType
+		CanceledBy     []int64
+		EnqueuedAfter  time.Time
+		EnqueuedBefore time.Time
+		StartedAfter   time.Time
+		StartedBefore  time.Time
+		FinishedAfter  time.Time //not used for cancel
+		FinishedBefore time.Time //not used for cancel
+	}
+
+	//last retention result
+	TaskRetentionResult struct {
+		RunAt        time.Time
+		DeletedTasks int64
+		Err          error
+	}
+)
+
+//face info
+type TaskManager struct {
+	client    meilisearch.ServiceManager //reference
+	retry     *retryPolicy
+	retention *conf.TaskRetentionConf
+	lastRun   TaskRetentionResult
+	closeChan chan bool
+	sync.RWMutex
+}
+
+//task iterator
+//fetch tasks page by page, from newest to oldest
+type TaskIterator struct {
+	ctx      context.Context
+	tasks    *TaskManager
+	filter   *TaskFilter
+	pageSize int64
+	from     int64
+	page     []meilisearch.Task
+	idx      int
+	done     bool
+	err      error
+}
+
+//construct
+func NewTaskManager(
+	client meilisearch.ServiceManager,
+	retryConf *conf.RetryConf) *TaskManager {
+	this := &TaskManager{
+		client: client,
+		retry: newRetryPolicy(retryConf),
+	}
+	return this
+}
+
+//list tasks by filter
+//limit and from used for pagination, from 0 means newest
+func (f *TaskManager) List(
+	filter *TaskFilter,
+	limit, from int64) (*meilisearch.TaskResult, error) {
+	return f.ListWithContext(context.Background(), filter, limit, from)
+}
+
+//list tasks by filter with context
+func (f *TaskManager) ListWithContext(
+	ctx context.Context,
+	filter *TaskFilter,
+	limit, from int64) (*meilisearch.TaskResult, error) {
+	var (
+		resp *meilisearch.TaskResult
+	)
+	//setup query
+	query := filter.toTasksQuery()
+	query.Limit = limit
+	query.From = from
+
+	//get tasks with retry
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		resp, subErr = f.client.GetTasksWithContext(ctx, query)
+		return subErr
+	})
+	return resp, err
+}
+
+//get iterator of tasks by filter
+func (f *TaskManager) Iter(
+	ctx context.Context,
+	filter *TaskFilter,
+	pageSize int64) *TaskIterator {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if pageSize <= 0 {
+		pageSize = define.DefaultPageSize
+	}
+	this := &TaskIterator{
+		ctx: ctx,
+		tasks: f,
+		filter: filter,
+		pageSize: pageSize,
+	}
+	return this
+}
+
+//get one task by uid
+func (f *TaskManager) Get(taskUID int64) (*meilisearch.Task, error) {
+	return f.GetWithContext(context.Background(), taskUID)
+}
+
+//get one task by uid with context
+func (f *TaskManager) GetWithContext(
+	ctx context.Context,
+	taskUID int64) (*meilisearch.Task, error) {
+	var (
+		task *meilisearch.Task
+	)
+	_, err := f.retry.do(ctx, func() error {
+		var subErr error
+		task, subErr = f.client.GetTaskWithContext(ctx, taskUID)
+		return subErr
+	})
+	return task, err
+}
+
+//get error of failed task
+//return nil if task not failed
+func (f *TaskManager) GetError(taskUID int64) (*TaskError, error) {
+	task, err := f.Get(taskUID)
+	if err != nil {
+		return nil, err
+	}
+	taskErr, _ := checkTaskStatus(task).(*TaskError)
+	return taskErr, nil
+}
+
+//cancel enqueued or processing tasks by filter
+//return finished cancelation task
+func (f *TaskManager) Cancel(filter *TaskFilter) (*meilisearch.Task, error) {
+	return f.CancelWithContext(context.Background(), filter)
+}
+
+//cancel tasks with context
+func (f *TaskManager) CancelWithContext(
+	ctx context.Context,
+	filter *TaskFilter) (*meilisearch.Task, error) {
+	//check
+	if filter.isEmpty() {
+		return nil, errors.New("empty filter not allowed")
+	}
+	query := filter.toCancelQuery()
+	return f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.CancelTasksWithContext(ctx, query)
+	})
+}
+
+//delete finished tasks by filter
+//return finished deletion task
+func (f *TaskManager) Delete(filter *TaskFilter) (*meilisearch.Task, error) {
+	return f.DeleteWithContext(context.Background(), filter)
+}
+
+//delete tasks with context
+func (f *TaskManager) DeleteWithContext(
+	ctx context.Context,
+	filter *TaskFilter) (*meilisearch.Task, error) {
+	//check
+	if filter.isEmpty() {
+		return nil, errors.New("empty filter not allowed")
+	}
+	query := filter.toDeleteQuery()
+	return f.runTask(ctx, func() (*meilisearch.TaskInfo, error) {
+		return f.client.DeleteTasksWithContext(ctx, query)
+	})
+}
+
+//prune finished tasks older than max age
+//return deleted tasks count
+func (f *TaskManager) Prune(
+	ctx context.Context,
+	maxAge time.Duration,
+	statuses ...meilisearch.TaskStatus) (int64, error) {
+	//check
+	if maxAge <= 0 {
+		return 0, errors.New("invalid parameter")
+	}
+	if len(statuses) <= 0 {
+		statuses = finishedTaskStatuses
+	}
+
+	//delete tasks
+	task, err := f.DeleteWithContext(ctx, &TaskFilter{
+		Statuses: statuses,
+		FinishedBefore: time.Now().Add(-maxAge),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return task.Details.DeletedTasks, nil
+}
+
+//start retention job
+//prune finished tasks periodically
+func (f *TaskManager) StartRetention(cfg *conf.TaskRetentionConf) error {
+	//check
+	if cfg == nil || cfg.MaxAge <= 0 {
+		return errors.New("invalid parameter")
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.closeChan != nil {
+		return errors.New("retention job already started")
+	}
+	f.retention = cfg
+	f.closeChan = make(chan bool, 1)
+	go f.runRetention(cfg, f.closeChan)
+	return nil
+}
+
+//stop retention job
+func (f *TaskManager) StopRetention() {
+	f.Lock()
+	defer f.Unlock()
+	if f.closeChan == nil {
+		return
+	}
+	close(f.closeChan)
+	f.closeChan = nil
+}
+
+//get last retention result
+func (f *TaskManager) GetLastRetention() TaskRetentionResult {
+	f.RLock()
+	defer f.RUnlock()
+	return f.lastRun
+}
+
+/////////////////
+//api for iterator
+/////////////////
+
+//move to next task
+//return false if no more tasks or failed
+func (f *TaskIterator) Next() bool {
+	//check
+	if f.err != nil {
+		return false
+	}
+
+	//pick from current page
+	if f.idx < len(f.page) {
+		f.idx++
+		return true
+	}
+	if f.done {
+		return false
+	}
+
+	//fetch next page
+	resp, err := f.tasks.ListWithContext(f.ctx, f.filter, f.pageSize, f.from)
+	if err != nil {
+		f.err = err
+		return false
+	}
+	f.page = resp.Results
+	f.idx = 0
+	f.from = resp.Next
+	if resp.Next <= 0 || int64(len(resp.Results)) < f.pageSize {
+		f.done = true
+	}
+	if len(f.page) <= 0 {
+		return false
+	}
+	f.idx++
+	return true
+}
+
+//get current task
+func (f *TaskIterator) Task() *meilisearch.Task {
+	if f.idx <= 0 || f.idx > len(f.page) {
+		return nil
+	}
+	return &f.page[f.idx - 1]
+}
+
+//get iterator error
+func (f *TaskIterator) Err() error {
+	return f.err
+}
+
+/////////////////
+//private func
+/////////////////
+
+//run retention job
+func (f *TaskManager) runRetention(
+	cfg *conf.TaskRetentionConf,
+	closeChan chan bool) {
+	var (
+		m any = nil
+	)
+	//defer
+	defer func() {
+		if err := recover(); err != m {
+			log.Printf("taskManager.runRetention panic, err:%v\n", err)
+		}
+	}()
+
+	//setup ticker
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Duration(define.DefaultTaskRetentionInterval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	//loop
+	for {
+		select {
+		case <- ticker.C:
+			{
+				deleted, err := f.Prune(context.Background(), cfg.MaxAge, cfg.Statuses...)
+				if err != nil {
+					log.Printf("taskManager.runRetention, prune failed, err:%v\n", err.Error())
+				}
+				f.Lock()
+				f.lastRun = TaskRetentionResult{
+					RunAt: time.Now(),
+					DeletedTasks: deleted,
+					Err: err,
+				}
+				f.Unlock()
+			}
+		case <- closeChan:
+			return
+		}
+	}
+}
+
+//submit task and wait with retry
+func (f *TaskManager) runTask(
+	ctx context.Context,
+	submit func() (*meilisearch.TaskInfo, error)) (*meilisearch.Task, error) {
+	interval := time.Duration(define.DefaultTaskInterval) * time.Millisecond
+	_, finalTask, _, err := f.retry.runTask(ctx, f.client, interval, submit)
+	return finalTask, err
+}
+
+//check filter is empty or not
+func (t *TaskFilter) isEmpty() bool {
+	return t == nil ||
+		(len(t.UIDs) <= 0 && len(t.IndexNames) <= 0 &&
+			len(t.Statuses) <= 0 && len(t.Types) <= 0 &&
+			len(t.CanceledBy) <= 0 &&
+			t.EnqueuedAfter.IsZero() && t.EnqueuedBefore.IsZero() &&
+			t.StartedAfter.IsZero() && t.StartedBefore.IsZero() &&
+			t.FinishedAfter.IsZero() && t.FinishedBefore.IsZero())
+}
+
+//convert to tasks query
+func (t *TaskFilter) toTasksQuery() *meilisearch.TasksQuery {
+	if t == nil {
+		return &meilisearch.TasksQuery{}
+	}
+	return &meilisearch.TasksQuery{
+		UIDS: t.UIDs,
+		IndexUIDS: t.IndexNames,
+		Statuses: t.Statuses,
+		Types: t.Types,
+		CanceledBy: t.CanceledBy,
+		AfterEnqueuedAt: t.EnqueuedAfter,
+		BeforeEnqueuedAt: t.EnqueuedBefore,
+		AfterStartedAt: t.StartedAfter,
+		BeforeStartedAt: t.StartedBefore,
+		AfterFinishedAt: t.FinishedAfter,
+		BeforeFinishedAt: t.FinishedBefore,
+	}
+}
+
+//convert to cancel tasks query
+func (t *TaskFilter) toCancelQuery() *meilisearch.CancelTasksQuery {
+	return &meilisearch.CancelTasksQuery{
+		UIDS: t.UIDs,
+		IndexUIDS: t.IndexNames,
+		Statuses: t.Statuses,
+		Types: t.Types,
+		AfterEnqueuedAt: t.EnqueuedAfter,
+		BeforeEnqueuedAt: t.EnqueuedBefore,
+		AfterStartedAt: t.StartedAfter,
+		BeforeStartedAt: t.StartedBefore,
+	}
+}
+
+//convert to delete tasks query
+func (t *TaskFilter) toDeleteQuery() *meilisearch.DeleteTasksQuery {
+	return &meilisearch.DeleteTasksQuery{
+		UIDS: t.UIDs,
+		IndexUIDS: t.IndexNames,
+		Statuses: t.Statuses,
+		Types: t.Types,
+		CanceledBy: t.CanceledBy,
+		AfterEnqueuedAt: t.EnqueuedAfter,
+		BeforeEnqueuedAt: t.EnqueuedBefore,
+		AfterStartedAt: t.StartedAfter,
+		BeforeStartedAt: t.StartedBefore,
+		AfterFinishedAt: t.FinishedAfter,
+		BeforeFinishedAt: t.FinishedBefore,
+	}
+}
@@ -0,0 +1,561 @@
+package face
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * index export and import
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - ndjson: first line is settings, then one doc per line
+ * - json: {"settings":{..},"documents":[..]}
+ * - csv: docs only, nested values json encoded, number type inferred by first page
+ * - gzip optional for export, detected automatically for import
+ */
+
+//transfer format
+type TransferFormat string
+
+const (
+	FormatNdjson TransferFormat = "ndjson"
+	FormatJson   TransferFormat = "json"
+	FormatCsv    TransferFormat = "csv"
+)
+
+//settings key of export data
+const transferSettingsKey = "_tinymeiliSettings"
+
+//inter type
+type (
+	//transfer options
+	TransferOptions struct {
+		Gzip         bool                    //gzip export data
+		BatchSize    int                     //docs of one import batch
+		SkipSettings bool                    //skip export or import settings
+		Progress     func(done, total int64) //total is 0 if unknown
+	}
+
+	//line counting reader for import progress
+	countReader struct {
+		reader   io.Reader
+		lines    int64
+		progress func(done, total int64)
+	}
+)
+
+//export settings and all docs into writer
+func (f *Index) Export(
+	ctx context.Context,
+	w io.Writer,
+	format TransferFormat,
+	opts ...*TransferOptions) error {
+	var (
+		err error
+	)
+	//check
+	if w == nil {
+		return errors.New("invalid parameter")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	opt := genTransferOptions(opts)
+
+	//setup gzip writer
+	var gzipWriter *gzip.Writer
+	if opt.Gzip {
+		gzipWriter = gzip.NewWriter(w)
+		w = gzipWriter
+	}
+	buffWriter := bufio.NewWriter(w)
+
+	//get settings
+	var settings *meilisearch.Settings
+	if !opt.SkipSettings && format != FormatCsv {
+		settings, err = f.GetSettingsWithContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	//write docs by format
+	iter := f.GetDoc().Scan(ctx, nil)
+	defer iter.Close()
+	switch format {
+	case FormatNdjson:
+		err = f.exportNdjson(buffWriter, iter, settings, opt)
+	case FormatJson:
+		err = f.exportJson(buffWriter, iter, settings, opt)
+	case FormatCsv:
+		err = f.exportCsv(ctx, buffWriter, iter, opt)
+	default:
+		err = fmt.Errorf("unsupported format `%v`", format)
+	}
+	if err != nil {
+		return err
+	}
+	err = buffWriter.Flush()
+	if err == nil && gzipWriter != nil {
+		err = gzipWriter.Close()
+	}
+	return err
+}
+
+//import settings and docs from reader
+//sync opt, wait until all tasks finished
+//rejected while rebuilding, imported docs not captured for replay
+func (f *Index) Import(
+	ctx context.Context,
+	r io.Reader,
+	format TransferFormat,
+	opts ...*TransferOptions) error {
+	var (
+		err error
+	)
+	//check
+	if r == nil {
+		return errors.New("invalid parameter")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if atomic.LoadInt32(&f.rebuilding) != 0 {
+		return ErrIndexRebuilding
+	}
+	opt := genTransferOptions(opts)
+
+	//detect gzip data
+	buffReader := bufio.NewReader(r)
+	magic, _ := buffReader.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, subErr := gzip.NewReader(buffReader)
+		if subErr != nil {
+			return subErr
+		}
+		defer gzipReader.Close()
+		buffReader = bufio.NewReader(gzipReader)
+	}
+
+	//import docs by format
+	var tasks []meilisearch.TaskInfo
+	switch format {
+	case FormatNdjson:
+		tasks, err = f.importNdjson(ctx, buffReader, opt)
+	case FormatJson:
+		tasks, err = f.importJson(ctx, buffReader, opt)
+	case FormatCsv:
+		{
+			counter := &countReader{reader: buffReader, lines: -1, progress: opt.Progress}
+			tasks, err = f.index.AddDocumentsCsvFromReaderInBatchesWithContext(ctx,
+				counter, opt.BatchSize, &meilisearch.CsvDocumentsQuery{
+					PrimaryKey: f.indexConf.PrimaryKey,
+				})
+		}
+	default:
+		err = fmt.Errorf("unsupported format `%v`", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	//wait all tasks
+	for _, task := range tasks {
+		_, err = waitForTask(ctx, f.client, task.TaskUID, f.getTimeout())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//export as ndjson
+func (f *Index) exportNdjson(
+	w *bufio.Writer,
+	iter *DocIterator,
+	settings *meilisearch.Settings,
+	opt *TransferOptions) error {
+	//write settings line
+	encoder := json.NewEncoder(w)
+	if settings != nil {
+		err := encoder.Encode(map[string]interface{}{
+			transferSettingsKey: settings,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	//write raw doc lines, keep number precision
+	done := int64(0)
+	line := bytes.NewBuffer(nil)
+	for iter.Next() {
+		line.Reset()
+		err := json.Compact(line, iter.Raw())
+		if err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		if _, err = w.Write(line.Bytes()); err != nil {
+			return err
+		}
+		done++
+		notifyProgress(opt, done, iter.Total())
+	}
+	return iter.Err()
+}
+
+//export as json
+func (f *Index) exportJson(
+	w *bufio.Writer,
+	iter *DocIterator,
+	settings *meilisearch.Settings,
+	opt *TransferOptions) error {
+	//write settings
+	w.WriteString("{")
+	if settings != nil {
+		settingsBytes, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		w.WriteString(`"settings":`)
+		w.Write(settingsBytes)
+		w.WriteString(",")
+	}
+
+	//write docs
+	w.WriteString(`"documents":[`)
+	done := int64(0)
+	for iter.Next() {
+		if done > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n")
+		w.Write(iter.Raw())
+		done++
+		notifyProgress(opt, done, iter.Total())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	_, err := w.WriteString("\n]}\n")
+	return err
+}
+
+//export as csv
+func (f *Index) exportCsv(
+	ctx context.Context,
+	w *bufio.Writer,
+	iter *DocIterator,
+	opt *TransferOptions) error {
+	//get all fields
+	stats, err := f.GetStatusWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(stats.FieldDistribution))
+	for field := range stats.FieldDistribution {
+		if field == f.indexConf.PrimaryKey {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	if f.indexConf.PrimaryKey != "" {
+		fields = append([]string{f.indexConf.PrimaryKey}, fields...)
+	}
+
+	//pick first page for inferring number fields
+	firstPage := make([]map[string]interface{}, 0)
+	for len(firstPage) < define.DefaultScanPageSize && iter.Next() {
+		firstPage = append(firstPage, iter.Doc())
+	}
+	if err = iter.Err(); err != nil {
+		return err
+	}
+
+	//write header
+	csvWriter := csv.NewWriter(w)
+	header := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if isNumberField(firstPage, field) {
+			header = append(header, field + ":number")
+		}else{
+			header = append(header, field)
+		}
+	}
+	err = csvWriter.Write(header)
+	if err != nil {
+		return err
+	}
+
+	//write rows
+	done := int64(0)
+	writeRow := func(doc map[string]interface{}) error {
+		row := make([]string, 0, len(fields))
+		for _, field := range fields {
+			row = append(row, formatCsvValue(doc[field]))
+		}
+		done++
+		notifyProgress(opt, done, iter.Total())
+		return csvWriter.Write(row)
+	}
+	for _, doc := range firstPage {
+		if err = writeRow(doc); err != nil {
+			return err
+		}
+	}
+	for iter.Next() {
+		if err = writeRow(iter.Doc()); err != nil {
+			return err
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return err
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+//import ndjson data
+func (f *Index) importNdjson(
+	ctx context.Context,
+	r *bufio.Reader,
+	opt *TransferOptions) ([]meilisearch.TaskInfo, error) {
+	//check first line is settings or not
+	firstLine, err := r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	settingsMap := map[string]*meilisearch.Settings{}
+	if json.Unmarshal(firstLine, &settingsMap) == nil && settingsMap[transferSettingsKey] != nil {
+		if !opt.SkipSettings {
+			err = f.UpdateSettingsWithContext(ctx, settingsMap[transferSettingsKey])
+			if err != nil {
+				return nil, err
+			}
+		}
+		firstLine = nil
+	}
+
+	//stream docs
+	counter := &countReader{
+		reader: io.MultiReader(bytes.NewReader(firstLine), r),
+		progress: opt.Progress,
+	}
+	return f.index.AddDocumentsNdjsonFromReaderInBatchesWithContext(ctx,
+		counter, opt.BatchSize, f.indexConf.PrimaryKey)
+}
+
+//import json data
+//settings before docs applied first, docs converted into ndjson stream
+func (f *Index) importJson(
+	ctx context.Context,
+	r *bufio.Reader,
+	opt *TransferOptions) ([]meilisearch.TaskInfo, error) {
+	var (
+		settings *meilisearch.Settings
+		decodeErr error
+		hasDocs bool
+	)
+	decoder := json.NewDecoder(r)
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	//decode keys until documents
+	for !hasDocs && decoder.More() {
+		key, err := f.decodeJsonKey(decoder, nil, &settings)
+		if err != nil {
+			return nil, err
+		}
+		hasDocs = key == "documents"
+		if settings != nil && !opt.SkipSettings {
+			err = f.UpdateSettingsWithContext(ctx, settings)
+			if err != nil {
+				return nil, err
+			}
+			settings = nil
+		}
+	}
+	if !hasDocs {
+		return nil, nil
+	}
+
+	//decode docs and rest keys in background
+	pipeReader, pipeWriter := io.Pipe()
+	decodeDone := make(chan bool)
+	go func() {
+		defer close(decodeDone)
+		decodeErr = f.decodeJsonDocs(decoder, pipeWriter)
+		for decodeErr == nil && decoder.More() {
+			_, decodeErr = f.decodeJsonKey(decoder, pipeWriter, &settings)
+		}
+		pipeWriter.CloseWithError(decodeErr)
+	}()
+
+	//stream docs
+	counter := &countReader{reader: pipeReader, progress: opt.Progress}
+	tasks, err := f.index.AddDocumentsNdjsonFromReaderInBatchesWithContext(ctx,
+		counter, opt.BatchSize, f.indexConf.PrimaryKey)
+	pipeReader.CloseWithError(io.ErrClosedPipe)
+	<- decodeDone
+	if err != nil {
+		return nil, err
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	//apply settings after docs
+	if settings != nil && !opt.SkipSettings {
+		err = f.UpdateSettingsWithContext(ctx, settings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tasks, nil
+}
+
+//decode one key of json transfer data
+//docs written as ndjson lines if writer assigned
+func (f *Index) decodeJsonKey(
+	decoder *json.Decoder,
+	w io.Writer,
+	settings **meilisearch.Settings) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", err
+	}
+	key, _ := token.(string)
+	switch key {
+	case "settings":
+		{
+			*settings = &meilisearch.Settings{}
+			err = decoder.Decode(*settings)
+		}
+	case "documents":
+		{
+			if w != nil {
+				err = f.decodeJsonDocs(decoder, w)
+			}
+		}
+	default:
+		{
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+	}
+	return key, err
+}
+
+//decode docs array, write docs as ndjson lines
+func (f *Index) decodeJsonDocs(
+	decoder *json.Decoder,
+	w io.Writer) error {
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		doc := json.RawMessage{}
+		if err := decoder.Decode(&doc); err != nil {
+			return err
+		}
+		line := bytes.NewBuffer(nil)
+		if err := json.Compact(line, doc); err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		if _, err := w.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+//read and count lines
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && r.progress != nil {
+		lines := int64(bytes.Count(p[:n], []byte{'\n'}))
+		if lines > 0 {
+			done := atomic.AddInt64(&r.lines, lines)
+			if done > 0 {
+				r.progress(done, 0)
+			}
+		}
+	}
+	return n, err
+}
+
+//gen transfer options
+func genTransferOptions(opts []*TransferOptions) *TransferOptions {
+	opt := &TransferOptions{}
+	if opts != nil && len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = define.DefaultTransferBatchSize
+	}
+	return opt
+}
+
+//notify progress
+func notifyProgress(opt *TransferOptions, done, total int64) {
+	if opt.Progress != nil {
+		opt.Progress(done, total)
+	}
+}
+
+//check field values of docs are all numbers
+func isNumberField(docs []map[string]interface{}, field string) bool {
+	found := false
+	for _, doc := range docs {
+		v, ok := doc[field]
+		if !ok || v == nil {
+			continue
+		}
+		if _, isNum := v.(json.Number); !isNum {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+//format csv value
+func formatCsvValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	valBytes, _ := json.Marshal(v)
+	return string(valBytes)
+}
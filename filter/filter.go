@@ -0,0 +1,325 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * type-safe filter builder
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - comparison, IN, TO, EXISTS, IS NULL, IS EMPTY, CONTAINS, STARTS WITH
+ * - NOT, AND and OR groups, array-of-arrays form
+ * - string values quoted and escaped
+ * - raw and custom expressions wrapped with brackets when combined
+ */
+
+//plain field name rule, other names will be quoted
+var plainFieldRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+
+//filter expression
+type Expr interface {
+	String() string
+}
+
+//inter expression types
+type (
+	rawExpr   string //atomic expression built by this package
+	userExpr  string //raw expression of caller, maybe compound
+	notExpr   struct{ expr Expr }
+	groupExpr struct {
+		op    string
+		exprs []Expr
+	}
+)
+
+func (e rawExpr) String() string {
+	return string(e)
+}
+
+func (e userExpr) String() string {
+	return string(e)
+}
+
+func (e notExpr) String() string {
+	if e.expr == nil {
+		return ""
+	}
+	return "NOT " + wrap(e.expr)
+}
+
+func (e groupExpr) String() string {
+	parts := make([]string, 0, len(e.exprs))
+	for _, expr := range e.exprs {
+		if expr == nil {
+			continue
+		}
+		part := wrap(expr)
+		if part == "" {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " "+e.op+" ")
+}
+
+//raw expression, caller should escape values
+//wrapped with brackets when combined by NOT, AND or OR
+func Raw(expr string) Expr {
+	return userExpr(strings.TrimSpace(expr))
+}
+
+//field = value
+func Eq(field string, value interface{}) Expr {
+	return compare(field, "=", value)
+}
+
+//field != value
+func Ne(field string, value interface{}) Expr {
+	return compare(field, "!=", value)
+}
+
+//field > value
+func Gt(field string, value interface{}) Expr {
+	return compare(field, ">", value)
+}
+
+//field >= value
+func Gte(field string, value interface{}) Expr {
+	return compare(field, ">=", value)
+}
+
+//field < value
+func Lt(field string, value interface{}) Expr {
+	return compare(field, "<", value)
+}
+
+//field <= value
+func Lte(field string, value interface{}) Expr {
+	return compare(field, "<=", value)
+}
+
+//field IN [values]
+func In(field string, values ...interface{}) Expr {
+	return rawExpr(fmt.Sprintf("%v IN [%v]", Field(field), joinValues(values)))
+}
+
+//field NOT IN [values]
+func NotIn(field string, values ...interface{}) Expr {
+	return rawExpr(fmt.Sprintf("%v NOT IN [%v]", Field(field), joinValues(values)))
+}
+
+//field IN [values] for string values
+func InStrings(field string, values ...string) Expr {
+	vals := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		vals = append(vals, v)
+	}
+	return In(field, vals...)
+}
+
+//field from TO to
+func Range(field string, from, to interface{}) Expr {
+	return rawExpr(fmt.Sprintf("%v %v TO %v", Field(field), Value(from), Value(to)))
+}
+
+//field EXISTS
+func Exists(field string) Expr {
+	return rawExpr(Field(field) + " EXISTS")
+}
+
+//field NOT EXISTS
+func NotExists(field string) Expr {
+	return rawExpr(Field(field) + " NOT EXISTS")
+}
+
+//field IS NULL
+func IsNull(field string) Expr {
+	return rawExpr(Field(field) + " IS NULL")
+}
+
+//field IS NOT NULL
+func IsNotNull(field string) Expr {
+	return rawExpr(Field(field) + " IS NOT NULL")
+}
+
+//field IS EMPTY
+func IsEmpty(field string) Expr {
+	return rawExpr(Field(field) + " IS EMPTY")
+}
+
+//field IS NOT EMPTY
+func IsNotEmpty(field string) Expr {
+	return rawExpr(Field(field) + " IS NOT EMPTY")
+}
+
+//field CONTAINS value
+func Contains(field string, value string) Expr {
+	return rawExpr(fmt.Sprintf("%v CONTAINS %v", Field(field), Quote(value)))
+}
+
+//field NOT CONTAINS value
+func NotContains(field string, value string) Expr {
+	return rawExpr(fmt.Sprintf("%v NOT CONTAINS %v", Field(field), Quote(value)))
+}
+
+//field STARTS WITH value
+func StartsWith(field string, value string) Expr {
+	return rawExpr(fmt.Sprintf("%v STARTS WITH %v", Field(field), Quote(value)))
+}
+
+//field NOT STARTS WITH value
+func NotStartsWith(field string, value string) Expr {
+	return rawExpr(fmt.Sprintf("%v NOT STARTS WITH %v", Field(field), Quote(value)))
+}
+
+//NOT (expr)
+func Not(expr Expr) Expr {
+	return notExpr{expr: expr}
+}
+
+//(expr) AND (expr)
+func And(exprs ...Expr) Expr {
+	return groupExpr{op: "AND", exprs: exprs}
+}
+
+//(expr) OR (expr)
+func Or(exprs ...Expr) Expr {
+	return groupExpr{op: "OR", exprs: exprs}
+}
+
+//array-of-arrays form
+//outer groups joined by AND, expressions of one group joined by OR
+func Array(groups ...[]Expr) [][]string {
+	result := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		subResult := make([]string, 0, len(group))
+		for _, expr := range group {
+			if expr == nil || expr.String() == "" {
+				continue
+			}
+			subResult = append(subResult, expr.String())
+		}
+		if len(subResult) > 0 {
+			result = append(result, subResult)
+		}
+	}
+	return result
+}
+
+//convert filter into meili filter value
+//Expr -> string, []Expr -> []string, others keep origin
+func Build(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Expr:
+		return val.String()
+	case []Expr:
+		{
+			result := make([]string, 0, len(val))
+			for _, expr := range val {
+				if expr == nil {
+					continue
+				}
+				result = append(result, expr.String())
+			}
+			return result
+		}
+	}
+	return v
+}
+
+//format field name, quoted if has special chars
+func Field(field string) string {
+	if plainFieldRegexp.MatchString(field) {
+		return field
+	}
+	return Quote(field)
+}
+
+//format value, strings quoted and escaped, time as unix seconds
+func Value(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return `""`
+	case string:
+		return Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return strconv.FormatInt(v.Unix(), 10)
+	case fmt.Stringer:
+		return Quote(v.String())
+	}
+	return Quote(fmt.Sprintf("%v", value))
+}
+
+//quote string value, escape backslash and double quote
+func Quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+/////////////////
+//private func
+/////////////////
+
+//gen compare expression
+func compare(field, op string, value interface{}) Expr {
+	return rawExpr(fmt.Sprintf("%v %v %v", Field(field), op, Value(value)))
+}
+
+//join values for IN
+func joinValues(values []interface{}) string {
+	vals := make([]string, 0, len(values))
+	for _, v := range values {
+		vals = append(vals, Value(v))
+	}
+	return strings.Join(vals, ", ")
+}
+
+//wrap non-atomic expression with brackets
+//raw and custom expressions are treated as non-atomic
+func wrap(expr Expr) string {
+	str := expr.String()
+	if str == "" {
+		return str
+	}
+	switch v := expr.(type) {
+	case rawExpr, notExpr:
+		return str
+	case groupExpr:
+		if len(v.exprs) <= 1 {
+			return str
+		}
+	}
+	return "(" + str + ")"
+}
@@ -0,0 +1,173 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andyzhou/tinymeili/conf"
+)
+
+/*
+ * geo search helper
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - radius, bounding box and polygon filters
+ * - distance sort
+ * - `_geo` point and `_geoDistance` of hits
+ */
+
+//geo fields
+const (
+	FieldGeo         = "_geo"
+	FieldGeoDistance = "_geoDistance"
+)
+
+//inter type
+type (
+	//geo point
+	GeoPoint struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	}
+
+	//embed into doc struct to carry `_geo`
+	//distance decoded from hits sorted or filtered by geo
+	GeoDoc struct {
+		Geo         *GeoPoint `json:"_geo,omitempty"`
+		GeoDistance *float64  `json:"_geoDistance,omitempty"` //meters, read only
+	}
+)
+
+//new geo point
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{
+		Lat: lat,
+		Lng: lng,
+	}
+}
+
+//check point is valid
+func (p *GeoPoint) Check() error {
+	if p == nil {
+		return errors.New("invalid geo point")
+	}
+	if p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("invalid latitude %v", p.Lat)
+	}
+	if p.Lng < -180 || p.Lng > 180 {
+		return fmt.Errorf("invalid longitude %v", p.Lng)
+	}
+	return nil
+}
+
+//get distance in meters, return false if not in hit
+func (d *GeoDoc) GetDistance() (float64, bool) {
+	if d.GeoDistance == nil {
+		return 0, false
+	}
+	return *d.GeoDistance, true
+}
+
+//gen radius filter, distance in meters
+//like `_geoRadius(lat, lng, distance)`
+func Radius(center GeoPoint, meters float64) string {
+	return fmt.Sprintf("_geoRadius(%v, %v, %v)",
+		formatFloat(center.Lat), formatFloat(center.Lng), formatFloat(meters))
+}
+
+//gen bounding box filter
+//like `_geoBoundingBox([lat, lng], [lat, lng])`
+func BoundingBox(topRight, bottomLeft GeoPoint) string {
+	return fmt.Sprintf("_geoBoundingBox(%v, %v)",
+		formatPoint(topRight), formatPoint(bottomLeft))
+}
+
+//gen polygon filter, at least three points
+//like `_geoPolygon([lat, lng], [lat, lng], [lat, lng])`
+func Polygon(points ...GeoPoint) (string, error) {
+	//check
+	if len(points) < 3 {
+		return "", errors.New("polygon need at least three points")
+	}
+	vals := make([]string, 0, len(points))
+	for _, point := range points {
+		vals = append(vals, formatPoint(point))
+	}
+	return fmt.Sprintf("_geoPolygon(%v)", strings.Join(vals, ", ")), nil
+}
+
+//gen distance sort
+//nearest first if asc is true
+func SortByDistance(point GeoPoint, asc bool) string {
+	order := "desc"
+	if asc {
+		order = "asc"
+	}
+	return fmt.Sprintf("_geoPoint(%v, %v):%v",
+		formatFloat(point.Lat), formatFloat(point.Lng), order)
+}
+
+//get distance of raw hit, return false if not in hit
+func GetHitDistance(hit interface{}) (float64, bool) {
+	hitMap, ok := hit.(map[string]interface{})
+	if !ok || hitMap == nil {
+		return 0, false
+	}
+	switch v := hitMap[FieldGeoDistance].(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+//check `_geo` is filterable in index config
+func CheckFilterable(indexConf *conf.IndexConf) error {
+	if indexConf == nil {
+		return errors.New("invalid index config")
+	}
+	if !hasField(indexConf.FilterableFields, FieldGeo) {
+		return fmt.Errorf("`%v` not filterable in index %v", FieldGeo, indexConf.IndexName)
+	}
+	return nil
+}
+
+//check `_geo` is sortable in index config
+func CheckSortable(indexConf *conf.IndexConf) error {
+	if indexConf == nil {
+		return errors.New("invalid index config")
+	}
+	if !hasField(indexConf.SortableFields, FieldGeo) {
+		return fmt.Errorf("`%v` not sortable in index %v", FieldGeo, indexConf.IndexName)
+	}
+	return nil
+}
+
+/////////////////
+//private func
+/////////////////
+
+//format point as `[lat, lng]`
+func formatPoint(point GeoPoint) string {
+	return fmt.Sprintf("[%v, %v]", formatFloat(point.Lat), formatFloat(point.Lng))
+}
+
+//format float without exponent
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+//check field in list
+func hasField(fields []string, field string) bool {
+	for _, v := range fields {
+		if v == field {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,48 @@
 package lib
 
+import "errors"
+
 const (
 	DefaultWorkers   = 3
 	DefaultQueueSize = 1024
 	DefaultAsciiSize = 2
-)
\ No newline at end of file
+	DefaultVirtualNodes = 160
+	DefaultSpoolCompactSize = 4 * 1024 * 1024 //4MB of acked bytes
+)
+
+//queue overflow policy
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota //block until queue has space or timeout, default
+	OverflowFailFast                         //return ErrQueueFull immediately
+	OverflowDropOldest                       //drop oldest queued data for new one
+	OverflowSpill                            //spill into overflow buffer
+)
+
+//queue errors
+var (
+	ErrQueueFull    = errors.New("queue is full")
+	ErrQueueDropped = errors.New("queue data dropped")
+)
+
+//spool errors
+var (
+	ErrSpoolLocked = errors.New("spool file locked by other process")
+)
+
+//get policy name
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowFailFast:
+		return "failFast"
+	case OverflowDropOldest:
+		return "dropOldest"
+	case OverflowSpill:
+		return "spill"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package lib
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+ * file lock for unix
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ */
+
+//lock file exclusively, non-blocking
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrSpoolLocked
+	}
+	return err
+}
+
+//unlock file
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package lib
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+/*
+ * file lock for windows
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ */
+
+const (
+	lockFileFailImmediately = 0x01
+	lockFileExclusiveLock   = 0x02
+	errLockViolation        = syscall.Errno(33)
+)
+
+var (
+	procLockFileEx   = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+	procUnlockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("UnlockFileEx")
+)
+
+//lock file exclusively, non-blocking
+func lockFile(file *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	ret, _, err := procLockFileEx.Call(file.Fd(),
+		uintptr(lockFileExclusiveLock|lockFileFailImmediately),
+		0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if ret != 0 {
+		return nil
+	}
+	if err == errLockViolation {
+		return ErrSpoolLocked
+	}
+	return err
+}
+
+//unlock file
+func unlockFile(file *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	ret, _, err := procUnlockFileEx.Call(file.Fd(),
+		0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if ret != 0 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,271 @@
+package lib
+
+import (
+	"encoding/json"
+	"expvar"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * metrics sink
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - small sink interface for counters, gauges and histograms
+ * - expvar based default sink, published under `tinymeili`
+ */
+
+//metric names
+const (
+	MetricQueueDepth     = "queue_depth"       //gauge, queued data size
+	MetricQueueEnqueue   = "queue_enqueue"     //counter, accepted data
+	MetricQueueDequeue   = "queue_dequeue"     //counter, processed data
+	MetricQueueRejected  = "queue_rejected"    //counter, rejected by overflow policy
+	MetricQueueDropped   = "queue_dropped"     //counter, dropped by overflow policy
+	MetricWriteBatchSize = "write_batch_size"  //histogram, docs of one write call
+	MetricTaskLatency    = "task_latency_ms"   //histogram, submit until task finished
+	MetricTaskStatus     = "task_status"       //counter, by status label
+	MetricSearchLatency  = "search_latency_ms" //histogram, one search call
+	MetricErrors         = "errors"            //counter, by code label
+)
+
+//metric labels
+const (
+	LabelClient = "client"
+	LabelIndex  = "index"
+	LabelWorker = "worker"
+	LabelStatus = "status"
+	LabelCode   = "code"
+)
+
+//default histogram buckets
+var (
+	DefaultLatencyBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	DefaultSizeBuckets    = []float64{1, 5, 10, 50, 100, 500, 1000, 5000, 10000}
+)
+
+//metrics sink interface
+type MetricsSink interface {
+	IncCounter(name string, value int64, labels map[string]string)
+	SetGauge(name string, value float64, labels map[string]string)
+	Observe(name string, value float64, labels map[string]string)
+}
+
+//global variable
+var (
+	_expvarSink *ExpvarSink
+	_expvarSinkOnce sync.Once
+)
+
+//////////////////
+//nop sink
+//////////////////
+
+//nop sink, used for disable metrics
+type NopSink struct {}
+
+func (f NopSink) IncCounter(name string, value int64, labels map[string]string) {}
+func (f NopSink) SetGauge(name string, value float64, labels map[string]string) {}
+func (f NopSink) Observe(name string, value float64, labels map[string]string) {}
+
+//////////////////
+//labeled sink
+//////////////////
+
+//labeled sink, fixed labels merged into each metric
+type LabeledSink struct {
+	sink   MetricsSink
+	labels map[string]string
+}
+
+//construct
+//return nil if sink is nil
+func NewLabeledSink(
+	sink MetricsSink,
+	labels map[string]string) MetricsSink {
+	//check
+	if sink == nil {
+		return nil
+	}
+	//self init
+	this := &LabeledSink{
+		sink: sink,
+		labels: labels,
+	}
+	return this
+}
+
+func (f *LabeledSink) IncCounter(name string, value int64, labels map[string]string) {
+	f.sink.IncCounter(name, value, f.merge(labels))
+}
+
+func (f *LabeledSink) SetGauge(name string, value float64, labels map[string]string) {
+	f.sink.SetGauge(name, value, f.merge(labels))
+}
+
+func (f *LabeledSink) Observe(name string, value float64, labels map[string]string) {
+	f.sink.Observe(name, value, f.merge(labels))
+}
+
+//merge fixed and input labels
+func (f *LabeledSink) merge(labels map[string]string) map[string]string {
+	if len(labels) <= 0 {
+		return f.labels
+	}
+	merged := make(map[string]string, len(f.labels) + len(labels))
+	for k, v := range f.labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+//////////////////
+//expvar sink
+//////////////////
+
+//expvar sink
+//metric published as `tinymeili` map, name -> labels -> value
+type ExpvarSink struct {
+	root       *expvar.Map
+	histograms map[string]*expvarHistogram //name|labels -> histogram
+	sync.Mutex
+}
+
+//histogram for expvar
+type expvarHistogram struct {
+	buckets []float64
+	counts  []int64 //last one for +Inf
+	count   int64
+	sum     float64
+	sync.Mutex
+}
+
+//get single instance
+func GetExpvarSink() *ExpvarSink {
+	_expvarSinkOnce.Do(func() {
+		_expvarSink = &ExpvarSink{
+			root: expvar.NewMap("tinymeili"),
+			histograms: map[string]*expvarHistogram{},
+		}
+	})
+	return _expvarSink
+}
+
+func (f *ExpvarSink) IncCounter(name string, value int64, labels map[string]string) {
+	f.getMap(name).Add(FormatLabels(labels), value)
+}
+
+func (f *ExpvarSink) SetGauge(name string, value float64, labels map[string]string) {
+	labelKey := FormatLabels(labels)
+	m := f.getMap(name)
+	v, ok := m.Get(labelKey).(*expvar.Float)
+	if !ok {
+		f.Lock()
+		v, ok = m.Get(labelKey).(*expvar.Float)
+		if !ok {
+			v = new(expvar.Float)
+			m.Set(labelKey, v)
+		}
+		f.Unlock()
+	}
+	v.Set(value)
+}
+
+func (f *ExpvarSink) Observe(name string, value float64, labels map[string]string) {
+	labelKey := FormatLabels(labels)
+	histogramKey := name + "|" + labelKey
+
+	//get or init histogram
+	m := f.getMap(name)
+	f.Lock()
+	histogram, ok := f.histograms[histogramKey]
+	if !ok {
+		buckets := DefaultLatencyBuckets
+		if name == MetricWriteBatchSize {
+			buckets = DefaultSizeBuckets
+		}
+		histogram = &expvarHistogram{
+			buckets: buckets,
+			counts: make([]int64, len(buckets) + 1),
+		}
+		f.histograms[histogramKey] = histogram
+		m.Set(labelKey, histogram)
+	}
+	f.Unlock()
+	histogram.observe(value)
+}
+
+//get metric map by name
+func (f *ExpvarSink) getMap(name string) *expvar.Map {
+	v, ok := f.root.Get(name).(*expvar.Map)
+	if ok {
+		return v
+	}
+	f.Lock()
+	defer f.Unlock()
+	v, ok = f.root.Get(name).(*expvar.Map)
+	if !ok {
+		v = new(expvar.Map)
+		f.root.Set(name, v)
+	}
+	return v
+}
+
+//observe one value
+func (h *expvarHistogram) observe(value float64) {
+	h.Lock()
+	defer h.Unlock()
+	idx := sort.SearchFloat64s(h.buckets, value)
+	h.counts[idx]++
+	h.count++
+	h.sum += value
+}
+
+//encode as json for expvar
+func (h *expvarHistogram) String() string {
+	h.Lock()
+	defer h.Unlock()
+	buckets := make(map[string]int64, len(h.counts))
+	total := int64(0)
+	for i, count := range h.counts {
+		total += count
+		if i < len(h.buckets) {
+			buckets[jsonFloat(h.buckets[i])] = total
+		}else{
+			buckets["+Inf"] = total
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"count": h.count,
+		"sum": h.sum,
+		"buckets": buckets,
+	})
+	return string(data)
+}
+
+//format labels as sorted `k=v,k=v`
+func FormatLabels(labels map[string]string) string {
+	if len(labels) <= 0 {
+		return "_"
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k + "=" + labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+//format float for json key
+func jsonFloat(v float64) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
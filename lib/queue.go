@@ -1,10 +1,12 @@
 package lib
 
 import (
+	"context"
 	"errors"
 	"log"
 	"reflect"
 	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -18,18 +20,34 @@ import (
 type (
 	interReq struct {
 		req      interface{} //origin input request
-		resp     chan interface{}
+		resp     chan interResp
 		needResp bool
 	}
+	interResp struct {
+		resp interface{}
+		err  error
+	}
 )
 
 //face info
 type Queue struct {
-	queueSize int
-	reqChan   chan interReq
-	closeChan chan bool
-	cbForReq  func(data interface{}) (interface{}, error)
-	cbForQuit func()
+	queueSize   int
+	reqChan     chan interReq
+	closeChan   chan bool
+	doneChan    chan struct{} //closed after main process finished
+	cbForReq    func(data interface{}) (interface{}, error)
+	cbForBatch  func(data []interface{}) error
+	cbForQuit   func()
+	cbForDrop   func(data interface{})
+	batchSize   int
+	batchLinger time.Duration
+	//overflow
+	overflow    OverflowPolicy
+	timeout     time.Duration //block timeout, 0 means wait forever
+	spillSize   int           //max spill data, 0 means no limit
+	spill       []interReq    //spilled data, fifo
+	spillLocker sync.Mutex
+	metrics     MetricsSink //optional
 	sync.RWMutex
 }
 
@@ -47,6 +65,7 @@ func NewQueue(queueSizes ...int) *Queue {
 		queueSize: queueSize,
 		reqChan: make(chan interReq, queueSize),
 		closeChan: make(chan bool, 1),
+		doneChan: make(chan struct{}),
 	}
 	//spawn main process
 	go this.runMainProcess()
@@ -56,7 +75,25 @@ func NewQueue(queueSizes ...int) *Queue {
 //quit
 func (f *Queue) Quit() {
 	if f.closeChan != nil {
-		f.closeChan <- true
+		select {
+		case f.closeChan <- true:
+		default:
+		}
+	}
+}
+
+//quit and wait left data processed
+//return ctx error if left data not processed before ctx done
+func (f *Queue) QuitWithContext(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	f.Quit()
+	select {
+	case <- f.doneChan:
+		return nil
+	case <- ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -66,17 +103,78 @@ func (f *Queue) QueueClosed() bool {
 	return closed
 }
 
-//get run queue size
+//get run queue size, include spilled data
 func (f *Queue) GetQueueSize() int {
-	return len(f.reqChan)
+	f.spillLocker.Lock()
+	defer f.spillLocker.Unlock()
+	return len(f.reqChan) + len(f.spill)
+}
+
+//get queue capacity
+func (f *Queue) GetQueueCap() int {
+	return f.queueSize
+}
+
+//get spilled data size
+func (f *Queue) GetSpillSize() int {
+	f.spillLocker.Lock()
+	defer f.spillLocker.Unlock()
+	return len(f.spill)
+}
+
+//set overflow policy, STEP-1
+//timeout only for block policy, spill size only for spill policy
+func (f *Queue) SetOverflow(
+	policy OverflowPolicy,
+	timeout time.Duration,
+	spillSize int) {
+	f.Lock()
+	defer f.Unlock()
+	f.overflow = policy
+	f.timeout = timeout
+	f.spillSize = spillSize
+}
+
+//get overflow policy
+func (f *Queue) GetOverflow() OverflowPolicy {
+	f.RLock()
+	defer f.RUnlock()
+	return f.overflow
+}
+
+//set metrics sink, STEP-1
+func (f *Queue) SetMetrics(sink MetricsSink) {
+	f.Lock()
+	defer f.Unlock()
+	f.metrics = sink
+}
+
+//set callback for dropped data of drop oldest policy
+func (f *Queue) SetDropCallback(cb func(data interface{})) bool {
+	if cb == nil {
+		return false
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.cbForDrop = cb
+	return true
 }
 
 //send data, STEP-2
 func (f *Queue) SendData(
+	data interface{},
+	needResponses...bool) (interface{}, error) {
+	return f.SendDataWithContext(context.Background(), data, needResponses...)
+}
+
+//send data with context, STEP-2
+//ctx used for cancel sending and waiting response
+func (f *Queue) SendDataWithContext(
+	ctx context.Context,
 	data interface{},
 	needResponses...bool) (interface{}, error) {
 	var (
-		resp interface{}
+		resp interResp
 		needResponse bool
 	)
 	//check
@@ -86,6 +184,9 @@ func (f *Queue) SendData(
 	if f.reqChan == nil {
 		return nil, errors.New("inter chan is nil")
 	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
 	//detect
 	if needResponses != nil && len(needResponses) > 0 {
@@ -98,20 +199,29 @@ func (f *Queue) SendData(
 		needResp: needResponse,
 	}
 	if needResponse {
-		req.resp = make(chan interface{}, 1)
+		req.resp = make(chan interResp, 1)
 	}
 
-	//send to chan with async mode
-	select {
-	case f.reqChan <- req:
+	//send to chan by overflow policy
+	err := f.enqueue(ctx, req)
+	if err != nil {
+		if err == ErrQueueFull {
+			f.incMetric(MetricQueueRejected, 1)
+		}
+		return nil, err
 	}
+	f.incMetric(MetricQueueEnqueue, 1)
 
 	if needResponse {
 		//wait for response
-		resp, _ = <- req.resp
+		select {
+		case resp = <- req.resp:
+		case <- ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
-	return resp, nil
+	return resp.resp, resp.err
 }
 
 //set callback for process quit
@@ -123,6 +233,25 @@ func (f *Queue) SetQuitCallback(cb func()) bool {
 	return true
 }
 
+//set callback for batch data opt, STEP-1
+//if setup, pending data will be coalesced and passed in one batch
+//batch flushed when reach batch size or linger time passed
+func (f *Queue) SetBatchCallback(
+	cb func(data []interface{}) error,
+	batchSize int,
+	batchLinger time.Duration) bool {
+	//check
+	if cb == nil || batchSize <= 0 {
+		return false
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.cbForBatch = cb
+	f.batchSize = batchSize
+	f.batchLinger = batchLinger
+	return true
+}
+
 //set callback for data opt, STEP-1
 func (f *Queue) SetCallback(
 	cb func(data interface{}) (interface{}, error)) bool {
@@ -137,6 +266,146 @@ func (f *Queue) SetCallback(
 //private func
 ///////////////
 
+//enqueue request by overflow policy
+func (f *Queue) enqueue(
+	ctx context.Context,
+	req interReq) error {
+	f.RLock()
+	policy, timeout := f.overflow, f.timeout
+	f.RUnlock()
+
+	switch policy {
+	case OverflowFailFast:
+		{
+			select {
+			case f.reqChan <- req:
+				return nil
+			default:
+				return ErrQueueFull
+			}
+		}
+	case OverflowDropOldest:
+		return f.enqueueDropOldest(req)
+	case OverflowSpill:
+		return f.enqueueSpill(req)
+	default:
+		{
+			//block with optional timeout
+			var timeoutChan <-chan time.Time
+			if timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				timeoutChan = timer.C
+			}
+			select {
+			case f.reqChan <- req:
+				return nil
+			case <- timeoutChan:
+				return ErrQueueFull
+			case <- ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+//enqueue request, drop oldest one if queue full
+func (f *Queue) enqueueDropOldest(req interReq) error {
+	for {
+		select {
+		case f.reqChan <- req:
+			return nil
+		default:
+		}
+
+		//drop oldest request
+		select {
+		case oldReq, isOk := <- f.reqChan:
+			if !isOk {
+				return errors.New("inter chan is closed")
+			}
+			f.dropReq(oldReq)
+		default:
+		}
+	}
+}
+
+//enqueue request, spill into buffer if queue full
+func (f *Queue) enqueueSpill(req interReq) error {
+	f.spillLocker.Lock()
+	defer f.spillLocker.Unlock()
+
+	//keep order, send to chan only if no spilled data
+	if len(f.spill) <= 0 {
+		select {
+		case f.reqChan <- req:
+			return nil
+		default:
+		}
+	}
+
+	//spill into buffer
+	f.RLock()
+	spillSize := f.spillSize
+	f.RUnlock()
+	if spillSize > 0 && len(f.spill) >= spillSize {
+		return ErrQueueFull
+	}
+	f.spill = append(f.spill, req)
+	return nil
+}
+
+//move spilled data into chan as much as possible
+func (f *Queue) moveSpill() {
+	f.spillLocker.Lock()
+	defer f.spillLocker.Unlock()
+	moved := 0
+	for moved < len(f.spill) {
+		select {
+		case f.reqChan <- f.spill[moved]:
+			moved++
+			continue
+		default:
+		}
+		break
+	}
+	if moved <= 0 {
+		return
+	}
+	f.spill = f.spill[moved:]
+	if len(f.spill) <= 0 {
+		f.spill = nil
+	}
+}
+
+//record counter metric and queue depth
+func (f *Queue) incMetric(name string, value int64) {
+	f.RLock()
+	sink := f.metrics
+	f.RUnlock()
+	if sink == nil {
+		return
+	}
+	sink.IncCounter(name, value, nil)
+	sink.SetGauge(MetricQueueDepth, float64(f.GetQueueSize()), nil)
+}
+
+//drop request and notify
+func (f *Queue) dropReq(req interReq) {
+	f.incMetric(MetricQueueDropped, 1)
+	f.RLock()
+	cb := f.cbForDrop
+	f.RUnlock()
+	if cb != nil {
+		cb(req.req)
+	}
+	if req.needResp {
+		req.resp <- interResp{
+			err: ErrQueueDropped,
+		}
+	}
+}
+
 //check chan is closed or not
 //true:closed, false:opening
 func (f *Queue) isChanClosed(ch interface{}) (bool, error) {
@@ -166,25 +435,143 @@ func (f *Queue) isChanClosed(ch interface{}) (bool, error) {
 	return *(*uint32)(unsafe.Pointer(cPtr)) > 0, nil
 }
 
+//get batch callback and setting
+func (f *Queue) getBatchSetting() (func([]interface{}) error, int, time.Duration) {
+	f.RLock()
+	defer f.RUnlock()
+	return f.cbForBatch, f.batchSize, f.batchLinger
+}
+
+//collect batch request begin with first one
+func (f *Queue) collectBatch(
+	first interReq,
+	batchSize int,
+	batchLinger time.Duration) []interReq {
+	var (
+		orgReq interReq
+		isOk bool
+	)
+	reqs := []interReq{first}
+
+	//pick left data in chan without waiting
+	if batchLinger <= 0 {
+		for len(reqs) < batchSize {
+			select {
+			case orgReq, isOk = <- f.reqChan:
+				if !isOk {
+					return reqs
+				}
+				reqs = append(reqs, orgReq)
+			default:
+				return reqs
+			}
+		}
+		return reqs
+	}
+
+	//pick data until batch full or linger time passed
+	timer := time.NewTimer(batchLinger)
+	defer timer.Stop()
+	for len(reqs) < batchSize {
+		select {
+		case orgReq, isOk = <- f.reqChan:
+			if !isOk {
+				return reqs
+			}
+			reqs = append(reqs, orgReq)
+		case <- timer.C:
+			return reqs
+		}
+	}
+	return reqs
+}
+
+//process batch requests
+func (f *Queue) processBatch(
+	cb func([]interface{}) error,
+	reqs []interReq) {
+	//check
+	if cb == nil || len(reqs) <= 0 {
+		return
+	}
+
+	f.incMetric(MetricQueueDequeue, int64(len(reqs)))
+
+	//gather origin data
+	data := make([]interface{}, 0, len(reqs))
+	for _, req := range reqs {
+		data = append(data, req.req)
+	}
+
+	//call batch cb and response
+	err := cb(data)
+	for _, req := range reqs {
+		if req.needResp {
+			req.resp <- interResp{
+				err: err,
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("queue.processBatch, opt failed, err:%v\n", err.Error())
+	}
+}
+
 //process left data in chan
 func (f *Queue) processChanLeftData() {
 	var (
-		data interface{}
+		orgReq interReq
+		resp interface{}
+		err error
 		isOk bool
 	)
 	//check chan
-	if f.reqChan == nil || len(f.reqChan) <= 0 {
+	if f.reqChan == nil || f.GetQueueSize() <= 0 {
+		return
+	}
+
+	//process in batch mode
+	cbForBatch, batchSize, _ := f.getBatchSetting()
+	if cbForBatch != nil {
+		for f.GetQueueSize() > 0 {
+			f.moveSpill()
+			select {
+			case orgReq, isOk = <- f.reqChan:
+				if !isOk {
+					return
+				}
+				f.processBatch(cbForBatch, f.collectBatch(orgReq, batchSize, 0))
+			default:
+				return
+			}
+		}
 		return
 	}
+
 	//process one by one
 	for {
-		//pick data from chan
-		data, isOk = <- f.reqChan
-		if !isOk || data == nil {
-			break
-		}
-		if f.cbForReq != nil {
-			f.cbForReq(data)
+		//pick data from chan, non-blocking
+		f.moveSpill()
+		select {
+		case orgReq, isOk = <- f.reqChan:
+			{
+				if !isOk {
+					return
+				}
+				f.incMetric(MetricQueueDequeue, 1)
+				if f.cbForReq == nil {
+					continue
+				}
+				resp, err = f.cbForReq(orgReq.req)
+				if orgReq.needResp {
+					orgReq.resp <- interResp{
+						resp: resp,
+						err: err,
+					}
+				}
+			}
+		default:
+			return
 		}
 	}
 }
@@ -194,6 +581,7 @@ func (f *Queue) runMainProcess() {
 	var (
 		orgReq interReq
 		resp interface{}
+		err error
 		isOk bool
 		m any = nil
 	)
@@ -211,6 +599,7 @@ func (f *Queue) runMainProcess() {
 		if f.cbForQuit != nil {
 			f.cbForQuit()
 		}
+		close(f.doneChan)
 	}()
 
 	//loop
@@ -218,10 +607,28 @@ func (f *Queue) runMainProcess() {
 		select {
 		case orgReq, isOk = <- f.reqChan:
 			{
+				//check batch mode
+				cbForBatch, batchSize, batchLinger := f.getBatchSetting()
+				if isOk && cbForBatch != nil {
+					reqs := f.collectBatch(orgReq, batchSize, batchLinger)
+					f.moveSpill()
+					f.processBatch(cbForBatch, reqs)
+					continue
+				}
+				if isOk {
+					//refill chan from spilled data
+					f.moveSpill()
+					f.incMetric(MetricQueueDequeue, 1)
+				}
 				if isOk && &orgReq != nil && f.cbForReq != nil {
-					resp, _ = f.cbForReq(orgReq.req)
+					resp, err = f.cbForReq(orgReq.req)
 					if orgReq.needResp {
-						orgReq.resp <- resp
+						orgReq.resp <- interResp{
+							resp: resp,
+							err: err,
+						}
+					}else if err != nil {
+						log.Printf("queue.runMainProcess, opt failed, err:%v\n", err.Error())
 					}
 				}
 			}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+/*
+ * consistent hash ring
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - immutable after build, safe for lock-free reading
+ * - each worker has multi virtual nodes on ring
+ */
+
+//inter type
+type (
+	ringNode struct {
+		hash   uint32
+		worker *SonWorker
+	}
+)
+
+//face info
+type hashRing struct {
+	nodes   []ringNode   //sorted by hash
+	workers []*SonWorker //sorted by worker id
+}
+
+//construct
+func newHashRing(
+	workers []*SonWorker,
+	virtualNodes int) *hashRing {
+	//check
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+
+	//sort workers by id
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].workerId < workers[j].workerId
+	})
+
+	//gen virtual nodes of workers
+	nodes := make([]ringNode, 0, len(workers) * virtualNodes)
+	for _, worker := range workers {
+		workerKey := strconv.Itoa(int(worker.workerId))
+		for i := 0; i < virtualNodes; i++ {
+			nodes = append(nodes, ringNode{
+				hash: hashKey(workerKey + "#" + strconv.Itoa(i)),
+				worker: worker,
+			})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].hash < nodes[j].hash
+	})
+
+	//self init
+	this := &hashRing{
+		nodes: nodes,
+		workers: workers,
+	}
+	return this
+}
+
+//get worker by key
+func (f *hashRing) get(key string) *SonWorker {
+	//check
+	if len(f.nodes) <= 0 {
+		return nil
+	}
+
+	//search first node clockwise
+	hash := hashKey(key)
+	idx := sort.Search(len(f.nodes), func(i int) bool {
+		return f.nodes[i].hash >= hash
+	})
+	if idx >= len(f.nodes) {
+		idx = 0
+	}
+	return f.nodes[idx].worker
+}
+
+//get worker by index, used for round robin
+func (f *hashRing) getByIdx(idx uint64) *SonWorker {
+	//check
+	if len(f.workers) <= 0 {
+		return nil
+	}
+	return f.workers[idx % uint64(len(f.workers))]
+}
+
+//hash key value
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
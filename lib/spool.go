@@ -0,0 +1,454 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+/*
+ * local write-ahead spool
+ * @author <AndyZhou>
+ * @mail <diudiu8848@163.com>
+ * - one append-only segment file
+ * - record appended before data opt, ack appended after opt succeed
+ * - file truncated when no any pending records
+ * - file compacted into pending records when acked bytes over limit
+ * - exclusive lock on `<file>.lock`, one owner of spool file
+ */
+
+//inter type
+type (
+	spoolLine struct {
+		Seq  int64  `json:"seq,omitempty"`
+		Data []byte `json:"data,omitempty"`
+		Ack  int64  `json:"ack,omitempty"`
+	}
+)
+
+//face info
+type Spool struct {
+	filePath  string
+	file      *os.File
+	lockFile  *os.File
+	syncWrite bool
+	seq       int64          //last record seq
+	pending   map[int64]bool //seq -> in flight or not
+	sizes     map[int64]int64 //seq -> record line bytes
+	fileSize  int64          //bytes written into file
+	liveSize  int64          //bytes of pending records
+	compactSize int64        //compact file when acked bytes over it
+	sync.Mutex
+}
+
+//construct
+func NewSpool(filePath string, syncWrites ...bool) (*Spool, error) {
+	var (
+		syncWrite bool
+	)
+	//check
+	if filePath == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	if syncWrites != nil && len(syncWrites) > 0 {
+		syncWrite = syncWrites[0]
+	}
+
+	//self init
+	this := &Spool{
+		filePath: filePath,
+		syncWrite: syncWrite,
+		pending: map[int64]bool{},
+		sizes: map[int64]int64{},
+		compactSize: DefaultSpoolCompactSize,
+	}
+	err := this.interInit()
+	if err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+//close
+func (f *Spool) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	f.releaseLock()
+	return err
+}
+
+//set compact size
+//file compacted when acked bytes over this size
+func (f *Spool) SetCompactSize(size int64) {
+	if size <= 0 {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.compactSize = size
+}
+
+//get file size
+func (f *Spool) GetFileSize() int64 {
+	f.Lock()
+	defer f.Unlock()
+	return f.fileSize
+}
+
+//get released records count, need replay
+func (f *Spool) GetReleasedSize() int {
+	f.Lock()
+	defer f.Unlock()
+	released := 0
+	for _, inFlight := range f.pending {
+		if !inFlight {
+			released++
+		}
+	}
+	return released
+}
+
+//get pending records count
+func (f *Spool) GetPendingSize() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.pending)
+}
+
+//append new record, return record seq
+//new record is in flight status
+func (f *Spool) Append(data []byte) (int64, error) {
+	//check
+	if data == nil || len(data) <= 0 {
+		return 0, errors.New("invalid parameter")
+	}
+
+	//append with locker
+	f.Lock()
+	defer f.Unlock()
+	seq := f.seq + 1
+	size, err := f.writeLine(&spoolLine{
+		Seq: seq,
+		Data: data,
+	})
+	if err != nil {
+		return 0, err
+	}
+	f.seq = seq
+	f.pending[seq] = true
+	f.sizes[seq] = size
+	f.liveSize += size
+	return seq, nil
+}
+
+//ack record, opt succeed
+//file will be truncated if no any pending records,
+//or compacted if acked bytes over compact size
+func (f *Spool) Ack(seq int64) error {
+	//check
+	if seq <= 0 {
+		return errors.New("invalid parameter")
+	}
+
+	//ack with locker
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.pending[seq]; !ok {
+		return nil
+	}
+	delete(f.pending, seq)
+	f.liveSize -= f.sizes[seq]
+	delete(f.sizes, seq)
+	if len(f.pending) <= 0 {
+		return f.truncate()
+	}
+	if f.fileSize - f.liveSize >= f.compactSize && f.compact() == nil {
+		return nil
+	}
+	_, err := f.writeLine(&spoolLine{
+		Ack: seq,
+	})
+	return err
+}
+
+//release record, opt failed and need replay later
+func (f *Spool) Release(seq int64) {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.pending[seq]; ok {
+		f.pending[seq] = false
+	}
+}
+
+//replay pending records which not in flight
+//replayed record will be set as in flight status
+func (f *Spool) Replay(cb func(seq int64, data []byte) error) (int, error) {
+	//check
+	if cb == nil {
+		return 0, errors.New("invalid parameter")
+	}
+
+	//pick records need replay with locker
+	f.Lock()
+	records, err := f.loadRecords()
+	if err != nil {
+		f.Unlock()
+		return 0, err
+	}
+	seqs := make([]int64, 0)
+	for seq := range records {
+		inFlight, ok := f.pending[seq]
+		if !ok || inFlight {
+			continue
+		}
+		f.pending[seq] = true
+		seqs = append(seqs, seq)
+	}
+	f.Unlock()
+
+	//replay in seq order
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	replayed := 0
+	for _, seq := range seqs {
+		err = cb(seq, records[seq])
+		if err != nil {
+			f.Release(seq)
+			continue
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+///////////////
+//private func
+///////////////
+
+//release file lock
+func (f *Spool) releaseLock() {
+	if f.lockFile == nil {
+		return
+	}
+	unlockFile(f.lockFile)
+	f.lockFile.Close()
+	f.lockFile = nil
+}
+
+//write one line into file
+//return written bytes
+func (f *Spool) writeLine(line *spoolLine) (int64, error) {
+	//check
+	if f.file == nil {
+		return 0, errors.New("spool file closed")
+	}
+
+	//encode and write
+	lineBytes, err := json.Marshal(line)
+	if err != nil {
+		return 0, err
+	}
+	lineBytes = append(lineBytes, '\n')
+	n, err := f.file.Write(lineBytes)
+	f.fileSize += int64(n)
+	if err != nil {
+		return int64(n), err
+	}
+	if f.syncWrite {
+		return int64(n), f.file.Sync()
+	}
+	return int64(n), nil
+}
+
+//truncate file
+func (f *Spool) truncate() error {
+	if f.file == nil {
+		return errors.New("spool file closed")
+	}
+	err := f.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	f.fileSize = 0
+	_, err = f.file.Seek(0, io.SeekStart)
+	return err
+}
+
+//compact file, only pending records kept
+//written into temp file and renamed, old file untouched if failed
+func (f *Spool) compact() error {
+	//check
+	if f.file == nil {
+		return errors.New("spool file closed")
+	}
+
+	//load left records
+	records, err := f.loadRecords()
+	if err != nil {
+		return err
+	}
+	seqs := make([]int64, 0, len(f.pending))
+	for seq := range f.pending {
+		if _, ok := records[seq]; ok {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+
+	//write pending records into temp file
+	tmpPath := f.filePath + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	sizes := make(map[int64]int64, len(seqs))
+	fileSize := int64(0)
+	writer := bufio.NewWriter(tmpFile)
+	for _, seq := range seqs {
+		lineBytes, _ := json.Marshal(&spoolLine{
+			Seq: seq,
+			Data: records[seq],
+		})
+		lineBytes = append(lineBytes, '\n')
+		writer.Write(lineBytes)
+		sizes[seq] = int64(len(lineBytes))
+		fileSize += int64(len(lineBytes))
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	//replace old file and reopen for append
+	f.file.Close()
+	f.file = nil
+	err = os.Rename(tmpPath, f.filePath)
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	file, openErr := os.OpenFile(f.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if openErr != nil {
+		return openErr
+	}
+	f.file = file
+	if err != nil {
+		//old file kept, ack lines still in it
+		return err
+	}
+
+	//records acked by other process never exists, drop them
+	for seq := range f.pending {
+		if _, ok := sizes[seq]; !ok {
+			delete(f.pending, seq)
+		}
+	}
+	f.sizes = sizes
+	f.fileSize = fileSize
+	f.liveSize = fileSize
+	return nil
+}
+
+//load un-acked records from file
+//return seq -> data
+func (f *Spool) loadRecords() (map[int64][]byte, error) {
+	//open file for read
+	file, err := os.Open(f.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[int64][]byte{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	//read line by line
+	records := map[int64][]byte{}
+	reader := bufio.NewReader(file)
+	for {
+		lineBytes, subErr := reader.ReadBytes('\n')
+		if len(lineBytes) > 0 {
+			line := spoolLine{}
+			if json.Unmarshal(lineBytes, &line) == nil {
+				if line.Ack > 0 {
+					delete(records, line.Ack)
+				}else if line.Seq > 0 {
+					records[line.Seq] = line.Data
+				}
+			}
+		}
+		if subErr != nil {
+			if subErr == io.EOF {
+				break
+			}
+			return nil, subErr
+		}
+	}
+	return records, nil
+}
+
+//inter init
+func (f *Spool) interInit() error {
+	//create dir
+	err := os.MkdirAll(filepath.Dir(f.filePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	//lock spool file, released by process exit if crashed
+	f.lockFile, err = os.OpenFile(f.filePath + ".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	err = lockFile(f.lockFile)
+	if err != nil {
+		f.lockFile.Close()
+		f.lockFile = nil
+		return err
+	}
+
+	//load left records
+	records, err := f.loadRecords()
+	if err != nil {
+		f.releaseLock()
+		return err
+	}
+	for seq := range records {
+		f.pending[seq] = false
+		if seq > f.seq {
+			f.seq = seq
+		}
+	}
+
+	//open file for append
+	f.file, err = os.OpenFile(f.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		f.releaseLock()
+		return err
+	}
+
+	//no any pending records, reset file
+	if len(f.pending) <= 0 {
+		return f.truncate()
+	}
+
+	//drop acked records left by last run
+	return f.compact()
+}
@@ -1,9 +1,9 @@
 package lib
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"runtime"
 	"strconv"
 	"sync"
@@ -31,10 +31,22 @@ type (
 type Worker struct {
 	//basic
 	workerMap map[int32]*SonWorker //workerId -> *SonWorker
-	workerIdMap map[string]int32 //dataId -> workerId, for bind obj
+	workerIdMap sync.Map //dataId -> *SonWorker, for bind obj
 	workers int32
+	ring atomic.Value //*hashRing, rebuild when workers changed
+	robinIdx uint64 //round robin index for empty data id
 	//cb func
 	cbForQueueOpt func(interface{})(interface{}, error)
+	cbForBatchQueueOpt func([]interface{}) error
+	cbForDropOpt func(interface{})
+	batchSize int
+	batchLinger time.Duration
+	//queue setting
+	queueSize int
+	overflow OverflowPolicy
+	overflowTimeout time.Duration
+	spillSize int
+	metrics MetricsSink //optional
 	sync.RWMutex
 }
 
@@ -42,8 +54,8 @@ type Worker struct {
 func NewWorker() *Worker {
 	this := &Worker{
 		workerMap: map[int32]*SonWorker{},
-		workerIdMap: map[string]int32{},
 	}
+	this.ring.Store(newHashRing(nil, DefaultVirtualNodes))
 	return this
 }
 
@@ -56,9 +68,39 @@ func (f *Worker) Quit() {
 		delete(f.workerMap, k)
 	}
 	atomic.StoreInt32(&f.workers, 0)
+	f.rebuildRing()
 	runtime.GC()
 }
 
+//quit and wait left data of son workers processed
+//return ctx error if not finished before ctx done
+func (f *Worker) QuitWithContext(ctx context.Context) error {
+	var (
+		wg sync.WaitGroup
+		errLocker sync.Mutex
+		err error
+	)
+	f.Lock()
+	defer f.Unlock()
+	for k, v := range f.workerMap {
+		wg.Add(1)
+		go func(sw *SonWorker) {
+			defer wg.Done()
+			subErr := sw.QuitWithContext(ctx)
+			if subErr != nil {
+				errLocker.Lock()
+				err = subErr
+				errLocker.Unlock()
+			}
+		}(v)
+		delete(f.workerMap, k)
+	}
+	wg.Wait()
+	atomic.StoreInt32(&f.workers, 0)
+	f.rebuildRing()
+	return err
+}
+
 //set cb for queue opt, STEP-1-1
 //if setup, will open queue
 func (f *Worker) SetCBForQueueOpt(cb func(interface{}) (interface{}, error)) {
@@ -72,13 +114,112 @@ func (f *Worker) SetCBForQueueOpt(cb func(interface{}) (interface{}, error)) {
 	f.Lock()
 	defer f.Unlock()
 	for _, v := range f.workerMap {
-		if v.queue == nil {
-			v.queue = NewQueue()
-		}
+		f.initSonQueue(v)
 		v.queue.SetCallback(cb)
 	}
 }
 
+//set cb for batch queue opt, STEP-1-2
+//if setup, queued data will be coalesced into batch
+func (f *Worker) SetCBForBatchQueueOpt(
+	cb func([]interface{}) error,
+	batchSize int,
+	batchLinger time.Duration) {
+	//check
+	if cb == nil || batchSize <= 0 {
+		return
+	}
+
+	//sync into running son workers
+	f.Lock()
+	defer f.Unlock()
+	f.cbForBatchQueueOpt = cb
+	f.batchSize = batchSize
+	f.batchLinger = batchLinger
+	for _, v := range f.workerMap {
+		f.initSonQueue(v)
+		v.queue.SetBatchCallback(cb, batchSize, batchLinger)
+	}
+}
+
+//set queue size of son workers, STEP-1-3
+//only effect new created workers
+func (f *Worker) SetQueueSize(size int) {
+	f.Lock()
+	defer f.Unlock()
+	f.queueSize = size
+}
+
+//set queue overflow policy, STEP-1-4
+//timeout for block policy, spill size for spill policy
+func (f *Worker) SetOverflow(
+	policy OverflowPolicy,
+	timeout time.Duration,
+	spillSize int) {
+	//sync into running son workers
+	f.Lock()
+	defer f.Unlock()
+	f.overflow = policy
+	f.overflowTimeout = timeout
+	f.spillSize = spillSize
+	for _, v := range f.workerMap {
+		if v.queue != nil {
+			v.queue.SetOverflow(policy, timeout, spillSize)
+		}
+	}
+}
+
+//set metrics sink, STEP-1-6
+//son worker queue metrics labeled by worker id
+func (f *Worker) SetMetrics(sink MetricsSink) {
+	f.Lock()
+	defer f.Unlock()
+	f.metrics = sink
+	for _, v := range f.workerMap {
+		if v.queue != nil {
+			v.queue.SetMetrics(f.genSonMetrics(v))
+		}
+	}
+}
+
+//get queue overflow policy
+func (f *Worker) GetOverflow() OverflowPolicy {
+	f.RLock()
+	defer f.RUnlock()
+	return f.overflow
+}
+
+//set cb for dropped data of drop oldest policy, STEP-1-5
+func (f *Worker) SetCBForDropOpt(cb func(interface{})) {
+	//check
+	if cb == nil {
+		return
+	}
+
+	//sync into running son workers
+	f.Lock()
+	defer f.Unlock()
+	f.cbForDropOpt = cb
+	for _, v := range f.workerMap {
+		if v.queue != nil {
+			v.queue.SetDropCallback(cb)
+		}
+	}
+}
+
+//get queued data size of all son workers
+func (f *Worker) GetQueueSize() int {
+	f.RLock()
+	defer f.RUnlock()
+	total := 0
+	for _, v := range f.workerMap {
+		if v.queue != nil {
+			total += v.queue.GetQueueSize()
+		}
+	}
+	return total
+}
+
 //create workers, STEP-2
 func (f *Worker) CreateWorkers(num int) error {
 	//check
@@ -98,15 +239,22 @@ func (f *Worker) CreateWorkers(num int) error {
 
 		//set queue cb
 		if f.cbForQueueOpt != nil {
-			if sw.queue == nil {
-				sw.queue = NewQueue()
-			}
+			f.initSonQueue(sw)
 			sw.queue.SetCallback(f.cbForQueueOpt)
 		}
 
+		//set batch queue cb
+		if f.cbForBatchQueueOpt != nil {
+			f.initSonQueue(sw)
+			sw.queue.SetBatchCallback(f.cbForBatchQueueOpt, f.batchSize, f.batchLinger)
+		}
+
 		//sync into run map
 		f.workerMap[newWorkerId] = sw
 	}
+
+	//rebuild hash ring
+	f.rebuildRing()
 	return nil
 }
 
@@ -117,11 +265,22 @@ func (f *Worker) SendData(
 		dataId string,
 		needResponses ...bool,
 	) (interface{}, error) {
+	return f.SendDataWithContext(context.Background(), data, dataId, needResponses...)
+}
+
+//send data to one worker with context, STEP-3
+//ctx used for cancel sending and waiting response
+func (f *Worker) SendDataWithContext(
+		ctx context.Context,
+		data interface{},
+		dataId string,
+		needResponses ...bool,
+	) (interface{}, error) {
 	//check
 	if data == nil {
 		return nil, errors.New("invalid parameter")
 	}
-	if f.workers <= 0 {
+	if atomic.LoadInt32(&f.workers) <= 0 {
 		return nil, errors.New("no any workers")
 	}
 
@@ -131,7 +290,7 @@ func (f *Worker) SendData(
 		return nil, err
 	}
 	//send data to queue
-	resp, subErr := sonWorker.queue.SendData(data, needResponses...)
+	resp, subErr := sonWorker.queue.SendDataWithContext(ctx, data, needResponses...)
 	return resp, subErr
 }
 
@@ -141,28 +300,38 @@ func (f *Worker) CastData(data interface{}) error {
 	if data == nil {
 		return errors.New("invalid parameter")
 	}
-	if f.workers <= 0 {
+	if atomic.LoadInt32(&f.workers) <= 0 {
 		return errors.New("no any workers")
 	}
 
-	//send data to all workers
+	//copy son workers with read locker
+	//sending may block, not hold locker
+	f.RLock()
+	workers := make([]*SonWorker, 0, len(f.workerMap))
 	for _, v := range f.workerMap {
-		v.queue.SendData(data)
+		workers = append(workers, v)
+	}
+	f.RUnlock()
+
+	//send data to all workers
+	for _, v := range workers {
+		v.SendData(data)
 	}
 	return nil
 }
 
 //get workers
 func (f *Worker) GetWorkers() int32 {
-	return f.workers
+	return atomic.LoadInt32(&f.workers)
 }
 
 //get son worker
 //extParas -> dataId(string), needBind(bool)
+//same data id always routed to same worker by consistent hashing
 func (f *Worker) GetTargetWorker(
 	extParas ...interface{}) (*SonWorker, error) {
 	var (
-		targetWorkerId int32
+		targetWorker *SonWorker
 		dataId string
 		needBind bool
 	)
@@ -177,48 +346,43 @@ func (f *Worker) GetTargetWorker(
 		case 2:
 			{
 				dataId = fmt.Sprintf("%v", extParas[0])
-				needBind, _ = strconv.ParseBool(fmt.Sprintf("%v", extParas[0]))
+				needBind, _ = strconv.ParseBool(fmt.Sprintf("%v", extParas[1]))
 			}
 		}
 	}
 
-	//gen hashed worker id
-	f.Lock()
-	defer f.Unlock()
+	//get hash ring without locker
+	ring, _ := f.ring.Load().(*hashRing)
+	if ring == nil {
+		return nil, errors.New("no any workers")
+	}
+
+	//pick target son worker
 	if dataId == "" {
-		//hashed by rand
-		now := time.Now().UnixNano()
-		rand.Seed(now)
-		targetWorkerId = int32(rand.Int63n(now) % int64(f.workers)) + 1
-	}else{
-		//hashed by data id
-		dataIdAscii, err := f.GetAsciiValue(dataId)
-		if err != nil {
-			return nil, err
+		//round robin
+		idx := atomic.AddUint64(&f.robinIdx, 1)
+		targetWorker = ring.getByIdx(idx)
+	}else if needBind {
+		//get from cached map
+		v, ok := f.workerIdMap.Load(dataId)
+		if ok {
+			targetWorker, _ = v.(*SonWorker)
 		}
-		if needBind {
-			//get from cached map
-			v, ok := f.workerIdMap[dataId]
-			if !ok || v <= 0 {
-				//hashed by data id
-				targetWorkerId = int32(rand.Int63n(int64(dataIdAscii)) % int64(f.workers)) + 1
-				//sync into cache map
-				f.workerIdMap[dataId] = targetWorkerId
-			}else{
-				targetWorkerId = v
+		if targetWorker == nil || !f.isWorkerAlive(targetWorker) {
+			//hashed by data id and sync into cache map
+			targetWorker = ring.get(dataId)
+			if targetWorker != nil {
+				f.workerIdMap.Store(dataId, targetWorker)
 			}
-		}else{
-			//hashed by data id
-			targetWorkerId = int32(rand.Int63n(int64(dataIdAscii)) % int64(f.workers)) + 1
 		}
+	}else{
+		//hashed by data id
+		targetWorker = ring.get(dataId)
 	}
-
-	//get target son worker
-	v, ok := f.workerMap[targetWorkerId]
-	if ok && v != nil {
-		return v, nil
+	if targetWorker == nil {
+		return nil, errors.New("can't get son worker")
 	}
-	return nil, errors.New("can't get son worker")
+	return targetWorker, nil
 }
 
 func (f *Worker) GetWorker(
@@ -276,6 +440,45 @@ func (f *Worker) GetAsciiValue(
 	return finalVal, nil
 }
 
+//init queue of son worker, called with locker
+func (f *Worker) initSonQueue(sw *SonWorker) {
+	if sw.queue != nil {
+		return
+	}
+	sw.queue = NewQueue(f.queueSize)
+	sw.queue.SetOverflow(f.overflow, f.overflowTimeout, f.spillSize)
+	if f.cbForDropOpt != nil {
+		sw.queue.SetDropCallback(f.cbForDropOpt)
+	}
+	if f.metrics != nil {
+		sw.queue.SetMetrics(f.genSonMetrics(sw))
+	}
+}
+
+//gen metrics sink of son worker
+func (f *Worker) genSonMetrics(sw *SonWorker) MetricsSink {
+	return NewLabeledSink(f.metrics, map[string]string{
+		LabelWorker: strconv.Itoa(int(sw.workerId)),
+	})
+}
+
+//rebuild hash ring, called with locker
+func (f *Worker) rebuildRing() {
+	workers := make([]*SonWorker, 0, len(f.workerMap))
+	for _, v := range f.workerMap {
+		workers = append(workers, v)
+	}
+	f.ring.Store(newHashRing(workers, DefaultVirtualNodes))
+}
+
+//check son worker still running or not
+func (f *Worker) isWorkerAlive(worker *SonWorker) bool {
+	f.RLock()
+	defer f.RUnlock()
+	v, ok := f.workerMap[worker.workerId]
+	return ok && v == worker
+}
+
 ////////////////////
 //api for son worker
 ////////////////////
@@ -296,6 +499,19 @@ func (f *SonWorker) Quit() {
 	}
 }
 
+//quit and wait left data processed
+func (f *SonWorker) QuitWithContext(ctx context.Context) error {
+	if f.queue == nil {
+		return nil
+	}
+	return f.queue.QuitWithContext(ctx)
+}
+
+//get worker id
+func (f *SonWorker) GetWorkerId() int32 {
+	return f.workerId
+}
+
 //send data
 func (f *SonWorker) SendData(data interface{}) (interface{}, error) {
 	//check
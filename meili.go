@@ -1,6 +1,7 @@
 package tinymeili
 
 import (
+	"context"
 	"sync"
 
 	"github.com/andyzhou/tinymeili/conf"
@@ -45,8 +46,10 @@ func NewMeiLi() *MeiLi {
 ///////////
 
 //quit
-func (f *MeiLi) Quit() {
-	f.interFace.Quit()
+//stop accepting writes and drain pending writes until ctx done
+//return report of flushed, failed and abandoned writes
+func (f *MeiLi) Quit(ctx context.Context) (*face.QuitReport, error) {
+	return f.interFace.Quit(ctx)
 }
 
 //remove client
@@ -54,6 +57,13 @@ func (f *MeiLi) RemoveClient(tag string) error {
 	return f.interFace.RemoveClient(tag)
 }
 
+//remove client with context
+func (f *MeiLi) RemoveClientWithContext(
+	ctx context.Context,
+	tag string) (*face.QuitReport, error) {
+	return f.interFace.RemoveClientWithContext(ctx, tag)
+}
+
 //get client
 func (f *MeiLi) GetClient(tag string) (*face.Client, error) {
 	return f.interFace.GetClient(tag)
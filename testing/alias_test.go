@@ -0,0 +1,72 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+)
+
+//test alias resolved into physical index
+func TestAliasResolve(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	client.CreateIndex(&conf.IndexConf{
+		IndexName: IndexName,
+		PrimaryKey: PrimaryKey,
+	})
+
+	if err := client.SetAlias("bad alias", IndexName); err == nil {
+		t.Errorf("expect invalid alias name rejected")
+		return
+	}
+	if err := client.SetAlias("live", IndexName); err != nil {
+		t.Errorf("set alias failed, err:%v", err.Error())
+		return
+	}
+	index, err := client.GetIndex("live")
+	if err != nil || index.GetConf().IndexName != IndexName {
+		t.Errorf("alias not resolved, err:%v", err)
+		return
+	}
+
+	client.RemoveAlias("live")
+	if _, err = client.GetIndex("live"); err == nil {
+		t.Errorf("removed alias still resolved")
+	}
+}
+
+//test persisted aliases loaded by new client
+func TestAliasPersist(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	withAliasIndex := func(cfg *conf.ClientConf) {
+		cfg.AliasIndex = "aliases"
+	}
+	client := fake.newClient(withAliasIndex)
+	defer client.Quit(context.Background())
+	if err := client.SetAlias("live", IndexName); err != nil {
+		t.Errorf("set alias failed, err:%v", err.Error())
+		return
+	}
+
+	//loaded on init
+	other := fake.newClient(withAliasIndex)
+	defer other.Quit(context.Background())
+	if name := other.ResolveIndexName("live"); name != IndexName {
+		t.Errorf("persisted alias not loaded, got %v", name)
+		return
+	}
+
+	//reload after removed
+	client.RemoveAlias("live")
+	if err := other.ReloadAliases(); err != nil {
+		t.Errorf("reload aliases failed, err:%v", err.Error())
+		return
+	}
+	if aliases := other.GetAliases(); len(aliases) != 0 {
+		t.Errorf("expect no aliases, got %v", aliases)
+	}
+}
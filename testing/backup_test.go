@@ -0,0 +1,71 @@
+package testing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//wait backup status until check passed
+func waitBackupStatus(
+	client *face.Client,
+	check func(status face.BackupStatus) bool) (face.BackupStatus, bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		status := client.GetBackupStatus()
+		if check(status) {
+			return status, true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return client.GetBackupStatus(), false
+}
+
+//test failed backup recorded and schedule kept running
+func TestBackupSchedule(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.backupFails = 2
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	err := client.StartBackupSchedule(&conf.BackupScheduleConf{
+		Interval: time.Millisecond * 20,
+	})
+	if err != nil {
+		t.Errorf("start backup schedule failed, err:%v", err.Error())
+		return
+	}
+	if err = client.StartBackupSchedule(&conf.BackupScheduleConf{Interval: time.Second}); err == nil {
+		t.Errorf("expect duplicated schedule rejected")
+		return
+	}
+
+	//failed runs recorded
+	status, ok := waitBackupStatus(client, func(status face.BackupStatus) bool {
+		return status.ConsecutiveFailures >= 2
+	})
+	if !ok || status.LastErr == nil || status.LastSuccess != nil {
+		t.Errorf("expect failed runs recorded, got %+v", status)
+		return
+	}
+
+	//next run succeeded, failures reset
+	status, ok = waitBackupStatus(client, func(status face.BackupStatus) bool {
+		return status.LastSuccess != nil
+	})
+	if !ok || status.LastErr != nil || status.ConsecutiveFailures != 0 ||
+		status.LastSuccess.Kind != face.BackupKindDump {
+		t.Errorf("expect backup succeeded, got %+v", status)
+		return
+	}
+
+	//stopped schedule can be started again
+	client.StopBackupSchedule()
+	if err = client.StartBackupSchedule(&conf.BackupScheduleConf{Interval: time.Second}); err != nil {
+		t.Errorf("restart backup schedule failed, err:%v", err.Error())
+	}
+}
@@ -0,0 +1,131 @@
+package testing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//new batch index of fake server
+func newBatchIndex(fake *fakeMeili, maxDocs int) *face.Index {
+	return fake.newIndex(&conf.IndexConf{
+		Timeout: time.Millisecond * 10,
+		BatchMaxDocs: maxDocs,
+		BatchLinger: time.Millisecond * 100,
+	}, 1)
+}
+
+//wait futures done, return failed count
+func waitFutures(t *testing.T, futures []*face.WriteFuture) int {
+	failed := 0
+	for _, future := range futures {
+		select {
+		case <- future.Done():
+		case <- time.After(time.Second * 5):
+			t.Fatalf("wait write timeout")
+		}
+		if future.Err() != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+//test queued writes coalesced into one batch
+func TestBatchCoalesce(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := newBatchIndex(fake, 10)
+	defer index.Quit(context.Background())
+
+	futures := make([]*face.WriteFuture, 0)
+	for i := 0; i < 5; i++ {
+		future, err := index.GetDoc().AddDoc(map[string]interface{}{"id": i})
+		if err != nil {
+			t.Errorf("add doc failed, err:%v", err.Error())
+			return
+		}
+		futures = append(futures, future)
+	}
+	if failed := waitFutures(t, futures); failed > 0 {
+		t.Errorf("%v writes failed", failed)
+		return
+	}
+	batches := fake.getBatches()
+	if len(batches) != 1 || batches[0] != 5 {
+		t.Errorf("expect one batch of 5 docs, got %v", batches)
+	}
+}
+
+//test batch split by max docs
+func TestBatchMaxDocs(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := newBatchIndex(fake, 2)
+	defer index.Quit(context.Background())
+
+	futures := make([]*face.WriteFuture, 0)
+	for i := 0; i < 5; i++ {
+		future, _ := index.GetDoc().AddDoc(map[string]interface{}{"id": i})
+		futures = append(futures, future)
+	}
+	waitFutures(t, futures)
+	total := 0
+	for _, docs := range fake.getBatches() {
+		if docs > 2 {
+			t.Errorf("batch of %v docs over limit", docs)
+		}
+		total += docs
+	}
+	if total != 5 {
+		t.Errorf("expect 5 docs written, got %v", total)
+	}
+}
+
+//test request expired while lingering skipped
+func TestBatchExpiredReq(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := newBatchIndex(fake, 10)
+	defer index.Quit(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 20)
+	defer cancel()
+	expired, _ := index.GetDoc().AddDocWithContext(ctx, map[string]interface{}{"id": 1})
+	future, _ := index.GetDoc().AddDoc(map[string]interface{}{"id": 2})
+	if failed := waitFutures(t, []*face.WriteFuture{expired, future}); failed != 1 {
+		t.Errorf("expect 1 write failed, got %v", failed)
+		return
+	}
+	if ids := fake.getDocIds(IndexName); len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("expect only doc 2 written, got %v", ids)
+	}
+}
+
+//test batch failed by bad doc resubmitted one by one
+func TestBatchBadDoc(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := newBatchIndex(fake, 10)
+	defer index.Quit(context.Background())
+
+	good, _ := index.GetDoc().AddDoc(map[string]interface{}{"id": 1})
+	bad, _ := index.GetDoc().AddDoc(map[string]interface{}{"id": 2, "bad": true})
+	other, _ := index.GetDoc().AddDoc(map[string]interface{}{"id": 3})
+	waitFutures(t, []*face.WriteFuture{good, bad, other})
+
+	if good.Err() != nil || other.Err() != nil {
+		t.Errorf("good docs failed, err:%v, %v", good.Err(), other.Err())
+		return
+	}
+	if bad.Err() == nil {
+		t.Errorf("bad doc not failed")
+		return
+	}
+	if ids := fake.getDocIds(IndexName); len(ids) != 2 {
+		t.Errorf("expect 2 docs written, got %v", ids)
+	}
+}
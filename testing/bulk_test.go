@@ -0,0 +1,122 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//doc of bulk ingest
+type bulkDoc struct {
+	Id      json.RawMessage `json:"id"`
+	Version int             `json:"version"`
+}
+
+//get docs of each bulk write request
+func getBulkBatches(t *testing.T, fake *fakeMeili) [][]bulkDoc {
+	batches := make([][]bulkDoc, 0)
+	for _, req := range fake.getRequests("POST /indexes/" + IndexName + "/documents") {
+		docs := make([]bulkDoc, 0)
+		parts := strings.SplitN(req, " ", 3)
+		if err := json.Unmarshal([]byte(parts[2]), &docs); err != nil {
+			t.Errorf("invalid batch body %v", parts[2])
+			return nil
+		}
+		batches = append(batches, docs)
+	}
+	return batches
+}
+
+//test docs of same id hashed into same lane, string and int id same
+func TestBulkLaneHash(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	docs := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		docs = append(docs, fmt.Sprintf(`{"id":%v,"version":1}`, i))
+		docs = append(docs, fmt.Sprintf(`{"id":"%v","version":2}`, i))
+	}
+	progress, err := index.GetDoc().BulkIngest(context.Background(), strings.NewReader(strings.Join(docs, "\n")), &face.BulkOptions{
+		BatchDocs: 1000,
+		Concurrency: 4,
+	})
+	if err != nil || progress.DocsIndexed != 40 {
+		t.Errorf("bulk ingest failed, progress:%+v, err:%v", progress, err)
+		return
+	}
+
+	//one batch of each lane, all versions of one id in same batch
+	batches := getBulkBatches(t, fake)
+	if len(batches) <= 1 || len(batches) > 4 {
+		t.Errorf("expect 2~4 lanes used, got %v", len(batches))
+		return
+	}
+	idBatch := map[string]int{}
+	for i, batch := range batches {
+		for _, doc := range batch {
+			id := strings.Trim(string(doc.Id), `"`)
+			if idx, ok := idBatch[id]; ok && idx != i {
+				t.Errorf("id %v hashed into batch %v and %v", id, idx, i)
+				return
+			}
+			idBatch[id] = i
+		}
+	}
+	if len(idBatch) != 20 {
+		t.Errorf("expect 20 ids, got %v", len(idBatch))
+	}
+}
+
+//test writes of same id submitted in order
+func TestBulkLaneOrder(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	docs := make([]interface{}, 0)
+	for i := 1; i <= 10; i++ {
+		docs = append(docs, map[string]interface{}{"id": "a", "version": i})
+		docs = append(docs, map[string]interface{}{"id": i + 100, "version": i})
+	}
+	_, err := index.GetDoc().BulkIngest(context.Background(), docs, &face.BulkOptions{
+		BatchDocs: 1,
+		Concurrency: 4,
+	})
+	if err != nil {
+		t.Errorf("bulk ingest failed, err:%v", err.Error())
+		return
+	}
+
+	//versions of same id submitted one by one
+	versions := make([]int, 0)
+	for _, batch := range getBulkBatches(t, fake) {
+		for _, doc := range batch {
+			if string(doc.Id) == `"a"` {
+				versions = append(versions, doc.Version)
+			}
+		}
+	}
+	for i, version := range versions {
+		if version != i + 1 {
+			t.Errorf("writes of same id out of order, got %v", versions)
+			return
+		}
+	}
+	if len(versions) != 10 {
+		t.Errorf("expect 10 writes, got %v", versions)
+		return
+	}
+	doc := fake.getDoc(IndexName, "a")
+	if string(doc["version"]) != "10" {
+		t.Errorf("expect last version kept, got %s", doc["version"])
+	}
+}
@@ -0,0 +1,42 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+)
+
+//test create index again quit the old index obj
+func TestCreateIndexReplace(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	indexConf := &conf.IndexConf{
+		IndexName: IndexName,
+		PrimaryKey: PrimaryKey,
+	}
+	if err := client.CreateIndex(indexConf); err != nil {
+		t.Errorf("create index failed, err:%v", err.Error())
+		return
+	}
+	oldIndex, _ := client.GetIndex(IndexName)
+	if err := client.CreateIndex(indexConf); err != nil {
+		t.Errorf("create index again failed, err:%v", err.Error())
+		return
+	}
+	newIndex, _ := client.GetIndex(IndexName)
+	if newIndex == nil || newIndex == oldIndex {
+		t.Errorf("index obj not replaced")
+		return
+	}
+	if !oldIndex.GetDoc().IsClosed() {
+		t.Errorf("old index obj not quit")
+		return
+	}
+	if newIndex.GetDoc().IsClosed() {
+		t.Errorf("new index obj closed")
+	}
+}
@@ -1,16 +1,18 @@
 package testing
 
 import (
+	"context"
 	"fmt"
 	"github.com/andyzhou/tinymeili/conf"
 	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/face"
 	"math/rand"
 	"testing"
 	"time"
 )
 
 //add new doc
-func addDoc() error {
+func addDoc() (*face.WriteFuture, error) {
 	//init obj
 	obj := NewTestDoc()
 	obj.Id = time.Now().UnixNano()
@@ -23,12 +25,11 @@ func addDoc() error {
 	//get index obj
 	indexObj, err := getIndexObj(IndexName)
 	if err != nil || indexObj == nil {
-		return err
+		return nil, err
 	}
 
 	//add doc
-	err = indexObj.GetDoc().AddDoc(obj)
-	return err
+	return indexObj.GetDoc().AddDoc(obj)
 }
 
 //get one doc
@@ -65,12 +66,43 @@ func queryDoc() error {
 
 //test add doc
 func TestAddDoc(t *testing.T) {
-	err := addDoc()
+	future, err := addDoc()
+	if err != nil {
+		t.Errorf("add doc failed, err:%v\n", err.Error())
+		return
+	}
+
+	//wait for final result
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 5)
+	defer cancel()
+	err = future.Wait(ctx)
 	if err != nil {
 		t.Errorf("add doc failed, err:%v\n", err.Error())
 	}else{
-		t.Logf("add doc succeed")
+		t.Logf("add doc succeed, task:%v", future.TaskInfo().TaskUID)
+	}
+}
+
+//test typed search
+func TestSearchDoc(t *testing.T) {
+	//get index obj
+	indexObj, err := getIndexObj(IndexName)
+	if err != nil || indexObj == nil {
+		t.Errorf("get index failed, err:%v\n", err)
+		return
+	}
+
+	para := &define.QueryPara{
+		Key: "test",
+		Page: 1,
+		PageSize: 10,
+	}
+	resp, err := face.Search[TestDoc](indexObj.GetDoc(), para)
+	if err != nil {
+		t.Errorf("search doc failed, err:%v\n", err.Error())
+		return
 	}
+	t.Logf("search doc, total:%v, hits:%v\n", resp.TotalHits, resp.Hits)
 }
 
 func TestGetDoc(t *testing.T) {
@@ -126,7 +158,7 @@ func BenchmarkAddDoc(b *testing.B) {
 	succeed := 0
 	failed := 0
 	for i := 0; i < b.N; i++ {
-		err = addDoc()
+		_, err = addDoc()
 		if err != nil {
 			failed++
 		}else{
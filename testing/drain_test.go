@@ -0,0 +1,138 @@
+package testing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//send writes into one worker
+func sendDrainWrites(doc *face.Doc, count int) error {
+	for i := 0; i < count; i++ {
+		_, err := doc.AddDoc(map[string]interface{}{"id": i}, "1")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//test pending writes flushed by quit
+func TestDrainFlushed(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.writeDelay = time.Millisecond * 20
+	fake.writeFails = 1
+	doc := fake.newIndex(&conf.IndexConf{}, 1).GetDoc()
+	if err := sendDrainWrites(doc, 3); err != nil {
+		t.Errorf("add doc failed, err:%v", err.Error())
+		return
+	}
+
+	report, err := doc.Quit(context.Background())
+	if err != nil {
+		t.Errorf("quit failed, err:%v", err.Error())
+		return
+	}
+	if report.Flushed != 2 || report.Failed != 1 || report.Abandoned != 0 {
+		t.Errorf("unexpected report %+v", *report)
+		return
+	}
+
+	//writes rejected after quit
+	if _, err = doc.AddDoc(map[string]interface{}{"id": 4}); err != face.ErrDocClosed {
+		t.Errorf("expect ErrDocClosed, got %v", err)
+	}
+}
+
+//test pending writes abandoned after quit deadline
+func TestDrainAbandoned(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.writeDelay = time.Millisecond * 300
+	doc := fake.newIndex(&conf.IndexConf{}, 1).GetDoc()
+	if err := sendDrainWrites(doc, 3); err != nil {
+		t.Errorf("add doc failed, err:%v", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 50)
+	defer cancel()
+	report, err := doc.Quit(ctx)
+	if err == nil {
+		t.Errorf("expect quit deadline error")
+		return
+	}
+	if report.Abandoned != 3 {
+		t.Errorf("expect 3 abandoned, got %+v", *report)
+	}
+}
+
+//test doc recovered if re-create failed
+func TestReCreateIndexRecover(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.deleteFails = 1
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+	oldDoc := index.GetDoc()
+
+	if err := index.ReCreateIndex(); err == nil {
+		t.Errorf("expect re-create failed")
+		return
+	}
+	doc := index.GetDoc()
+	if doc == oldDoc || doc.IsClosed() {
+		t.Errorf("doc not recovered")
+		return
+	}
+	future, err := doc.AddDoc(map[string]interface{}{"id": 1})
+	if err != nil {
+		t.Errorf("add doc failed, err:%v", err.Error())
+		return
+	}
+	if failed := waitFutures(t, []*face.WriteFuture{future}); failed > 0 {
+		t.Errorf("write of recovered doc failed, err:%v", future.Err())
+	}
+}
+
+//test get doc while re-creating
+func TestReCreateIndexGetDoc(t *testing.T) {
+	var (
+		wg sync.WaitGroup
+	)
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	done := make(chan bool)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <- done:
+				return
+			default:
+				//rejected while old doc closed
+				index.GetDoc().AddDoc(map[string]interface{}{"id": 1})
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		if err := index.ReCreateIndex(); err != nil {
+			t.Errorf("re-create failed, err:%v", err.Error())
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+	if index.GetDoc().IsClosed() {
+		t.Errorf("doc closed after re-create")
+	}
+}
@@ -0,0 +1,1074 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+	"github.com/andyzhou/tinymeili/lib"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+/*
+ * in-memory fake meili server for offline tests
+ * - indexes, docs, settings, swap, tasks and keys kept in memory
+ * - tasks finished at once, write and poll failures injectable
+ * - filters of docs fetch ignored
+ */
+
+//fake index
+type fakeIndex struct {
+	uid        string
+	primaryKey string
+	ids        []string                              //doc ids in insert order
+	docs       map[string]map[string]json.RawMessage //id -> doc fields
+	settings   map[string]interface{}
+}
+
+//fake meili server
+type fakeMeili struct {
+	server     *httptest.Server
+	writeFails int32         //docs writes answered with 503 first
+	pollFails  int32         //task polls answered with 500 first
+	taskFails  int32         //docs tasks finished as failed first
+	taskCode   string        //error code of failed task
+	deleteFails int32        //index deletes answered with 400 first
+	writeDelay time.Duration //delay of docs writes
+	writes     int32         //docs writes received
+	readDelay  time.Duration //delay of docs fetching
+	backupFails int32        //dumps and snapshots answered with 400 first
+	indexes    map[string]*fakeIndex
+	tasks      map[int64]map[string]interface{}
+	keys       map[string]map[string]interface{} //uid -> key
+	batches    []int                             //docs count of each accepted write
+	requests   []string                          //method path body of requests
+	taskUid    int64
+	keyUid     int64
+	sync.Mutex
+}
+
+//new fake meili server
+func newFakeMeili() *fakeMeili {
+	this := &fakeMeili{
+		indexes: map[string]*fakeIndex{},
+		tasks: map[int64]map[string]interface{}{},
+		keys: map[string]map[string]interface{}{},
+	}
+	this.server = httptest.NewServer(http.HandlerFunc(this.serve))
+	return this
+}
+
+//close server
+func (f *fakeMeili) Close() {
+	f.server.Close()
+}
+
+//get server url
+func (f *fakeMeili) URL() string {
+	return f.server.URL
+}
+
+//new client of fake server
+//config can be changed by setup funcs
+func (f *fakeMeili) newClient(setups ...func(cfg *conf.ClientConf)) *face.Client {
+	cfg := &conf.ClientConf{
+		Tag: HostTag,
+		Host: f.URL(),
+		ApiKey: ApiKey,
+		TimeOut: 5 * time.Second,
+		Workers: 2,
+		Metrics: lib.NopSink{},
+	}
+	for _, setup := range setups {
+		setup(cfg)
+	}
+	return face.NewClient(cfg)
+}
+
+//new index of fake server
+//index name and primary key filled if empty
+func (f *fakeMeili) newIndex(indexConf *conf.IndexConf, workers int) *face.Index {
+	if indexConf.IndexName == "" {
+		indexConf.IndexName = IndexName
+	}
+	if indexConf.PrimaryKey == "" {
+		indexConf.PrimaryKey = PrimaryKey
+	}
+	if indexConf.Host == "" {
+		indexConf.Host = f.URL()
+		indexConf.ApiKey = ApiKey
+	}
+	if indexConf.Metrics == nil {
+		indexConf.Metrics = lib.NopSink{}
+	}
+	client := meilisearch.New(f.URL(), meilisearch.WithAPIKey(ApiKey), meilisearch.DisableRetries())
+	return face.NewIndex(client, indexConf, workers)
+}
+
+//get accepted docs batches
+func (f *fakeMeili) getBatches() []int {
+	f.Lock()
+	defer f.Unlock()
+	return append([]int{}, f.batches...)
+}
+
+//get received requests with path prefix
+func (f *fakeMeili) getRequests(prefix string) []string {
+	f.Lock()
+	defer f.Unlock()
+	result := make([]string, 0)
+	for _, req := range f.requests {
+		if strings.HasPrefix(req, prefix) {
+			result = append(result, req)
+		}
+	}
+	return result
+}
+
+//get doc ids of index in insert order
+func (f *fakeMeili) getDocIds(uid string) []string {
+	f.Lock()
+	defer f.Unlock()
+	index, ok := f.indexes[uid]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, index.ids...)
+}
+
+//get raw doc of index
+func (f *fakeMeili) getDoc(uid, id string) map[string]json.RawMessage {
+	f.Lock()
+	defer f.Unlock()
+	index, ok := f.indexes[uid]
+	if !ok {
+		return nil
+	}
+	return index.docs[id]
+}
+
+//get index names
+func (f *fakeMeili) getIndexNames() []string {
+	f.Lock()
+	defer f.Unlock()
+	names := make([]string, 0, len(f.indexes))
+	for name := range f.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//put docs into index directly
+func (f *fakeMeili) putDocs(uid string, docs ...string) {
+	f.Lock()
+	defer f.Unlock()
+	index := f.getOrCreateIndex(uid, PrimaryKey)
+	for _, doc := range docs {
+		fields := map[string]json.RawMessage{}
+		json.Unmarshal([]byte(doc), &fields)
+		index.putDoc(fields, false)
+	}
+}
+
+//put finished task directly, return task uid
+func (f *fakeMeili) putTask(uid, taskType, status string) int64 {
+	f.Lock()
+	defer f.Unlock()
+	f.taskUid++
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	task := map[string]interface{}{
+		"uid": f.taskUid,
+		"indexUid": uid,
+		"status": status,
+		"type": taskType,
+		"enqueuedAt": now,
+		"startedAt": now,
+		"finishedAt": now,
+	}
+	if status == "failed" {
+		task["error"] = map[string]interface{}{
+			"message": "task failed",
+			"code": "internal",
+			"type": "internal",
+		}
+	}
+	f.tasks[f.taskUid] = task
+	return f.taskUid
+}
+
+//set settings of index directly
+func (f *fakeMeili) setSettings(uid string, settings string) {
+	f.Lock()
+	defer f.Unlock()
+	index := f.getOrCreateIndex(uid, PrimaryKey)
+	json.Unmarshal([]byte(settings), &index.settings)
+}
+
+//get settings of index
+func (f *fakeMeili) getSettings(uid string) map[string]interface{} {
+	f.Lock()
+	defer f.Unlock()
+	index, ok := f.indexes[uid]
+	if !ok {
+		return nil
+	}
+	return index.settings
+}
+
+//serve requests
+func (f *fakeMeili) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.Lock()
+	f.requests = append(f.requests, r.Method + " " + r.URL.Path + " " + string(body))
+	f.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "indexes" && len(parts) >= 3 && parts[2] == "documents":
+		f.serveDocs(w, r, parts, body)
+	case parts[0] == "indexes" && len(parts) >= 3 && parts[2] == "settings":
+		f.serveSettings(w, r, parts, body)
+	case parts[0] == "indexes" && len(parts) == 3 && parts[2] == "stats":
+		f.serveStats(w, parts[1])
+	case parts[0] == "indexes" && len(parts) == 3 && parts[2] == "search":
+		f.serveSearch(w, parts[1], body)
+	case parts[0] == "indexes":
+		f.serveIndexes(w, r, parts, body)
+	case parts[0] == "swap-indexes":
+		f.serveSwap(w, body)
+	case parts[0] == "multi-search":
+		f.serveMultiSearch(w, body)
+	case parts[0] == "tasks":
+		f.serveTasks(w, r, parts)
+	case parts[0] == "keys":
+		f.serveKeys(w, r, parts, body)
+	case parts[0] == "dumps" || parts[0] == "snapshots":
+		if atomic.AddInt32(&f.backupFails, -1) >= 0 {
+			writeFakeError(w, http.StatusBadRequest, "backup_failed")
+			return
+		}
+		f.writeTask(w, "", parts[0][:len(parts[0]) - 1] + "Creation", nil, nil)
+	default:
+		writeFakeError(w, http.StatusNotFound, "not_found")
+	}
+}
+
+//serve index crud
+func (f *fakeMeili) serveIndexes(
+	w http.ResponseWriter,
+	r *http.Request,
+	parts []string,
+	body []byte) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		req := map[string]string{}
+		json.Unmarshal(body, &req)
+		if _, ok := f.indexes[req["uid"]]; ok {
+			f.writeTaskLocked(w, req["uid"], "indexCreation", nil, map[string]interface{}{
+				"message": "index already exists",
+				"code": "index_already_exists",
+				"type": "invalid_request",
+			})
+			return
+		}
+		f.getOrCreateIndex(req["uid"], req["primaryKey"])
+		f.writeTaskLocked(w, req["uid"], "indexCreation", nil, nil)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		index, ok := f.indexes[parts[1]]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "index_not_found")
+			return
+		}
+		writeFakeJson(w, http.StatusOK, map[string]interface{}{
+			"uid": index.uid,
+			"primaryKey": index.primaryKey,
+		})
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		if atomic.AddInt32(&f.deleteFails, -1) >= 0 {
+			writeFakeError(w, http.StatusBadRequest, "invalid_request")
+			return
+		}
+		delete(f.indexes, parts[1])
+		f.writeTaskLocked(w, parts[1], "indexDeletion", nil, nil)
+	default:
+		writeFakeError(w, http.StatusNotFound, "not_found")
+	}
+}
+
+//serve docs opt
+func (f *fakeMeili) serveDocs(
+	w http.ResponseWriter,
+	r *http.Request,
+	parts []string,
+	body []byte) {
+	uid := parts[1]
+	switch {
+	case len(parts) == 3 && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		f.serveWriteDocs(w, r, uid, body)
+	case len(parts) == 3 && r.Method == http.MethodGet,
+		len(parts) == 4 && parts[3] == "fetch":
+		f.serveFetchDocs(w, r, uid, body)
+	case len(parts) == 4 && parts[3] == "delete-batch":
+		ids := make([]interface{}, 0)
+		json.Unmarshal(body, &ids)
+		f.Lock()
+		defer f.Unlock()
+		index := f.getOrCreateIndex(uid, PrimaryKey)
+		for _, id := range ids {
+			index.removeDoc(normalizeFakeId(id))
+		}
+		f.writeTaskLocked(w, uid, "documentDeletion", nil, nil)
+	case len(parts) == 4 && r.Method == http.MethodDelete:
+		f.Lock()
+		defer f.Unlock()
+		f.getOrCreateIndex(uid, PrimaryKey).removeDoc(parts[3])
+		f.writeTaskLocked(w, uid, "documentDeletion", nil, nil)
+	case len(parts) == 4 && r.Method == http.MethodGet:
+		f.Lock()
+		defer f.Unlock()
+		index, ok := f.indexes[uid]
+		if !ok || index.docs[parts[3]] == nil {
+			writeFakeError(w, http.StatusNotFound, "document_not_found")
+			return
+		}
+		writeFakeJson(w, http.StatusOK, index.docs[parts[3]])
+	case len(parts) == 4 && parts[3] == "delete":
+		f.Lock()
+		defer f.Unlock()
+		f.writeTaskLocked(w, uid, "documentDeletion", nil, nil)
+	default:
+		writeFakeError(w, http.StatusNotFound, "not_found")
+	}
+}
+
+//serve docs writing
+func (f *fakeMeili) serveWriteDocs(
+	w http.ResponseWriter,
+	r *http.Request,
+	uid string,
+	body []byte) {
+	atomic.AddInt32(&f.writes, 1)
+	if atomic.AddInt32(&f.writeFails, -1) >= 0 {
+		writeFakeError(w, http.StatusServiceUnavailable, "unavailable")
+		return
+	}
+	if f.writeDelay > 0 {
+		time.Sleep(f.writeDelay)
+	}
+
+	//decode docs, csv, json array or ndjson
+	docs := make([]map[string]json.RawMessage, 0)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		docs = decodeFakeCsv(body)
+	}else if json.Unmarshal(body, &docs) != nil {
+		decoder := json.NewDecoder(strings.NewReader(string(body)))
+		for decoder.More() {
+			doc := map[string]json.RawMessage{}
+			if decoder.Decode(&doc) != nil {
+				break
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	f.batches = append(f.batches, len(docs))
+	details := map[string]interface{}{
+		"receivedDocuments": len(docs),
+		"indexedDocuments": len(docs),
+	}
+
+	//injected failure, or doc with `bad` field failed whole task
+	var taskErr map[string]interface{}
+	if atomic.AddInt32(&f.taskFails, -1) >= 0 {
+		taskErr = map[string]interface{}{
+			"message": "task failed",
+			"code": f.taskCode,
+			"type": "internal",
+		}
+	}
+	for _, doc := range docs {
+		if _, ok := doc["bad"]; ok {
+			taskErr = map[string]interface{}{
+				"message": "invalid document",
+				"code": "invalid_document_fields",
+				"type": "invalid_request",
+			}
+		}
+	}
+	if taskErr != nil {
+		details["indexedDocuments"] = 0
+		f.writeTaskLocked(w, uid, "documentAdditionOrUpdate", details, taskErr)
+		return
+	}
+
+	primaryKey := r.URL.Query().Get("primaryKey")
+	if primaryKey == "" {
+		primaryKey = PrimaryKey
+	}
+	index := f.getOrCreateIndex(uid, primaryKey)
+	for _, doc := range docs {
+		index.putDoc(doc, r.Method == http.MethodPut)
+	}
+	f.writeTaskLocked(w, uid, "documentAdditionOrUpdate", details, nil)
+}
+
+//serve docs fetching, filter ignored
+func (f *fakeMeili) serveFetchDocs(
+	w http.ResponseWriter,
+	r *http.Request,
+	uid string,
+	body []byte) {
+	query := struct {
+		Limit  int64    `json:"limit"`
+		Offset int64    `json:"offset"`
+		Fields []string `json:"fields"`
+	}{Limit: 20}
+	if f.readDelay > 0 {
+		time.Sleep(f.readDelay)
+	}
+	if r.Method == http.MethodPost {
+		json.Unmarshal(body, &query)
+	}else{
+		values := r.URL.Query()
+		if v := values.Get("limit"); v != "" {
+			query.Limit, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v := values.Get("offset"); v != "" {
+			query.Offset, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v := values.Get("fields"); v != "" {
+			query.Fields = strings.Split(v, ",")
+		}
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	index, ok := f.indexes[uid]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "index_not_found")
+		return
+	}
+	results := make([]map[string]json.RawMessage, 0)
+	for i := query.Offset; i < int64(len(index.ids)) && i < query.Offset + query.Limit; i++ {
+		doc := index.docs[index.ids[i]]
+		if len(query.Fields) > 0 {
+			picked := map[string]json.RawMessage{}
+			for _, field := range query.Fields {
+				if v, ok := doc[field]; ok {
+					picked[field] = v
+				}
+			}
+			doc = picked
+		}
+		results = append(results, doc)
+	}
+	writeFakeJson(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"limit": query.Limit,
+		"offset": query.Offset,
+		"total": len(index.ids),
+	})
+}
+
+//serve settings
+func (f *fakeMeili) serveSettings(
+	w http.ResponseWriter,
+	r *http.Request,
+	parts []string,
+	body []byte) {
+	f.Lock()
+	defer f.Unlock()
+	index := f.getOrCreateIndex(parts[1], PrimaryKey)
+
+	//whole settings
+	if len(parts) == 3 {
+		if r.Method == http.MethodGet {
+			writeFakeJson(w, http.StatusOK, index.settings)
+			return
+		}
+		update := map[string]interface{}{}
+		json.Unmarshal(body, &update)
+		for k, v := range update {
+			index.settings[k] = mergeFakeSetting(index.settings[k], v)
+		}
+		f.writeTaskLocked(w, index.uid, "settingsUpdate", nil, nil)
+		return
+	}
+
+	//sub setting, kebab name into camel name
+	names := strings.Split(parts[3], "-")
+	for i := 1; i < len(names); i++ {
+		names[i] = strings.ToUpper(names[i][:1]) + names[i][1:]
+	}
+	name := strings.Join(names, "")
+	switch r.Method {
+	case http.MethodGet:
+		writeFakeJson(w, http.StatusOK, index.settings[name])
+		return
+	case http.MethodDelete:
+		delete(index.settings, name)
+	default:
+		var v interface{}
+		json.Unmarshal(body, &v)
+		if r.Method == http.MethodPatch {
+			v = mergeFakeSetting(index.settings[name], v)
+		}
+		index.settings[name] = v
+	}
+	f.writeTaskLocked(w, index.uid, "settingsUpdate", nil, nil)
+}
+
+//serve index stats
+func (f *fakeMeili) serveStats(w http.ResponseWriter, uid string) {
+	f.Lock()
+	defer f.Unlock()
+	index, ok := f.indexes[uid]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "index_not_found")
+		return
+	}
+	fields := map[string]int{}
+	for _, doc := range index.docs {
+		for field := range doc {
+			fields[field]++
+		}
+	}
+	writeFakeJson(w, http.StatusOK, map[string]interface{}{
+		"numberOfDocuments": len(index.ids),
+		"isIndexing": false,
+		"fieldDistribution": fields,
+	})
+}
+
+//serve search, all docs matched
+//`_formatted` filled with highlighted doc if highlight assigned
+func (f *fakeMeili) serveSearch(w http.ResponseWriter, uid string, body []byte) {
+	f.Lock()
+	defer f.Unlock()
+	writeFakeJson(w, http.StatusOK, f.genSearchResult(uid, body))
+}
+
+//serve multi search
+func (f *fakeMeili) serveMultiSearch(w http.ResponseWriter, body []byte) {
+	req := struct {
+		Federation *json.RawMessage  `json:"federation"`
+		Queries    []json.RawMessage `json:"queries"`
+	}{}
+	json.Unmarshal(body, &req)
+
+	f.Lock()
+	defer f.Unlock()
+	if req.Federation == nil {
+		results := make([]interface{}, 0, len(req.Queries))
+		for _, query := range req.Queries {
+			q := struct {
+				IndexUid string `json:"indexUid"`
+			}{}
+			json.Unmarshal(query, &q)
+			result := f.genSearchResult(q.IndexUid, query)
+			result["indexUid"] = q.IndexUid
+			results = append(results, result)
+		}
+		writeFakeJson(w, http.StatusOK, map[string]interface{}{
+			"results": results,
+		})
+		return
+	}
+
+	//federated, facets of query not allowed
+	hits := make([]interface{}, 0)
+	for i, query := range req.Queries {
+		q := struct {
+			IndexUid string   `json:"indexUid"`
+			Facets   []string `json:"facets"`
+		}{}
+		json.Unmarshal(query, &q)
+		if q.Facets != nil {
+			writeFakeError(w, http.StatusBadRequest, "invalid_multi_search_query_facets")
+			return
+		}
+		index, ok := f.indexes[q.IndexUid]
+		if !ok {
+			continue
+		}
+		for _, id := range index.ids {
+			hit := map[string]interface{}{}
+			for k, v := range index.docs[id] {
+				hit[k] = v
+			}
+			hit["_federation"] = map[string]interface{}{
+				"indexUid": q.IndexUid,
+				"queriesPosition": i,
+				"weightedRankingScore": 1.0,
+			}
+			hits = append(hits, hit)
+		}
+	}
+	writeFakeJson(w, http.StatusOK, map[string]interface{}{
+		"hits": hits,
+		"processingTimeMs": 0,
+		"limit": 20,
+		"offset": 0,
+		"estimatedTotalHits": len(hits),
+	})
+}
+
+//serve swap indexes
+func (f *fakeMeili) serveSwap(w http.ResponseWriter, body []byte) {
+	swaps := make([]struct {
+		Indexes []string `json:"indexes"`
+	}, 0)
+	json.Unmarshal(body, &swaps)
+
+	f.Lock()
+	defer f.Unlock()
+	for _, swap := range swaps {
+		if len(swap.Indexes) != 2 {
+			continue
+		}
+		a, b := f.indexes[swap.Indexes[0]], f.indexes[swap.Indexes[1]]
+		if a == nil || b == nil {
+			f.writeTaskLocked(w, "", "indexSwap", nil, map[string]interface{}{
+				"message": "index not found",
+				"code": "index_not_found",
+				"type": "invalid_request",
+			})
+			return
+		}
+		a.uid, b.uid = b.uid, a.uid
+		f.indexes[a.uid], f.indexes[b.uid] = a, b
+	}
+	f.writeTaskLocked(w, "", "indexSwap", nil, nil)
+}
+
+//serve tasks
+func (f *fakeMeili) serveTasks(
+	w http.ResponseWriter,
+	r *http.Request,
+	parts []string) {
+	f.Lock()
+	defer f.Unlock()
+
+	//get one task
+	if len(parts) == 2 && r.Method == http.MethodGet {
+		if atomic.AddInt32(&f.pollFails, -1) >= 0 {
+			writeFakeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+		taskUid, _ := strconv.ParseInt(parts[1], 10, 64)
+		task, ok := f.tasks[taskUid]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "task_not_found")
+			return
+		}
+		writeFakeJson(w, http.StatusOK, task)
+		return
+	}
+
+	//filter tasks by statuses, types and index uids
+	values := r.URL.Query()
+	match := func(task map[string]interface{}, key, field string) bool {
+		v := values.Get(key)
+		if v == "" {
+			return true
+		}
+		for _, item := range strings.Split(v, ",") {
+			if item == task[field] {
+				return true
+			}
+		}
+		return false
+	}
+	uids := make([]int64, 0, len(f.tasks))
+	for uid, task := range f.tasks {
+		if match(task, "statuses", "status") &&
+			match(task, "types", "type") &&
+			match(task, "indexUids", "indexUid") {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		return uids[i] > uids[j]
+	})
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := int64(20)
+		if v := values.Get("limit"); v != "" {
+			limit, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v := values.Get("from"); v != "" {
+			from, _ := strconv.ParseInt(v, 10, 64)
+			for len(uids) > 0 && uids[0] > from {
+				uids = uids[1:]
+			}
+		}
+		total := len(uids)
+		var next interface{}
+		if int64(len(uids)) > limit {
+			next = uids[limit]
+			uids = uids[:limit]
+		}
+		results := make([]interface{}, 0, len(uids))
+		for _, uid := range uids {
+			results = append(results, f.tasks[uid])
+		}
+		writeFakeJson(w, http.StatusOK, map[string]interface{}{
+			"results": results,
+			"total": total,
+			"limit": limit,
+			"next": next,
+		})
+	case http.MethodDelete:
+		for _, uid := range uids {
+			delete(f.tasks, uid)
+		}
+		f.writeTaskLocked(w, "", "taskDeletion", map[string]interface{}{
+			"deletedTasks": len(uids),
+		}, nil)
+	default:
+		f.writeTaskLocked(w, "", "taskCancelation", nil, nil)
+	}
+}
+
+//serve keys crud
+func (f *fakeMeili) serveKeys(
+	w http.ResponseWriter,
+	r *http.Request,
+	parts []string,
+	body []byte) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		uids := make([]string, 0, len(f.keys))
+		for uid := range f.keys {
+			uids = append(uids, uid)
+		}
+		sort.Strings(uids)
+		results := make([]interface{}, 0, len(uids))
+		for _, uid := range uids {
+			results = append(results, f.keys[uid])
+		}
+		writeFakeJson(w, http.StatusOK, map[string]interface{}{
+			"results": results,
+			"total": len(results),
+			"limit": len(results),
+		})
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		key := map[string]interface{}{}
+		json.Unmarshal(body, &key)
+		f.keyUid++
+		uid := "00000000-0000-4000-8000-" + strings.Repeat("0", 12 - len(strconv.FormatInt(f.keyUid, 10))) +
+			strconv.FormatInt(f.keyUid, 10)
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		key["uid"] = uid
+		key["key"] = "key-" + uid
+		key["createdAt"] = now
+		key["updatedAt"] = now
+		f.keys[uid] = key
+		writeFakeJson(w, http.StatusCreated, key)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "api_key_not_found")
+			return
+		}
+		writeFakeJson(w, http.StatusOK, key)
+	case len(parts) == 2 && r.Method == http.MethodPatch:
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "api_key_not_found")
+			return
+		}
+		update := map[string]interface{}{}
+		json.Unmarshal(body, &update)
+		for _, field := range []string{"name", "description"} {
+			if v, ok := update[field]; ok {
+				key[field] = v
+			}
+		}
+		key["updatedAt"] = time.Now().UTC().Format(time.RFC3339Nano)
+		writeFakeJson(w, http.StatusOK, key)
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		delete(f.keys, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusNotFound, "not_found")
+	}
+}
+
+//gen search result of index
+func (f *fakeMeili) genSearchResult(uid string, body []byte) map[string]interface{} {
+	req := struct {
+		AttributesToHighlight []string `json:"attributesToHighlight"`
+	}{}
+	json.Unmarshal(body, &req)
+	hits := make([]interface{}, 0)
+	if index, ok := f.indexes[uid]; ok {
+		for _, id := range index.ids {
+			hit := map[string]interface{}{}
+			for k, v := range index.docs[id] {
+				hit[k] = v
+			}
+			if len(req.AttributesToHighlight) > 0 {
+				hit["_formatted"] = genFakeFormatted(index.docs[id])
+			}
+			hits = append(hits, hit)
+		}
+	}
+	return map[string]interface{}{
+		"hits": hits,
+		"processingTimeMs": 0,
+		"limit": 20,
+		"offset": 0,
+		"estimatedTotalHits": len(hits),
+	}
+}
+
+//decode csv docs, `field:number` columns kept as numbers
+func decodeFakeCsv(body []byte) []map[string]json.RawMessage {
+	docs := make([]map[string]json.RawMessage, 0)
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil || len(rows) <= 0 {
+		return docs
+	}
+	header := rows[0]
+	for _, row := range rows[1:] {
+		doc := map[string]json.RawMessage{}
+		for i, col := range header {
+			if i >= len(row) {
+				break
+			}
+			if strings.HasSuffix(col, ":number") {
+				if row[i] != "" {
+					doc[strings.TrimSuffix(col, ":number")] = json.RawMessage(row[i])
+				}
+				continue
+			}
+			doc[col], _ = json.Marshal(row[i])
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+//gen formatted doc, string fields wrapped by `<em>`
+//numbers formatted as strings like meili
+func genFakeFormatted(doc map[string]json.RawMessage) map[string]interface{} {
+	formatted := map[string]interface{}{}
+	for k, v := range doc {
+		decoder := json.NewDecoder(bytes.NewReader(v))
+		decoder.UseNumber()
+		var val interface{}
+		if decoder.Decode(&val) == nil {
+			formatted[k] = genFakeFormattedValue(val)
+		}
+	}
+	return formatted
+}
+
+//gen formatted value
+func genFakeFormattedValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case string:
+		return "<em>" + v + "</em>"
+	case json.Number:
+		return v.String()
+	case []interface{}:
+		for i, sub := range v {
+			v[i] = genFakeFormattedValue(sub)
+		}
+		return v
+	case map[string]interface{}:
+		for k, sub := range v {
+			v[k] = genFakeFormattedValue(sub)
+		}
+		return v
+	}
+	return val
+}
+
+//get or create index, locker should be held
+func (f *fakeMeili) getOrCreateIndex(uid, primaryKey string) *fakeIndex {
+	index, ok := f.indexes[uid]
+	if ok {
+		return index
+	}
+	index = &fakeIndex{
+		uid: uid,
+		primaryKey: primaryKey,
+		docs: map[string]map[string]json.RawMessage{},
+		settings: genFakeDefaultSettings(),
+	}
+	f.indexes[uid] = index
+	return index
+}
+
+//write task info of finished task
+func (f *fakeMeili) writeTask(
+	w http.ResponseWriter,
+	uid, taskType string,
+	details, taskErr map[string]interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	f.writeTaskLocked(w, uid, taskType, details, taskErr)
+}
+
+//write task info of finished task, locker should be held
+func (f *fakeMeili) writeTaskLocked(
+	w http.ResponseWriter,
+	uid, taskType string,
+	details, taskErr map[string]interface{}) {
+	f.taskUid++
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	task := map[string]interface{}{
+		"uid": f.taskUid,
+		"indexUid": uid,
+		"status": "succeeded",
+		"type": taskType,
+		"enqueuedAt": now,
+		"startedAt": now,
+		"finishedAt": now,
+	}
+	if details != nil {
+		task["details"] = details
+	}
+	if taskErr != nil {
+		task["status"] = "failed"
+		task["error"] = taskErr
+	}
+	f.tasks[f.taskUid] = task
+
+	//tasks deletion and cancelation answered with 200
+	status := http.StatusAccepted
+	if taskType == "taskDeletion" || taskType == "taskCancelation" {
+		status = http.StatusOK
+	}
+	writeFakeJson(w, status, map[string]interface{}{
+		"taskUid": f.taskUid,
+		"indexUid": uid,
+		"status": "enqueued",
+		"type": taskType,
+		"enqueuedAt": now,
+	})
+}
+
+//put doc, fields merged if partial update
+func (i *fakeIndex) putDoc(doc map[string]json.RawMessage, isUpdate bool) {
+	var id interface{}
+	json.Unmarshal(doc[i.primaryKey], &id)
+	docId := normalizeFakeId(id)
+	old, ok := i.docs[docId]
+	if !ok {
+		i.ids = append(i.ids, docId)
+	}else if isUpdate {
+		for k, v := range old {
+			if _, exists := doc[k]; !exists {
+				doc[k] = v
+			}
+		}
+	}
+	i.docs[docId] = doc
+}
+
+//remove doc
+func (i *fakeIndex) removeDoc(docId string) {
+	if _, ok := i.docs[docId]; !ok {
+		return
+	}
+	delete(i.docs, docId)
+	for k, v := range i.ids {
+		if v == docId {
+			i.ids = append(i.ids[:k], i.ids[k + 1:]...)
+			break
+		}
+	}
+}
+
+//normalize doc id, number and string id are same
+func normalizeFakeId(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	idBytes, _ := json.Marshal(id)
+	return string(idBytes)
+}
+
+//merge object setting like meili patch
+func mergeFakeSetting(old, update interface{}) interface{} {
+	oldMap, ok := old.(map[string]interface{})
+	updateMap, isMap := update.(map[string]interface{})
+	if !ok || !isMap {
+		return update
+	}
+	merged := map[string]interface{}{}
+	for k, v := range oldMap {
+		merged[k] = v
+	}
+	for k, v := range updateMap {
+		merged[k] = mergeFakeSetting(merged[k], v)
+	}
+	return merged
+}
+
+//gen default settings of new index
+func genFakeDefaultSettings() map[string]interface{} {
+	settings := map[string]interface{}{}
+	json.Unmarshal([]byte(`{
+		"displayedAttributes": ["*"],
+		"searchableAttributes": ["*"],
+		"filterableAttributes": [],
+		"sortableAttributes": [],
+		"rankingRules": ["words", "typo", "proximity", "attribute", "sort", "exactness"],
+		"stopWords": [],
+		"synonyms": {},
+		"distinctAttribute": null,
+		"typoTolerance": {
+			"enabled": true,
+			"minWordSizeForTypos": {"oneTypo": 5, "twoTypos": 9},
+			"disableOnWords": [],
+			"disableOnAttributes": []
+		},
+		"faceting": {"maxValuesPerFacet": 100, "sortFacetValuesBy": {"*": "alpha"}},
+		"pagination": {"maxTotalHits": 1000},
+		"proximityPrecision": "byWord",
+		"searchCutoffMs": null
+	}`), &settings)
+	return settings
+}
+
+//write json response
+func writeFakeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+//write meili style error
+func writeFakeError(w http.ResponseWriter, status int, code string) {
+	writeFakeJson(w, status, map[string]string{
+		"message": code,
+		"code": code,
+		"type": "invalid_request",
+	})
+}
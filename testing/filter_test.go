@@ -0,0 +1,82 @@
+package testing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/filter"
+)
+
+// test filter expressions format
+func TestFilterFormat(t *testing.T) {
+	cases := map[string]filter.Expr{
+		`id = "a \"b\" \\c"`:                 filter.Eq("id", `a "b" \c`),
+		`age >= 18`:                          filter.Gte("age", 18),
+		`price 1.5 TO 10`:                    filter.Range("price", 1.5, 10),
+		`id IN ["1", "two words"]`:           filter.InStrings("id", "1", "two words"),
+		`"user name" EXISTS`:                 filter.Exists("user name"),
+		`tags IS EMPTY`:                      filter.IsEmpty("tags"),
+		`title STARTS WITH "go"`:             filter.StartsWith("title", "go"),
+		`NOT (a = 1 OR b = true)`:            filter.Not(filter.Or(filter.Eq("a", 1), filter.Eq("b", true))),
+		`(a = 1 OR a = 2) AND b IS NOT NULL`: filter.And(filter.Or(filter.Eq("a", 1), filter.Eq("a", 2)), filter.IsNotNull("b")),
+		`a = 1`:                              filter.And(filter.Eq("a", 1)),
+	}
+	for expected, expr := range cases {
+		if expr.String() != expected {
+			t.Errorf("expected %v, got %v", expected, expr.String())
+		}
+	}
+
+	//array-of-arrays form
+	arr := filter.Array(
+		[]filter.Expr{filter.Eq("a", 1), filter.Eq("a", 2)},
+		[]filter.Expr{filter.Lt("b", 3)},
+	)
+	if !reflect.DeepEqual(arr, [][]string{{"a = 1", "a = 2"}, {"b < 3"}}) {
+		t.Errorf("invalid array filter %v", arr)
+	}
+	if v := filter.Build(filter.Eq("a", 1)); v != "a = 1" {
+		t.Errorf("invalid build result %v", v)
+	}
+}
+
+// test raw and custom expressions wrapped when combined
+func TestFilterWrap(t *testing.T) {
+	cases := map[string]filter.Expr{
+		`a = 1 OR b = 2`:                    filter.Raw(" a = 1 OR b = 2 "),
+		`(a = 1 OR b = 2) AND c = 3`:        filter.And(filter.Raw("a = 1 OR b = 2"), filter.Eq("c", 3)),
+		`NOT (a = 1 OR b = 2)`:              filter.Not(filter.Raw("a = 1 OR b = 2")),
+		`(a = 1) OR NOT c = 3`:              filter.Or(filter.Raw("a = 1"), filter.Not(filter.Eq("c", 3))),
+		`(a = 1 OR b = 2)`:                  filter.And(filter.Raw("a = 1 OR b = 2")),
+		`c = 3 AND (x = 1 AND y = 2)`:       filter.And(filter.Eq("c", 3), filter.Raw(""), customExpr("x = 1 AND y = 2")),
+		`NOT (NOT a = 1 OR b IN [1, 2])`:    filter.Not(filter.Or(filter.Not(filter.Eq("a", 1)), filter.In("b", 1, 2))),
+	}
+	for expected, expr := range cases {
+		if expr.String() != expected {
+			t.Errorf("expected %v, got %v", expected, expr.String())
+		}
+	}
+}
+
+// test special chars of fields and values escaped
+func TestFilterEscape(t *testing.T) {
+	cases := map[string]filter.Expr{
+		`"a\"b" = "x"`:                       filter.Eq(`a"b`, "x"),
+		`"a b\\" != "\\"`:                    filter.Ne(`a b\`, `\`),
+		`title CONTAINS "\" OR id = 1"`:      filter.Contains("title", `" OR id = 1`),
+		`id NOT IN ["a\"", 2, true]`:         filter.NotIn("id", `a"`, 2, true),
+		`name = "" AND "x:y" = "1 AND 2"`:   filter.And(filter.Eq("name", nil), filter.Eq("x:y", "1 AND 2")),
+	}
+	for expected, expr := range cases {
+		if expr.String() != expected {
+			t.Errorf("expected %v, got %v", expected, expr.String())
+		}
+	}
+}
+
+// custom expression implemented by caller
+type customExpr string
+
+func (e customExpr) String() string {
+	return string(e)
+}
@@ -0,0 +1,55 @@
+package testing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/geo"
+)
+
+//test geo filter and sort format
+func TestGeoFormat(t *testing.T) {
+	center := geo.GeoPoint{Lat: 45.472735, Lng: 9.184019}
+	if v := geo.Radius(center, 2000); v != "_geoRadius(45.472735, 9.184019, 2000)" {
+		t.Errorf("invalid radius filter %v", v)
+	}
+	box := geo.BoundingBox(geo.GeoPoint{Lat: 45.5, Lng: 9.2}, geo.GeoPoint{Lat: 45.4, Lng: 9.1})
+	if box != "_geoBoundingBox([45.5, 9.2], [45.4, 9.1])" {
+		t.Errorf("invalid bounding box filter %v", box)
+	}
+	if _, err := geo.Polygon(center); err == nil {
+		t.Errorf("polygon with one point should failed")
+	}
+	if v := geo.SortByDistance(center, true); v != "_geoPoint(45.472735, 9.184019):asc" {
+		t.Errorf("invalid distance sort %v", v)
+	}
+}
+
+//test geo doc encode and decode
+func TestGeoDoc(t *testing.T) {
+	type store struct {
+		geo.GeoDoc
+		Id string `json:"id"`
+	}
+	obj := store{Id: "1"}
+	obj.Geo = geo.NewGeoPoint(1.5, 2.5)
+	data, _ := json.Marshal(obj)
+	if string(data) != `{"_geo":{"lat":1.5,"lng":2.5},"id":"1"}` {
+		t.Errorf("invalid geo doc %s", data)
+	}
+
+	hit := store{}
+	json.Unmarshal([]byte(`{"id":"1","_geoDistance":120}`), &hit)
+	if distance, ok := hit.GetDistance(); !ok || distance != 120 {
+		t.Errorf("invalid geo distance %v", distance)
+	}
+
+	indexConf := &conf.IndexConf{IndexName: "store", FilterableFields: []string{geo.FieldGeo}}
+	if err := geo.CheckFilterable(indexConf); err != nil {
+		t.Errorf("check filterable failed, err:%v", err.Error())
+	}
+	if err := geo.CheckSortable(indexConf); err == nil {
+		t.Errorf("check sortable should failed")
+	}
+}
@@ -0,0 +1,58 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//doc with big int field
+type highlightDoc struct {
+	Id    int64    `json:"id"`
+	Big   int64    `json:"big"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+//test formatted doc overlay text fields and keep int64 precision
+func TestHighlightFormattedDoc(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName, `{"id":1,"big":9007199254740993,"title":"go","tags":["a"]}`)
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	result, err := face.Search[face.SearchHit[highlightDoc]](index.GetDoc(), &define.QueryPara{
+		AttributesToHighlight: []string{"*"},
+	})
+	if err != nil {
+		t.Errorf("search failed, err:%v", err.Error())
+		return
+	}
+	if len(result.Hits) != 1 {
+		t.Errorf("expect 1 hit, got %v", len(result.Hits))
+		return
+	}
+	hit := result.Hits[0]
+	if hit.GetFormatted("title") != "<em>go</em>" {
+		t.Errorf("unexpected formatted title %v", hit.GetFormatted("title"))
+	}
+
+	doc, err := hit.FormattedDoc()
+	if err != nil {
+		t.Errorf("formatted doc failed, err:%v", err.Error())
+		return
+	}
+	if doc.Big != 9007199254740993 || doc.Id != 1 {
+		t.Errorf("formatted doc lost precision, got %+v", doc)
+	}
+	if doc.Title != "<em>go</em>" || len(doc.Tags) != 1 || doc.Tags[0] != "<em>a</em>" {
+		t.Errorf("formatted text not overlaid, got %+v", doc)
+	}
+	if hit.Doc.Title != "go" {
+		t.Errorf("origin doc changed, got %+v", hit.Doc)
+	}
+}
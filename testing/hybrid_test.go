@@ -0,0 +1,137 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/face"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+//get hybrid block of last request with prefix
+func getHybridBlock(t *testing.T, fake *fakeMeili, prefix string) map[string]interface{} {
+	reqs := fake.getRequests(prefix)
+	if len(reqs) <= 0 {
+		t.Errorf("no request %v", prefix)
+		return nil
+	}
+	body := map[string]interface{}{}
+	parts := strings.SplitN(reqs[len(reqs) - 1], " ", 3)
+	if err := json.Unmarshal([]byte(parts[2]), &body); err != nil {
+		t.Errorf("invalid request body %v", parts[2])
+		return nil
+	}
+	if queries, ok := body["queries"].([]interface{}); ok && len(queries) > 0 {
+		body, _ = queries[0].(map[string]interface{})
+	}
+	hybrid, _ := body["hybrid"].(map[string]interface{})
+	return hybrid
+}
+
+//test zero semantic ratio sent as real zero
+func TestHybridSemanticRatio(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName, `{"id":1}`)
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+	searchPath := "POST /indexes/" + IndexName + "/search"
+
+	//zero ratio, full keyword
+	ratio := 0.0
+	_, err := face.Search[map[string]interface{}](index.GetDoc(), &define.QueryPara{
+		Key: "go",
+		Hybrid: &define.HybridPara{SemanticRatio: &ratio},
+	})
+	if err != nil {
+		t.Errorf("search failed, err:%v", err.Error())
+		return
+	}
+	hybrid := getHybridBlock(t, fake, searchPath)
+	if v, ok := hybrid["semanticRatio"]; !ok || v != 0.0 {
+		t.Errorf("expect zero semantic ratio, got %v", hybrid)
+		return
+	}
+	if hybrid["embedder"] != define.DefaultEmbedder {
+		t.Errorf("expect default embedder, got %v", hybrid)
+		return
+	}
+
+	//nil ratio, meili default
+	_, _, _, err = index.GetDoc().QueryIndexDocs(&define.QueryPara{
+		Hybrid: &define.HybridPara{Embedder: "custom"},
+	})
+	if err != nil {
+		t.Errorf("query docs failed, err:%v", err.Error())
+		return
+	}
+	hybrid = getHybridBlock(t, fake, searchPath)
+	if _, ok := hybrid["semanticRatio"]; ok || hybrid["embedder"] != "custom" {
+		t.Errorf("expect no semantic ratio, got %v", hybrid)
+	}
+}
+
+//test zero semantic ratio of multi search query
+func TestHybridMultiSearch(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs("books", `{"id":1}`)
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	ratio := 0.0
+	results, err := client.MultiSearch(&define.QueryPara{
+		IndexName: "books",
+		Hybrid: &define.HybridPara{SemanticRatio: &ratio},
+	})
+	if err != nil || len(results) != 1 || len(results[0].Hits) != 1 {
+		t.Errorf("multi search failed, results:%+v, err:%v", results, err)
+		return
+	}
+	hybrid := getHybridBlock(t, fake, "POST /multi-search")
+	if v, ok := hybrid["semanticRatio"]; !ok || v != 0.0 {
+		t.Errorf("expect zero semantic ratio, got %v", hybrid)
+	}
+}
+
+//test embedders checked by source before sent
+func TestEmbedderCheck(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+	embedderPath := "PATCH /indexes/" + IndexName + "/settings/embedders"
+
+	invalids := map[string]meilisearch.Embedder{
+		"no dimensions": {Source: define.EmbedderSourceUserProvided},
+		"no rest url": {Source: define.EmbedderSourceRest},
+		"no model": {Source: define.EmbedderSourceOllama},
+		"bad source": {Source: "unknown"},
+	}
+	for name, embedder := range invalids {
+		err := index.UpdateEmbedders(map[string]meilisearch.Embedder{"default": embedder})
+		if err == nil {
+			t.Errorf("%v, expect embedder rejected", name)
+			return
+		}
+	}
+	if reqs := fake.getRequests(embedderPath); len(reqs) > 0 {
+		t.Errorf("invalid embedders sent, got %v", reqs)
+		return
+	}
+
+	err := index.UpdateEmbedders(map[string]meilisearch.Embedder{
+		"default": {Source: define.EmbedderSourceUserProvided, Dimensions: 3},
+	})
+	if err != nil {
+		t.Errorf("update embedders failed, err:%v", err.Error())
+		return
+	}
+	if reqs := fake.getRequests(embedderPath); len(reqs) != 1 {
+		t.Errorf("expect 1 embedders request, got %v", reqs)
+	}
+}
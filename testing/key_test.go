@@ -0,0 +1,184 @@
+package testing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/define"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//get key names by uid
+func getKeyNames(t *testing.T, keys *face.KeyManager) map[string]string {
+	list, err := keys.ListAll(context.Background())
+	if err != nil {
+		t.Errorf("list keys failed, err:%v", err.Error())
+		return nil
+	}
+	result := map[string]string{}
+	for _, key := range list {
+		result[key.UID] = key.Name
+	}
+	return result
+}
+
+//test declared keys created once
+func TestKeyProvision(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	keys := client.Keys()
+
+	specs := []*face.KeySpec{face.SearchKeySpec("books"), face.AdminKeySpec("writer", "books")}
+	first, err := keys.Provision(context.Background(), specs...)
+	if err != nil || len(first) != 2 || first["search-books"].Key == "" {
+		t.Errorf("provision failed, result:%v, err:%v", first, err)
+		return
+	}
+	second, err := keys.Provision(context.Background(), specs...)
+	if err != nil {
+		t.Errorf("provision again failed, err:%v", err.Error())
+		return
+	}
+	for name, key := range first {
+		if second[name] == nil || second[name].UID != key.UID {
+			t.Errorf("key %v recreated", name)
+			return
+		}
+	}
+	if reqs := fake.getRequests("POST /keys"); len(reqs) != 2 {
+		t.Errorf("expect 2 keys created, got %v", len(reqs))
+		return
+	}
+
+	//duplicated or reserved spec name rejected
+	if _, err = keys.Provision(context.Background(), specs[0], specs[0]); err == nil {
+		t.Errorf("expect duplicated spec name rejected")
+		return
+	}
+	if _, err = keys.Provision(context.Background(), face.AdminKeySpec("a" + define.KeyRotatedTag + "1")); err == nil {
+		t.Errorf("expect reserved spec name rejected")
+	}
+}
+
+//test old key renamed and kept after rotation, deleted after grace
+func TestKeyProvisionRotate(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	keys := client.Keys()
+
+	spec := face.AdminKeySpec("writer", "books")
+	first, err := keys.Provision(context.Background(), spec)
+	if err != nil {
+		t.Errorf("provision failed, err:%v", err.Error())
+		return
+	}
+	oldUid := first["writer"].UID
+
+	//scope changed, new key created, old key kept
+	spec.Indexes = []string{"books", "movies"}
+	second, err := keys.Provision(context.Background(), spec)
+	if err != nil || second["writer"].UID == oldUid {
+		t.Errorf("key not rotated, result:%v, err:%v", second, err)
+		return
+	}
+	names := getKeyNames(t, keys)
+	if len(names) != 2 || !strings.HasPrefix(names[oldUid], "writer" + define.KeyRotatedTag) {
+		t.Errorf("expect old key renamed and kept, got %v", names)
+		return
+	}
+	if reqs := fake.getRequests("DELETE /keys"); len(reqs) > 0 {
+		t.Errorf("old key deleted without opt in, got %v", reqs)
+		return
+	}
+
+	//rotated key kept in grace period, deleted after it
+	_, err = keys.ProvisionWithOptions(context.Background(), &face.ProvisionOptions{
+		RotatedGrace: time.Hour,
+	}, spec)
+	if names = getKeyNames(t, keys); err != nil || len(names) != 2 {
+		t.Errorf("rotated key deleted in grace period, names:%v, err:%v", names, err)
+		return
+	}
+	_, err = keys.ProvisionWithOptions(context.Background(), &face.ProvisionOptions{
+		RotatedGrace: time.Nanosecond,
+	}, spec)
+	names = getKeyNames(t, keys)
+	if _, ok := names[oldUid]; err != nil || ok || len(names) != 1 {
+		t.Errorf("rotated key not deleted after grace, names:%v, err:%v", names, err)
+	}
+}
+
+//test old key deleted at once if opted in
+func TestKeyProvisionDeleteRotated(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	keys := client.Keys()
+
+	spec := face.SearchKeySpec("books")
+	first, err := keys.Provision(context.Background(), spec)
+	if err != nil {
+		t.Errorf("provision failed, err:%v", err.Error())
+		return
+	}
+	spec.Actions = append(spec.Actions, face.KeyActionDocumentsGet)
+	second, err := keys.ProvisionWithOptions(context.Background(), &face.ProvisionOptions{
+		DeleteRotated: true,
+	}, spec)
+	if err != nil {
+		t.Errorf("provision failed, err:%v", err.Error())
+		return
+	}
+	names := getKeyNames(t, keys)
+	if len(names) != 1 || names[second["search-books"].UID] != "search-books" {
+		t.Errorf("expect only new key left, got %v", names)
+		return
+	}
+	if _, ok := names[first["search-books"].UID]; ok {
+		t.Errorf("old key not deleted")
+	}
+}
+
+//test keys of same name, newest matched kept and others rotated
+func TestKeyProvisionDuplicated(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	keys := client.Keys()
+
+	spec := face.SearchKeySpec("books")
+	older, err := keys.Create(spec)
+	if err != nil {
+		t.Errorf("create key failed, err:%v", err.Error())
+		return
+	}
+	time.Sleep(time.Millisecond * 5)
+	newer, err := keys.Create(spec)
+	if err != nil {
+		t.Errorf("create key failed, err:%v", err.Error())
+		return
+	}
+
+	result, err := keys.Provision(context.Background(), spec)
+	if err != nil || result["search-books"].UID != newer.UID {
+		t.Errorf("expect newest key kept, result:%v, err:%v", result, err)
+		return
+	}
+	names := getKeyNames(t, keys)
+	if names[newer.UID] != "search-books" ||
+		!strings.HasPrefix(names[older.UID], "search-books" + define.KeyRotatedTag) {
+		t.Errorf("expect older duplicated key rotated, got %v", names)
+		return
+	}
+	if reqs := fake.getRequests("POST /keys"); len(reqs) != 2 {
+		t.Errorf("expect no key created, got %v", len(reqs))
+	}
+}
@@ -0,0 +1,90 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/define"
+)
+
+//test multi search results of each index
+func TestMultiSearch(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs("books", `{"id":1}`, `{"id":2}`)
+	fake.putDocs("movies", `{"id":3}`)
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	results, err := client.MultiSearch(
+		&define.QueryPara{IndexName: "books"},
+		&define.QueryPara{IndexName: "movies"},
+	)
+	if err != nil {
+		t.Errorf("multi search failed, err:%v", err.Error())
+		return
+	}
+	if len(results) != 2 ||
+		results[0].IndexName != "books" || len(results[0].Hits) != 2 ||
+		results[1].IndexName != "movies" || len(results[1].Hits) != 1 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+//test federated hits keep int64 precision
+func TestFederatedSearch(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs("books", `{"id":1,"big":9007199254740993}`)
+	fake.putDocs("movies", `{"id":2,"big":9007199254740995}`)
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	result, err := client.FederatedSearch(1, 10,
+		&define.QueryPara{IndexName: "books"},
+		&define.QueryPara{IndexName: "movies", Weight: 0.5},
+	)
+	if err != nil {
+		t.Errorf("federated search failed, err:%v", err.Error())
+		return
+	}
+	if len(result.Hits) != 2 {
+		t.Errorf("expect 2 hits, got %v", len(result.Hits))
+		return
+	}
+	expects := map[string]int64{
+		"books": 9007199254740993,
+		"movies": 9007199254740995,
+	}
+	for _, hit := range result.Hits {
+		doc := struct {
+			Big int64 `json:"big"`
+		}{}
+		if err = hit.Decode(&doc); err != nil {
+			t.Errorf("decode hit failed, err:%v", err.Error())
+			return
+		}
+		if doc.Big != expects[hit.IndexName] {
+			t.Errorf("index %v hit lost precision, got %v", hit.IndexName, doc.Big)
+		}
+	}
+}
+
+//test facets of query rejected in federated mode
+func TestFederatedSearchFacets(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	_, err := client.FederatedSearch(1, 10,
+		&define.QueryPara{IndexName: "books", Facets: []string{"genre"}},
+	)
+	if err == nil {
+		t.Errorf("expect facets rejected")
+		return
+	}
+	if reqs := fake.getRequests("POST /multi-search"); len(reqs) > 0 {
+		t.Errorf("request sent with facets, got %v", reqs)
+	}
+}
@@ -0,0 +1,162 @@
+package testing
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/lib"
+)
+
+//gen queue with blocked callback
+func genBlockedQueue(size int) (*lib.Queue, chan bool) {
+	blockChan := make(chan bool)
+	q := lib.NewQueue(size)
+	q.SetCallback(func(data interface{}) (interface{}, error) {
+		<- blockChan
+		return nil, nil
+	})
+	return q, blockChan
+}
+
+//fill queue until full
+func fillQueue(q *lib.Queue, size int) {
+	//first data picked by main process and blocked in callback
+	q.SendData(0)
+	time.Sleep(time.Millisecond * 50)
+	for i := 1; i <= size; i++ {
+		q.SendData(i)
+	}
+}
+
+//test fail fast policy
+func TestQueueFailFast(t *testing.T) {
+	q, blockChan := genBlockedQueue(2)
+	defer close(blockChan)
+	q.SetOverflow(lib.OverflowFailFast, 0, 0)
+	fillQueue(q, 2)
+	_, err := q.SendData(3)
+	if err != lib.ErrQueueFull {
+		t.Errorf("expect ErrQueueFull, got %v", err)
+	}
+}
+
+//test block with timeout policy
+func TestQueueBlockTimeout(t *testing.T) {
+	q, blockChan := genBlockedQueue(2)
+	defer close(blockChan)
+	q.SetOverflow(lib.OverflowBlock, time.Millisecond * 50, 0)
+	fillQueue(q, 2)
+	now := time.Now()
+	_, err := q.SendData(3)
+	if err != lib.ErrQueueFull {
+		t.Errorf("expect ErrQueueFull, got %v", err)
+		return
+	}
+	if time.Since(now) < time.Millisecond * 50 {
+		t.Errorf("return before timeout")
+	}
+}
+
+//test drop oldest policy
+func TestQueueDropOldest(t *testing.T) {
+	var (
+		dropped int32
+	)
+	q, blockChan := genBlockedQueue(2)
+	defer close(blockChan)
+	q.SetOverflow(lib.OverflowDropOldest, 0, 0)
+	q.SetDropCallback(func(data interface{}) {
+		atomic.AddInt32(&dropped, 1)
+	})
+	fillQueue(q, 2)
+	for i := 3; i < 6; i++ {
+		_, err := q.SendData(i)
+		if err != nil {
+			t.Errorf("send data failed, err:%v", err.Error())
+			return
+		}
+	}
+	if atomic.LoadInt32(&dropped) != 3 {
+		t.Errorf("expect 3 dropped, got %v", dropped)
+	}
+}
+
+//test spill policy
+func TestQueueSpill(t *testing.T) {
+	var (
+		processed int32
+	)
+	blockChan := make(chan bool)
+	q := lib.NewQueue(2)
+	q.SetOverflow(lib.OverflowSpill, 0, 3)
+	q.SetCallback(func(data interface{}) (interface{}, error) {
+		<- blockChan
+		atomic.AddInt32(&processed, 1)
+		return nil, nil
+	})
+	fillQueue(q, 2)
+	for i := 3; i < 6; i++ {
+		_, err := q.SendData(i)
+		if err != nil {
+			t.Errorf("send data failed, err:%v", err.Error())
+			return
+		}
+	}
+	if q.GetSpillSize() != 3 {
+		t.Errorf("expect 3 spilled, got %v", q.GetSpillSize())
+		return
+	}
+	_, err := q.SendData(6)
+	if err != lib.ErrQueueFull {
+		t.Errorf("expect ErrQueueFull, got %v", err)
+		return
+	}
+
+	//release all and check processed
+	close(blockChan)
+	time.Sleep(time.Millisecond * 100)
+	if atomic.LoadInt32(&processed) != 6 {
+		t.Errorf("expect 6 processed, got %v", processed)
+	}
+}
+
+//counter sink for test
+type counterSink struct {
+	counters map[string]int64
+	sync.Mutex
+}
+
+func (s *counterSink) IncCounter(name string, value int64, labels map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	s.counters[name + "|" + lib.FormatLabels(labels)] += value
+}
+func (s *counterSink) SetGauge(name string, value float64, labels map[string]string) {}
+func (s *counterSink) Observe(name string, value float64, labels map[string]string) {}
+
+//test queue metrics of worker
+func TestQueueMetrics(t *testing.T) {
+	sink := &counterSink{
+		counters: map[string]int64{},
+	}
+	w := lib.NewWorker()
+	defer w.Quit()
+	w.SetMetrics(sink)
+	w.SetCBForQueueOpt(func(data interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	w.CreateWorkers(1)
+	for i := 0; i < 10; i++ {
+		w.SendData(i, "a", true)
+	}
+
+	sink.Lock()
+	defer sink.Unlock()
+	enqueued := sink.counters[lib.MetricQueueEnqueue + "|worker=1"]
+	dequeued := sink.counters[lib.MetricQueueDequeue + "|worker=1"]
+	if enqueued != 10 || dequeued != 10 {
+		t.Errorf("expect 10 enqueued and dequeued, got %v, %v", enqueued, dequeued)
+	}
+}
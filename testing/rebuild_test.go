@@ -0,0 +1,91 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//test rebuild swaps shadow index into live
+func TestRebuildSwap(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName, `{"id":1}`, `{"id":2}`)
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	shadowName := ""
+	err := index.Rebuild(func(builder *face.IndexBuilder) error {
+		shadowName = builder.GetIndexName()
+		return builder.AddDocs([]map[string]interface{}{{"id": 3}, {"id": 4}})
+	})
+	if err != nil {
+		t.Errorf("rebuild failed, err:%v", err.Error())
+		return
+	}
+	if ids := fake.getDocIds(IndexName); !reflect.DeepEqual(ids, []string{"3", "4"}) {
+		t.Errorf("expect rebuilt docs 3 and 4, got %v", ids)
+		return
+	}
+	if names := fake.getIndexNames(); len(names) != 1 || shadowName == IndexName {
+		t.Errorf("shadow index not dropped, indexes:%v", names)
+	}
+}
+
+//test live writes while filling replayed into shadow index
+func TestRebuildCaptureReplay(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+	doc := index.GetDoc()
+
+	err := index.Rebuild(func(builder *face.IndexBuilder) error {
+		err := builder.AddDocs([]map[string]interface{}{{"id": 3}, {"id": 4}})
+		if err != nil {
+			return err
+		}
+		//live writes applied while filling
+		added, _ := doc.AddDoc(map[string]interface{}{"id": 5})
+		removed, _ := doc.DelDoc("", "3")
+		if failed := waitFutures(t, []*face.WriteFuture{added, removed}); failed > 0 {
+			return errors.New("live writes failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("rebuild failed, err:%v", err.Error())
+		return
+	}
+	if ids := fake.getDocIds(IndexName); !reflect.DeepEqual(ids, []string{"4", "5"}) {
+		t.Errorf("expect docs 4 and 5 after replay, got %v", ids)
+	}
+}
+
+//test failed fill drops shadow and keeps live index
+func TestRebuildFillFailed(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName, `{"id":1}`)
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	err := index.Rebuild(func(builder *face.IndexBuilder) error {
+		return errors.New("source failed")
+	})
+	if err == nil {
+		t.Errorf("expect rebuild failed")
+		return
+	}
+	if names := fake.getIndexNames(); len(names) != 1 || names[0] != IndexName {
+		t.Errorf("shadow index not dropped, indexes:%v", names)
+		return
+	}
+	if ids := fake.getDocIds(IndexName); len(ids) != 1 {
+		t.Errorf("live docs changed, got %v", ids)
+	}
+}
@@ -0,0 +1,73 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+)
+
+//test plan and applied payload from same merged value
+func TestReconcileSettings(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	oneTypo, maxValues := int64(4), int64(0)
+	index := fake.newIndex(&conf.IndexConf{
+		SearchableFields: []string{"title", "tags"},
+		TypoTolerance: &conf.TypoToleranceConf{OneTypo: &oneTypo},
+		Faceting: &conf.FacetingConf{MaxValuesPerFacet: &maxValues},
+	}, 1)
+	defer index.Quit(context.Background())
+
+	//dry run
+	plan, err := index.PlanSettings()
+	if err != nil {
+		t.Errorf("plan settings failed, err:%v", err.Error())
+		return
+	}
+	if len(plan.Changes) != 3 || plan.Applied {
+		t.Errorf("expect 3 changes not applied, got %v", plan.String())
+		return
+	}
+	if !plan.Settings.TypoTolerance.Enabled ||
+		plan.Settings.TypoTolerance.MinWordSizeForTypos.TwoTypos != 9 {
+		t.Errorf("typo tolerance not merged from live, got %+v", *plan.Settings.TypoTolerance)
+		return
+	}
+	if len(fake.getRequests("PATCH")) > 0 {
+		t.Errorf("settings applied by dry run")
+		return
+	}
+
+	//apply, then settings up to date
+	plan, err = index.ReconcileSettings()
+	if err != nil || !plan.Applied {
+		t.Errorf("reconcile settings failed, err:%v", err)
+		return
+	}
+	plan, err = index.PlanSettings()
+	if err != nil || plan.HasChanges() {
+		t.Errorf("expect settings up to date, got %v, err:%v", plan.String(), err)
+	}
+}
+
+//test declared values same as live value not planned
+func TestReconcileSettingsUpToDate(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	enabled, maxValues := true, int64(100)
+	index := fake.newIndex(&conf.IndexConf{
+		TypoTolerance: &conf.TypoToleranceConf{Enabled: &enabled},
+		Faceting: &conf.FacetingConf{MaxValuesPerFacet: &maxValues},
+	}, 1)
+	defer index.Quit(context.Background())
+
+	plan, err := index.PlanSettings()
+	if err != nil {
+		t.Errorf("plan settings failed, err:%v", err.Error())
+		return
+	}
+	if plan.HasChanges() {
+		t.Errorf("expect no changes, got %v", plan.String())
+	}
+}
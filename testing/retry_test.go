@@ -0,0 +1,123 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//new index with fast retry of fake server
+func newRetryIndex(fake *fakeMeili) *face.Index {
+	return fake.newIndex(&conf.IndexConf{
+		Timeout: time.Millisecond * 10,
+		Retry: &conf.RetryConf{
+			MaxAttempts: 3,
+			BaseBackoff: time.Millisecond,
+			MaxBackoff: time.Millisecond * 5,
+			Retry5xx: true,
+			RetryTaskCodes: []string{"internal"},
+		},
+	}, 1)
+}
+
+//add one doc and wait final result
+func addDocAndWait(index *face.Index) (*face.WriteFuture, error) {
+	future, err := index.GetDoc().AddDoc(map[string]interface{}{"id": 1})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 5)
+	defer cancel()
+	return future, future.Wait(ctx)
+}
+
+//test submit retried after 5xx
+func TestRetrySubmit(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.writeFails = 2
+	index := newRetryIndex(fake)
+	defer index.Quit(context.Background())
+
+	future, err := addDocAndWait(index)
+	if err != nil {
+		t.Errorf("write failed, err:%v", err.Error())
+		return
+	}
+	if future.Attempts() != 3 || atomic.LoadInt32(&fake.writes) != 3 {
+		t.Errorf("expect 3 attempts, got %v, writes:%v", future.Attempts(), fake.writes)
+	}
+}
+
+//test submit failed after attempts exhausted
+func TestRetryExhausted(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.writeFails = 5
+	index := newRetryIndex(fake)
+	defer index.Quit(context.Background())
+
+	future, err := addDocAndWait(index)
+	if err == nil {
+		t.Errorf("expect write failed")
+		return
+	}
+	if future.Attempts() != 3 {
+		t.Errorf("expect 3 attempts, got %v", future.Attempts())
+	}
+}
+
+//test failed polling not resubmit write
+func TestRetryPolling(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.pollFails = 1
+	index := newRetryIndex(fake)
+	defer index.Quit(context.Background())
+
+	_, err := addDocAndWait(index)
+	if err != nil {
+		t.Errorf("write failed, err:%v", err.Error())
+		return
+	}
+	if writes := atomic.LoadInt32(&fake.writes); writes != 1 {
+		t.Errorf("write resubmitted by polling failure, writes:%v", writes)
+	}
+}
+
+//test failed task resubmitted only with retry code
+func TestRetryTaskCode(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.taskFails = 1
+	fake.taskCode = "internal"
+	index := newRetryIndex(fake)
+	defer index.Quit(context.Background())
+	future, err := addDocAndWait(index)
+	if err != nil || future.Attempts() != 2 {
+		t.Errorf("expect retried task succeed, err:%v", err)
+		return
+	}
+
+	//other code not retried
+	other := newFakeMeili()
+	defer other.Close()
+	other.taskFails = 1
+	other.taskCode = "invalid_document_id"
+	otherIndex := newRetryIndex(other)
+	defer otherIndex.Quit(context.Background())
+	future, err = addDocAndWait(otherIndex)
+	var taskErr *face.TaskError
+	if !errors.As(err, &taskErr) || taskErr.Code != other.taskCode {
+		t.Errorf("expect task error, got %v", err)
+		return
+	}
+	if future.Attempts() != 1 {
+		t.Errorf("expect 1 attempt, got %v", future.Attempts())
+	}
+}
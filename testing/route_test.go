@@ -0,0 +1,50 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//test writes of one doc without data id kept in order
+//routed by primary key, not round robin
+func TestDocRoutingByPrimaryKey(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.writeDelay = time.Millisecond * 5
+	index := fake.newIndex(&conf.IndexConf{
+		Timeout: time.Millisecond * 10,
+	}, 4)
+	defer index.Quit(context.Background())
+
+	futures := make([]*face.WriteFuture, 0)
+	for i := 0; i < 20; i++ {
+		future, err := index.GetDoc().UpdateDoc(map[string]interface{}{"id": "doc-1", "seq": i})
+		if err != nil {
+			t.Errorf("update doc failed, err:%v", err.Error())
+			return
+		}
+		futures = append(futures, future)
+	}
+	if failed := waitFutures(t, futures); failed > 0 {
+		t.Errorf("%v writes failed", failed)
+		return
+	}
+
+	//task uid grows in sending order
+	for i := 1; i < len(futures); i++ {
+		if futures[i].TaskInfo().TaskUID <= futures[i - 1].TaskInfo().TaskUID {
+			t.Errorf("write %v applied before write %v", i, i - 1)
+			return
+		}
+	}
+	var seq int
+	json.Unmarshal(fake.getDoc(IndexName, "doc-1")["seq"], &seq)
+	if seq != 19 {
+		t.Errorf("expect last seq 19, got %v", seq)
+	}
+}
@@ -0,0 +1,118 @@
+package testing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+	"github.com/andyzhou/tinymeili/filter"
+)
+
+//doc of scan
+type scanDoc struct {
+	Id  int64 `json:"id"`
+	Big int64 `json:"big"`
+}
+
+//test scan pages through all docs, numbers kept
+func TestScanPages(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName,
+		`{"id":1,"big":9007199254740993}`,
+		`{"id":2,"big":9007199254740995}`,
+		`{"id":3,"big":9007199254740997}`,
+		`{"id":4,"big":9007199254740999}`,
+		`{"id":5,"big":9007199254741001}`,
+	)
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	iter := face.ScanDocs[scanDoc](context.Background(), index.GetDoc(), &face.ScanOptions{
+		PageSize: 2,
+	})
+	defer iter.Close()
+	ids := make([]int64, 0)
+	for iter.Next() {
+		doc := iter.Doc()
+		if doc.Big != 9007199254740991 + doc.Id * 2 {
+			t.Errorf("doc %v lost precision, got %v", doc.Id, doc.Big)
+			return
+		}
+		ids = append(ids, doc.Id)
+	}
+	if iter.Err() != nil {
+		t.Errorf("scan failed, err:%v", iter.Err().Error())
+		return
+	}
+	if len(ids) != 5 || iter.Total() != 5 {
+		t.Errorf("expect 5 docs, got %v, total %v", ids, iter.Total())
+		return
+	}
+	if reqs := fake.getRequests("GET /indexes/" + IndexName + "/documents"); len(reqs) != 3 {
+		t.Errorf("expect 3 pages, got %v", len(reqs))
+	}
+}
+
+//test scan with filter by fetch api
+func TestScanFilter(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName, `{"id":1}`, `{"id":2}`)
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	iter := index.GetDoc().Scan(context.Background(), &face.ScanOptions{
+		Filter: filter.And(filter.Raw("a = 1 OR a = 2"), filter.IsNotNull("id")),
+	})
+	defer iter.Close()
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	if iter.Err() != nil || count != 2 {
+		t.Errorf("scan failed, count:%v, err:%v", count, iter.Err())
+		return
+	}
+	reqs := fake.getRequests("POST /indexes/" + IndexName + "/documents/fetch")
+	if len(reqs) != 1 || !strings.Contains(reqs[0], `"filter":"(a = 1 OR a = 2) AND id IS NOT NULL"`) {
+		t.Errorf("unexpected fetch requests %v", reqs)
+	}
+}
+
+//test scan bounded by client timeout
+func TestScanTimeout(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs(IndexName, `{"id":1}`)
+	fake.readDelay = time.Millisecond * 500
+	client := fake.newClient(func(cfg *conf.ClientConf) {
+		cfg.TimeOut = time.Millisecond * 50
+	})
+	defer client.Quit(context.Background())
+	client.CreateIndex(&conf.IndexConf{
+		IndexName: IndexName,
+		PrimaryKey: PrimaryKey,
+	})
+	index, err := client.GetIndex(IndexName)
+	if err != nil {
+		t.Errorf("get index failed, err:%v", err.Error())
+		return
+	}
+
+	begin := time.Now()
+	iter := index.GetDoc().Scan(context.Background(), nil)
+	defer iter.Close()
+	for iter.Next() {
+	}
+	if iter.Err() == nil {
+		t.Errorf("expect scan timeout")
+		return
+	}
+	if time.Since(begin) >= fake.readDelay {
+		t.Errorf("scan not bounded by client timeout, cost %v", time.Since(begin))
+	}
+}
@@ -0,0 +1,70 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+//test typo tolerance overlaid on live value
+func TestUpdateTypoTolerance(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	oneTypo := int64(4)
+	err := index.UpdateTypoTolerance(&conf.TypoToleranceConf{
+		OneTypo: &oneTypo,
+	})
+	if err != nil {
+		t.Errorf("update typo tolerance failed, err:%v", err.Error())
+		return
+	}
+	typo, _ := fake.getSettings(IndexName)["typoTolerance"].(map[string]interface{})
+	sizes, _ := typo["minWordSizeForTypos"].(map[string]interface{})
+	if typo["enabled"] != true {
+		t.Errorf("typo tolerance disabled by unassigned field, got %v", typo)
+		return
+	}
+	if sizes["oneTypo"] != float64(4) || sizes["twoTypos"] != float64(9) {
+		t.Errorf("unexpected min word sizes %v", sizes)
+	}
+}
+
+//test faceting overlaid on live value
+func TestUpdateFaceting(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	index := fake.newIndex(&conf.IndexConf{}, 1)
+	defer index.Quit(context.Background())
+
+	err := index.UpdateFaceting(&conf.FacetingConf{
+		SortFacetValuesBy: map[string]meilisearch.SortFacetType{
+			"genre": meilisearch.SortFacetTypeCount,
+		},
+	})
+	if err != nil {
+		t.Errorf("update faceting failed, err:%v", err.Error())
+		return
+	}
+	faceting, _ := fake.getSettings(IndexName)["faceting"].(map[string]interface{})
+	sortBy, _ := faceting["sortFacetValuesBy"].(map[string]interface{})
+	if faceting["maxValuesPerFacet"] != float64(100) {
+		t.Errorf("max values per facet reset, got %v", faceting)
+		return
+	}
+	if sortBy["*"] != "alpha" || sortBy["genre"] != "count" {
+		t.Errorf("unexpected sort facet values by %v", sortBy)
+	}
+
+	//explicit zero value applied
+	maxValues := int64(0)
+	index.UpdateFaceting(&conf.FacetingConf{MaxValuesPerFacet: &maxValues})
+	faceting, _ = fake.getSettings(IndexName)["faceting"].(map[string]interface{})
+	if faceting["maxValuesPerFacet"] != float64(0) {
+		t.Errorf("expect max values per facet 0, got %v", faceting)
+	}
+}
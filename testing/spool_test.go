@@ -0,0 +1,204 @@
+package testing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/lib"
+)
+
+//replay spool, return replayed records data
+func replaySpool(spool *lib.Spool) ([]string, error) {
+	result := make([]string, 0)
+	_, err := spool.Replay(func(seq int64, data []byte) error {
+		result = append(result, string(data))
+		return nil
+	})
+	return result, err
+}
+
+//test replay un-acked records after reopen
+func TestSpoolReplay(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.spool")
+	spool, err := lib.NewSpool(filePath)
+	if err != nil {
+		t.Errorf("new spool failed, err:%v", err.Error())
+		return
+	}
+	for _, data := range []string{"a", "b", "c"} {
+		spool.Append([]byte(data))
+	}
+	spool.Ack(2)
+	spool.Close()
+
+	//reopen and replay
+	spool, err = lib.NewSpool(filePath)
+	if err != nil {
+		t.Errorf("reopen spool failed, err:%v", err.Error())
+		return
+	}
+	defer spool.Close()
+	result, err := replaySpool(spool)
+	if err != nil || len(result) != 2 || result[0] != "a" || result[1] != "c" {
+		t.Errorf("expect a and c replayed, got %v, err:%v", result, err)
+	}
+}
+
+//test spool file locked by one owner
+func TestSpoolLocked(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.spool")
+	spool, err := lib.NewSpool(filePath)
+	if err != nil {
+		t.Errorf("new spool failed, err:%v", err.Error())
+		return
+	}
+	_, err = lib.NewSpool(filePath)
+	if err != lib.ErrSpoolLocked {
+		t.Errorf("expect ErrSpoolLocked, got %v", err)
+		return
+	}
+
+	//lock released by close
+	spool.Close()
+	spool, err = lib.NewSpool(filePath)
+	if err != nil {
+		t.Errorf("reopen spool failed, err:%v", err.Error())
+		return
+	}
+	spool.Close()
+}
+
+//test spool file compacted while records keep pending
+func TestSpoolCompact(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.spool")
+	spool, err := lib.NewSpool(filePath)
+	if err != nil {
+		t.Errorf("new spool failed, err:%v", err.Error())
+		return
+	}
+	spool.SetCompactSize(1024)
+
+	//one record keep pending, others acked
+	spool.Append([]byte("pending"))
+	for i := 0; i < 1000; i++ {
+		seq, _ := spool.Append([]byte("acked record"))
+		spool.Ack(seq)
+	}
+	if size := spool.GetFileSize(); size > 2048 {
+		t.Errorf("spool file not compacted, size:%v", size)
+		return
+	}
+	if info, _ := os.Stat(filePath); info == nil || info.Size() != spool.GetFileSize() {
+		t.Errorf("spool file size not match, info:%v", info)
+		return
+	}
+	spool.Close()
+
+	//pending record kept after compacted
+	spool, err = lib.NewSpool(filePath)
+	if err != nil {
+		t.Errorf("reopen spool failed, err:%v", err.Error())
+		return
+	}
+	defer spool.Close()
+	result, _ := replaySpool(spool)
+	if len(result) != 1 || result[0] != "pending" {
+		t.Errorf("expect pending record replayed, got %v", result)
+	}
+}
+
+//test doc picks first unlocked spool slot, same slot after restart
+func TestDocSpoolSlot(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	spoolDir := t.TempDir()
+
+	first := fake.newIndex(&conf.IndexConf{SpoolDir: spoolDir}, 1)
+	second := fake.newIndex(&conf.IndexConf{SpoolDir: spoolDir}, 1)
+	for _, slot := range []string{"0", "1"} {
+		if _, err := os.Stat(filepath.Join(spoolDir, IndexName + "_" + slot + ".spool")); err != nil {
+			t.Errorf("spool slot %v not opened, err:%v", slot, err.Error())
+			return
+		}
+	}
+	second.Quit(context.Background())
+	first.Quit(context.Background())
+
+	//restarted doc reuse slot 0
+	restarted := fake.newIndex(&conf.IndexConf{SpoolDir: spoolDir}, 1)
+	defer restarted.Quit(context.Background())
+	_, err := lib.NewSpool(filepath.Join(spoolDir, IndexName + "_0.spool"))
+	if err != lib.ErrSpoolLocked {
+		t.Errorf("slot 0 not locked by restarted doc, err:%v", err)
+	}
+}
+
+//test released records replayed in background
+func TestDocSpoolBackgroundReplay(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.writeFails = 1
+	index := fake.newIndex(&conf.IndexConf{SpoolDir: t.TempDir()}, 1)
+	defer index.Quit(context.Background())
+
+	//first write failed by transport, record released
+	future, err := index.GetDoc().AddDoc(map[string]interface{}{"id": 1})
+	if err != nil {
+		t.Errorf("add doc failed, err:%v", err.Error())
+		return
+	}
+	<- future.Done()
+	if future.Err() == nil {
+		t.Errorf("expect first write failed")
+		return
+	}
+
+	//replayed without manual call
+	deadline := time.Now().Add(time.Second * 5)
+	for len(fake.getDocIds(IndexName)) <= 0 {
+		if time.Now().After(deadline) {
+			t.Errorf("released record not replayed")
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	for index.GetDoc().GetSpoolPendingSize() > 0 {
+		if time.Now().After(deadline) {
+			t.Errorf("replayed record not acked")
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+//test writes rejected if spool can't be opened
+func TestDocSpoolOpenFailed(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+
+	//spool dir is a file
+	spoolDir := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(spoolDir, []byte("x"), 0644)
+	index := fake.newIndex(&conf.IndexConf{SpoolDir: spoolDir}, 1)
+	defer index.Quit(context.Background())
+	if _, err := index.GetDoc().AddDoc(map[string]interface{}{"id": 1}); err == nil {
+		t.Errorf("expect write rejected")
+		return
+	}
+
+	//client returns error directly
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	err := client.CreateIndex(&conf.IndexConf{
+		IndexName: IndexName,
+		PrimaryKey: PrimaryKey,
+		SpoolDir: spoolDir,
+	})
+	if err == nil {
+		t.Errorf("expect create index failed")
+	}
+}
@@ -0,0 +1,102 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/face"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+//test iterate tasks page by page, newest first
+func TestTaskIter(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	for i := 0; i < 5; i++ {
+		fake.putTask(IndexName, "documentAdditionOrUpdate", "succeeded")
+	}
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+
+	iter := client.Tasks().Iter(context.Background(), nil, 2)
+	uids := make([]int64, 0)
+	for iter.Next() {
+		uids = append(uids, iter.Task().UID)
+	}
+	if iter.Err() != nil {
+		t.Errorf("iter tasks failed, err:%v", iter.Err().Error())
+		return
+	}
+	if len(uids) != 5 {
+		t.Errorf("expect 5 tasks, got %v", uids)
+		return
+	}
+	for i := 1; i < len(uids); i++ {
+		if uids[i] >= uids[i - 1] {
+			t.Errorf("tasks not newest first, uids:%v", uids)
+			return
+		}
+	}
+}
+
+//test list tasks by status and get task error
+func TestTaskFilterAndError(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	okUid := fake.putTask(IndexName, "documentAdditionOrUpdate", "succeeded")
+	failedUid := fake.putTask(IndexName, "documentAdditionOrUpdate", "failed")
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	tasks := client.Tasks()
+
+	resp, err := tasks.List(&face.TaskFilter{
+		Statuses: []meilisearch.TaskStatus{meilisearch.TaskStatusFailed},
+	}, 10, 0)
+	if err != nil {
+		t.Errorf("list tasks failed, err:%v", err.Error())
+		return
+	}
+	if len(resp.Results) != 1 || resp.Results[0].UID != failedUid {
+		t.Errorf("expect only failed task, got %+v", resp.Results)
+		return
+	}
+
+	//task error only for failed task
+	taskErr, err := tasks.GetError(failedUid)
+	if err != nil || taskErr == nil || taskErr.Code != "internal" {
+		t.Errorf("expect task error, got %v, err:%v", taskErr, err)
+		return
+	}
+	if taskErr, _ = tasks.GetError(okUid); taskErr != nil {
+		t.Errorf("expect no error of succeeded task, got %v", taskErr)
+	}
+}
+
+//test prune finished tasks and empty filter rejected
+func TestTaskPrune(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putTask(IndexName, "documentAdditionOrUpdate", "succeeded")
+	fake.putTask(IndexName, "documentAdditionOrUpdate", "failed")
+	fake.putTask(IndexName, "documentAdditionOrUpdate", "enqueued")
+	client := fake.newClient()
+	defer client.Quit(context.Background())
+	tasks := client.Tasks()
+
+	if _, err := tasks.Delete(&face.TaskFilter{}); err == nil {
+		t.Errorf("expect empty filter rejected")
+		return
+	}
+	if _, err := tasks.Cancel(nil); err == nil {
+		t.Errorf("expect nil filter rejected")
+		return
+	}
+	deleted, err := tasks.Prune(context.Background(), 1)
+	if err != nil {
+		t.Errorf("prune tasks failed, err:%v", err.Error())
+		return
+	}
+	if deleted != 2 {
+		t.Errorf("expect 2 tasks pruned, got %v", deleted)
+	}
+}
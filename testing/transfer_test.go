@@ -0,0 +1,150 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/conf"
+	"github.com/andyzhou/tinymeili/face"
+)
+
+//export source index and import into target index
+func runTransfer(
+	t *testing.T,
+	fake *fakeMeili,
+	target string,
+	format face.TransferFormat,
+	opt *face.TransferOptions) bool {
+	src := fake.newIndex(&conf.IndexConf{IndexName: "src"}, 1)
+	defer src.Quit(context.Background())
+	dst := fake.newIndex(&conf.IndexConf{IndexName: target}, 1)
+	defer dst.Quit(context.Background())
+
+	buff := bytes.NewBuffer(nil)
+	if err := src.Export(context.Background(), buff, format, opt); err != nil {
+		t.Errorf("%v export failed, err:%v", format, err.Error())
+		return false
+	}
+	if err := dst.Import(context.Background(), buff, format, opt); err != nil {
+		t.Errorf("%v import failed, err:%v", format, err.Error())
+		return false
+	}
+	return true
+}
+
+//check docs of target same as source
+func checkTransferDocs(t *testing.T, fake *fakeMeili, target string) bool {
+	srcIds := fake.getDocIds("src")
+	if ids := fake.getDocIds(target); !reflect.DeepEqual(ids, srcIds) {
+		t.Errorf("%v expect docs %v, got %v", target, srcIds, ids)
+		return false
+	}
+	for _, id := range srcIds {
+		srcDoc := fake.getDoc("src", id)
+		dstDoc := fake.getDoc(target, id)
+		if len(dstDoc) != len(srcDoc) {
+			t.Errorf("%v doc %v expect %v, got %v", target, id, srcDoc, dstDoc)
+			return false
+		}
+		for field, v := range srcDoc {
+			if !jsonEqual(v, dstDoc[field]) {
+				t.Errorf("%v doc %v field %v expect %s, got %s", target, id, field, v, dstDoc[field])
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//compare json values, numbers compared by literal
+func jsonEqual(a, b json.RawMessage) bool {
+	var bufA, bufB bytes.Buffer
+	if json.Compact(&bufA, a) != nil || json.Compact(&bufB, b) != nil {
+		return false
+	}
+	return bufA.String() == bufB.String()
+}
+
+//test ndjson and json round trip with settings, plain and gzip
+func TestTransferRoundTrip(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs("src",
+		`{"id":1,"big":9007199254740993,"title":"go","tags":["a","b"],"meta":{"n":1}}`,
+		`{"id":2,"big":9007199254740995,"title":"line\nbreak","tags":[],"meta":null}`,
+	)
+	fake.setSettings("src", `{"searchableAttributes":["title"],"stopWords":["the"]}`)
+
+	targets := []struct {
+		name   string
+		format face.TransferFormat
+		gzip   bool
+	}{
+		{"ndjson", face.FormatNdjson, false},
+		{"ndjsonGzip", face.FormatNdjson, true},
+		{"json", face.FormatJson, false},
+		{"jsonGzip", face.FormatJson, true},
+	}
+	for _, target := range targets {
+		progress := int64(0)
+		opt := &face.TransferOptions{
+			Gzip: target.gzip,
+			BatchSize: 1,
+			Progress: func(done, total int64) {
+				progress = done
+			},
+		}
+		if !runTransfer(t, fake, target.name, target.format, opt) {
+			return
+		}
+		if !checkTransferDocs(t, fake, target.name) {
+			return
+		}
+		settings := fake.getSettings(target.name)
+		if !reflect.DeepEqual(settings["searchableAttributes"], []interface{}{"title"}) ||
+			!reflect.DeepEqual(settings["stopWords"], []interface{}{"the"}) {
+			t.Errorf("%v settings not imported, got %v", target.name, settings)
+			return
+		}
+		if progress != 2 {
+			t.Errorf("%v expect progress 2, got %v", target.name, progress)
+			return
+		}
+	}
+}
+
+//test settings skipped
+func TestTransferSkipSettings(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs("src", `{"id":1}`)
+	fake.setSettings("src", `{"stopWords":["the"]}`)
+
+	if !runTransfer(t, fake, "dst", face.FormatNdjson, &face.TransferOptions{SkipSettings: true}) {
+		return
+	}
+	if !checkTransferDocs(t, fake, "dst") {
+		return
+	}
+	if reqs := fake.getRequests("PATCH /indexes/dst/settings"); len(reqs) > 0 {
+		t.Errorf("settings not skipped, got %v", reqs)
+	}
+}
+
+//test csv round trip of flat docs
+func TestTransferCsv(t *testing.T) {
+	fake := newFakeMeili()
+	defer fake.Close()
+	fake.putDocs("src",
+		`{"id":1,"price":1.5,"title":"a, \"quoted\" title"}`,
+		`{"id":2,"price":10,"title":"plain"}`,
+	)
+
+	if !runTransfer(t, fake, "dst", face.FormatCsv, nil) {
+		return
+	}
+	checkTransferDocs(t, fake, "dst")
+}
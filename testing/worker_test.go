@@ -0,0 +1,174 @@
+package testing
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/andyzhou/tinymeili/lib"
+)
+
+//get target worker id by data id
+func getTargetWorkerId(w *lib.Worker, dataId string) (int32, error) {
+	sw, err := w.GetTargetWorker(dataId)
+	if err != nil {
+		return 0, err
+	}
+	return sw.GetWorkerId(), nil
+}
+
+//test same data id routed to same worker
+func TestWorkerRouting(t *testing.T) {
+	w := lib.NewWorker()
+	defer w.Quit()
+	w.SetCBForQueueOpt(func(data interface{}) (interface{}, error) {
+		return data, nil
+	})
+	err := w.CreateWorkers(lib.DefaultWorkers)
+	if err != nil {
+		t.Errorf("create workers failed, err:%v", err.Error())
+		return
+	}
+
+	for i := 0; i < 1000; i++ {
+		dataId := fmt.Sprintf("doc-%v", i)
+		firstId, _ := getTargetWorkerId(w, dataId)
+		for j := 0; j < 3; j++ {
+			workerId, _ := getTargetWorkerId(w, dataId)
+			if workerId != firstId {
+				t.Errorf("data id %v routed to %v and %v", dataId, firstId, workerId)
+				return
+			}
+		}
+	}
+}
+
+//test most data ids keep worker when workers increased
+func TestWorkerRoutingStable(t *testing.T) {
+	w := lib.NewWorker()
+	defer w.Quit()
+	w.SetCBForQueueOpt(func(data interface{}) (interface{}, error) {
+		return data, nil
+	})
+	err := w.CreateWorkers(4)
+	if err != nil {
+		t.Errorf("create workers failed, err:%v", err.Error())
+		return
+	}
+
+	//record routing before change
+	total := 10000
+	oldRoutes := map[string]int32{}
+	for i := 0; i < total; i++ {
+		dataId := fmt.Sprintf("doc-%v", i)
+		oldRoutes[dataId], _ = getTargetWorkerId(w, dataId)
+	}
+
+	//add one more worker
+	err = w.CreateWorkers(1)
+	if err != nil {
+		t.Errorf("create workers failed, err:%v", err.Error())
+		return
+	}
+	moved := 0
+	for dataId, oldWorkerId := range oldRoutes {
+		workerId, _ := getTargetWorkerId(w, dataId)
+		if workerId != oldWorkerId {
+			moved++
+		}
+	}
+
+	//about 1/5 keys should be moved
+	if moved > total / 3 {
+		t.Errorf("too many data ids moved, %v/%v", moved, total)
+		return
+	}
+	t.Logf("moved data ids %v/%v", moved, total)
+}
+
+//test data of same id processed in order
+func TestWorkerOrdering(t *testing.T) {
+	var (
+		locker sync.Mutex
+	)
+	w := lib.NewWorker()
+	defer w.Quit()
+	processed := map[string][]int{}
+	w.SetCBForQueueOpt(func(data interface{}) (interface{}, error) {
+		pair, _ := data.([2]interface{})
+		dataId, _ := pair[0].(string)
+		seq, _ := pair[1].(int)
+		locker.Lock()
+		processed[dataId] = append(processed[dataId], seq)
+		locker.Unlock()
+		return nil, nil
+	})
+	err := w.CreateWorkers(lib.DefaultWorkers)
+	if err != nil {
+		t.Errorf("create workers failed, err:%v", err.Error())
+		return
+	}
+
+	//send data with response
+	dataIds := []string{"a", "b", "c", "d", "e"}
+	for seq := 0; seq < 100; seq++ {
+		for _, dataId := range dataIds {
+			_, err = w.SendData([2]interface{}{dataId, seq}, dataId, true)
+			if err != nil {
+				t.Errorf("send data failed, err:%v", err.Error())
+				return
+			}
+		}
+	}
+
+	//check order
+	for _, dataId := range dataIds {
+		seqs := processed[dataId]
+		if len(seqs) != 100 {
+			t.Errorf("data id %v processed %v", dataId, len(seqs))
+			return
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Errorf("data id %v out of order at %v", dataId, i)
+				return
+			}
+		}
+	}
+}
+
+//test cast data while workers changing
+func TestWorkerCastData(t *testing.T) {
+	var (
+		wg sync.WaitGroup
+	)
+	w := lib.NewWorker()
+	defer w.Quit()
+	w.SetCBForQueueOpt(func(data interface{}) (interface{}, error) {
+		return data, nil
+	})
+	w.CreateWorkers(2)
+
+	//create workers and cast data concurrently
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			w.CreateWorkers(1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := w.CastData(i); err != nil {
+				t.Errorf("cast data failed, err:%v", err.Error())
+				return
+			}
+			w.GetWorkers()
+		}
+	}()
+	wg.Wait()
+	if workers := w.GetWorkers(); workers != 22 {
+		t.Errorf("expect 22 workers, got %v", workers)
+	}
+}